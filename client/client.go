@@ -0,0 +1,265 @@
+// Package client talks to the WPManager HTTP API with a personal token (see /tokens).
+// The request and response bodies are the types of the handlers package.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"wp-manager/handlers"
+)
+
+type Client struct {
+	BaseURL string // e.g. http://localhost:8080, without the trailing slash
+	Token   string // wpt_..., sent as "Authorization: Bearer"
+	HTTP    *http.Client
+}
+
+func New(baseURL, token string) *Client {
+	return &Client{
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		Token:   token,
+		HTTP:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// Error is a non 2xx answer of the server
+type Error struct {
+	Status  int
+	Code    string // the code of the /api/v1 errors, empty for the older endpoints
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%d %s: %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("%d: %s", e.Status, e.Message)
+}
+
+// reads the error of a response: an APIError, an ErrorResponse or the text of http.Error
+func errorOf(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	e := &Error{Status: resp.StatusCode}
+	var apiErr handlers.APIError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+		e.Code, e.Message = apiErr.Code, apiErr.Error
+		return e
+	}
+	e.Message = strings.TrimSpace(string(body))
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	return e
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return req, nil
+}
+
+// do sends the request and decodes the JSON answer into out, unless out is nil
+func (c *Client) do(req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errorOf(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, out interface{}) error {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, out)
+}
+
+// ListOptions are the parameters of GET /api/v1/wallpapers
+type ListOptions struct {
+	Scope  string // mine (default), archive or public
+	Status string
+	Cursor string
+	Limit  int
+}
+
+// ListWallpapers returns one page, pass its NextCursor back for the next one
+func (c *Client) ListWallpapers(ctx context.Context, opts ListOptions) (handlers.WallpaperList, error) {
+	q := url.Values{}
+	for key, value := range map[string]string{"scope": opts.Scope, "status": opts.Status, "cursor": opts.Cursor} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	if opts.Limit > 0 {
+		q.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	var list handlers.WallpaperList
+	err := c.getJSON(ctx, "/api/v1/wallpapers?"+q.Encode(), &list)
+	return list, err
+}
+
+// AllWallpapers follows the cursors until the last page
+func (c *Client) AllWallpapers(ctx context.Context, opts ListOptions) ([]handlers.Wallpaper, error) {
+	var all []handlers.Wallpaper
+	for {
+		list, err := c.ListWallpapers(ctx, opts)
+		if err != nil {
+			return all, err
+		}
+		all = append(all, list.Data...)
+		if list.NextCursor == "" {
+			return all, nil
+		}
+		opts.Cursor = list.NextCursor
+	}
+}
+
+func (c *Client) GetWallpaper(ctx context.Context, id int) (handlers.Wallpaper, error) {
+	var wp handlers.Wallpaper
+	err := c.getJSON(ctx, "/api/v1/wallpapers/"+strconv.Itoa(id), &wp)
+	return wp, err
+}
+
+// UploadWallpaper sends one file, tags are comma separated
+func (c *Client) UploadWallpaper(ctx context.Context, filename string, file io.Reader, tags, description string) (handlers.Wallpaper, error) {
+	var wp handlers.Wallpaper
+
+	// the form is streamed, the files can be large
+	pr, pw := io.Pipe()
+	form := multipart.NewWriter(pw)
+	go func() {
+		err := form.WriteField("tags", tags)
+		if err == nil {
+			err = form.WriteField("description", description)
+		}
+		if err == nil {
+			var part io.Writer
+			if part, err = form.CreateFormFile("wallpaper", filename); err == nil {
+				_, err = io.Copy(part, file)
+			}
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/v1/wallpapers", pr)
+	if err != nil {
+		pr.Close()
+		return wp, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	err = c.do(req, &wp)
+	pr.Close()
+	return wp, err
+}
+
+func (c *Client) UpdateWallpaper(ctx context.Context, id int, update handlers.WallpaperUpdate) (handlers.Wallpaper, error) {
+	var wp handlers.Wallpaper
+	body, err := json.Marshal(update)
+	if err != nil {
+		return wp, err
+	}
+	req, err := c.newRequest(ctx, http.MethodPatch, "/api/v1/wallpapers/"+strconv.Itoa(id), bytes.NewReader(body))
+	if err != nil {
+		return wp, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	err = c.do(req, &wp)
+	return wp, err
+}
+
+// DeleteWallpaper moves the wallpaper to the trash
+func (c *Client) DeleteWallpaper(ctx context.Context, id int) error {
+	req, err := c.newRequest(ctx, http.MethodDelete, "/api/v1/wallpapers/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+// RequestPublication submits the wallpaper for review
+func (c *Client) RequestPublication(ctx context.Context, id int) (handlers.Wallpaper, error) {
+	var wp handlers.Wallpaper
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/v1/wallpapers/"+strconv.Itoa(id)+"/publish-request", nil)
+	if err != nil {
+		return wp, err
+	}
+	err = c.do(req, &wp)
+	return wp, err
+}
+
+// Search takes the parameters of /search: q, tag, uploader, orientation, sort, page...
+func (c *Client) Search(ctx context.Context, params url.Values) (handlers.SearchResponse, error) {
+	var res handlers.SearchResponse
+	err := c.getJSON(ctx, "/api/search?"+params.Encode(), &res)
+	return res, err
+}
+
+// Collection returns the collection with its items
+func (c *Client) Collection(ctx context.Context, id int) (handlers.Collection, error) {
+	var col handlers.Collection
+	err := c.getJSON(ctx, "/api/collections/"+strconv.Itoa(id), &col)
+	return col, err
+}
+
+func (c *Client) Comments(ctx context.Context, wallpaperID int) ([]handlers.Comment, error) {
+	var comments []handlers.Comment
+	err := c.getJSON(ctx, "/api/comments/"+strconv.Itoa(wallpaperID), &comments)
+	return comments, err
+}
+
+// Download opens the file of a wallpaper, the caller closes it
+func (c *Client) Download(ctx context.Context, filename string) (io.ReadCloser, error) {
+	body, _, err := c.DownloadFrom(ctx, filename, 0)
+	return body, err
+}
+
+// DownloadFrom opens the file of a wallpaper from the byte offset, to resume a download.
+// resumed is false when the server sent the whole file anyway.
+func (c *Client) DownloadFrom(ctx context.Context, filename string, offset int64) (body io.ReadCloser, resumed bool, err error) {
+	req, err := c.newRequest(ctx, http.MethodGet, "/uploads/"+url.PathEscape(filename), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		return resp.Body, true, nil
+	case resp.StatusCode == http.StatusOK:
+		return resp.Body, false, nil
+	}
+	defer resp.Body.Close()
+	return nil, false, errorOf(resp)
+}
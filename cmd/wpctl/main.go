@@ -0,0 +1,459 @@
+// wpctl manages your wallpapers from the command line, through the HTTP API and a personal
+// token created on /tokens.
+//
+//	wpctl [--server URL] [--token TOKEN] [--json] <command> [arguments]
+//
+// The server and the token can also come from WPCTL_SERVER and WPCTL_TOKEN.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"wp-manager/client"
+	"wp-manager/handlers"
+)
+
+const usage = `usage: wpctl [--server URL] [--token TOKEN] [--json] <command> [arguments]
+
+commands:
+  upload [--tags a,b] [--description text] PATH...   upload files, directories are walked
+  list [--scope mine|archive|public] [--status S] [--all]
+  search [--tag T] [--uploader U] [--orientation O] [--sort S] [--page N] [QUERY]
+  download-collection [--out DIR] ID                  download the wallpapers of a collection
+  publish ID...                                       request the publication
+  rename ID NAME
+  delete ID...                                        move to the trash
+  comments ID                                         export the comments of a wallpaper
+
+--json prints the API responses as JSON, for piping.
+`
+
+// the global options and the API client, shared by the commands
+type app struct {
+	client *client.Client
+	json   bool
+	out    io.Writer
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"upload":              uploadCmd,
+	"list":                listCmd,
+	"search":              searchCmd,
+	"download-collection": downloadCollectionCmd,
+	"publish":             publishCmd,
+	"rename":              renameCmd,
+	"delete":              deleteCmd,
+	"comments":            commentsCmd,
+}
+
+func main() {
+	flags := flag.NewFlagSet("wpctl", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	server := flags.String("server", envOr("WPCTL_SERVER", "http://localhost:8080"), "base URL of WPManager")
+	token := flags.String("token", os.Getenv("WPCTL_TOKEN"), "personal API token")
+	jsonOut := flags.Bool("json", false, "print JSON")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	cmd, ok := commands[flags.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "wpctl: unknown command %q\n\n", flags.Arg(0))
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	a := &app{client: client.New(*server, *token), json: *jsonOut, out: os.Stdout}
+	if err := cmd(ctx, a, flags.Args()[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "wpctl:", err)
+		os.Exit(1)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func (a *app) printJSON(v interface{}) error {
+	enc := json.NewEncoder(a.out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// prints wallpapers as a table, or as JSON
+func (a *app) printWallpapers(wallpapers []handlers.Wallpaper) error {
+	if a.json {
+		if wallpapers == nil {
+			wallpapers = []handlers.Wallpaper{}
+		}
+		return a.printJSON(wallpapers)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tSTATUS\tSIZE\tOWNER\tTAGS")
+	for _, wp := range wallpapers {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%dx%d\t%s\t%s\n",
+			wp.ID, wp.OriginalName, wp.Status, wp.Width, wp.Height, wp.Owner, strings.Join(wp.Tags, ","))
+	}
+	return tw.Flush()
+}
+
+// parses the wallpaper ids of the arguments
+func parseIDs(args []string) ([]int, error) {
+	if len(args) == 0 {
+		return nil, errors.New("missing wallpaper id")
+	}
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid id %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// the result of a command on one file or wallpaper, for the commands working on several
+type result struct {
+	Input     string              `json:"input"`
+	Wallpaper *handlers.Wallpaper `json:"wallpaper,omitempty"`
+	Error     string              `json:"error,omitempty"`
+}
+
+// prints the results and fails if one of them did
+func (a *app) printResults(results []result, done string) error {
+	failed := 0
+	for _, r := range results {
+		if r.Error != "" {
+			failed++
+		}
+	}
+	if a.json {
+		if err := a.printJSON(results); err != nil {
+			return err
+		}
+	} else {
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				fmt.Fprintf(a.out, "✗ %s: %s\n", r.Input, r.Error)
+			case r.Wallpaper != nil:
+				fmt.Fprintf(a.out, "✓ %s: %s #%d (%s)\n", r.Input, done, r.Wallpaper.ID, r.Wallpaper.Status)
+			default:
+				fmt.Fprintf(a.out, "✓ %s: %s\n", r.Input, done)
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d failed", failed, len(results))
+	}
+	return nil
+}
+
+func uploadCmd(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	tags := flags.String("tags", "", "comma separated tags, for every file")
+	description := flags.String("description", "", "description, for every file")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("upload: missing file or directory")
+	}
+
+	// the directories are walked, only the extensions the server accepts are sent
+	var files []string
+	for _, path := range flags.Args() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() && handlers.IsWallpaperFile(p) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var results []result
+	for _, path := range files {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		r := result{Input: path}
+		wp, err := uploadFile(ctx, a.client, path, *tags, *description)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Wallpaper = &wp
+		}
+		results = append(results, r)
+	}
+	return a.printResults(results, "uploaded")
+}
+
+func uploadFile(ctx context.Context, c *client.Client, path, tags, description string) (handlers.Wallpaper, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return handlers.Wallpaper{}, err
+	}
+	defer f.Close()
+	return c.UploadWallpaper(ctx, filepath.Base(path), f, tags, description)
+}
+
+func listCmd(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	scope := flags.String("scope", "", "mine (default), archive or public")
+	status := flags.String("status", "", "only this moderation status")
+	all := flags.Bool("all", false, "every page, not only the first one")
+	flags.Parse(args)
+
+	opts := client.ListOptions{Scope: *scope, Status: *status}
+	if *all {
+		wallpapers, err := a.client.AllWallpapers(ctx, opts)
+		if err != nil {
+			return err
+		}
+		return a.printWallpapers(wallpapers)
+	}
+
+	list, err := a.client.ListWallpapers(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(list)
+	}
+	if err := a.printWallpapers(list.Data); err != nil {
+		return err
+	}
+	if list.NextCursor != "" {
+		fmt.Fprintln(a.out, "(more with --all)")
+	}
+	return nil
+}
+
+func searchCmd(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	params := map[string]*string{}
+	for _, name := range []string{"tag", "uploader", "orientation", "color", "sort", "page"} {
+		params[name] = flags.String(name, "", name+" filter")
+	}
+	flags.Parse(args)
+
+	q := make(map[string][]string)
+	for name, value := range params {
+		if *value != "" {
+			q[name] = []string{*value}
+		}
+	}
+	if text := strings.Join(flags.Args(), " "); text != "" {
+		q["q"] = []string{text}
+	}
+	res, err := a.client.Search(ctx, q)
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(res)
+	}
+	if err := a.printWallpapers(res.Results); err != nil {
+		return err
+	}
+	if res.HasMore {
+		fmt.Fprintf(a.out, "(more with --page %d)\n", res.Page+1)
+	}
+	return nil
+}
+
+func downloadCollectionCmd(ctx context.Context, a *app, args []string) error {
+	flags := flag.NewFlagSet("download-collection", flag.ExitOnError)
+	out := flags.String("out", "", "directory, the collection name by default")
+	flags.Parse(args)
+	ids, err := parseIDs(flags.Args())
+	if err != nil || len(ids) != 1 {
+		return errors.New("download-collection: expected one collection id")
+	}
+
+	col, err := a.client.Collection(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	dir := *out
+	if dir == "" {
+		dir = safeName(col.Name)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	var results []result
+	for _, item := range col.Items {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// the stored name is unique, and the server made it safe
+		dst := filepath.Join(dir, filepath.Base(item.Filename))
+		r := result{Input: item.Filename}
+		if _, err := os.Stat(dst); err == nil {
+			results = append(results, r) // already there
+			continue
+		}
+		if err := download(ctx, a.client, item.Filename, dst); err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return a.printResults(results, "in "+dir)
+}
+
+// download writes the file through a temporary name, an interrupted download leaves nothing behind
+func download(ctx context.Context, c *client.Client, filename, dst string) error {
+	body, err := c.Download(ctx, filename)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), ".wpctl-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// a directory name from a collection name
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ".")
+	if name == "" {
+		return "collection"
+	}
+	return name
+}
+
+func publishCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	var results []result
+	for _, id := range ids {
+		r := result{Input: strconv.Itoa(id)}
+		wp, err := a.client.RequestPublication(ctx, id)
+		if err != nil {
+			r.Error = err.Error()
+		} else {
+			r.Wallpaper = &wp
+		}
+		results = append(results, r)
+	}
+	return a.printResults(results, "submitted")
+}
+
+func renameCmd(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 {
+		return errors.New("rename: expected an id and a name")
+	}
+	ids, err := parseIDs(args[:1])
+	if err != nil {
+		return err
+	}
+	wp, err := a.client.UpdateWallpaper(ctx, ids[0], handlers.WallpaperUpdate{OriginalName: &args[1]})
+	if err != nil {
+		return err
+	}
+	if a.json {
+		return a.printJSON(wp)
+	}
+	fmt.Fprintf(a.out, "✓ #%d renamed to %s\n", wp.ID, wp.OriginalName)
+	return nil
+}
+
+func deleteCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil {
+		return err
+	}
+	var results []result
+	for _, id := range ids {
+		r := result{Input: strconv.Itoa(id)}
+		if err := a.client.DeleteWallpaper(ctx, id); err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return a.printResults(results, "moved to the trash")
+}
+
+func commentsCmd(ctx context.Context, a *app, args []string) error {
+	ids, err := parseIDs(args)
+	if err != nil || len(ids) != 1 {
+		return errors.New("comments: expected one wallpaper id")
+	}
+	comments, err := a.client.Comments(ctx, ids[0])
+	if err != nil {
+		return err
+	}
+	if a.json {
+		if comments == nil {
+			comments = []handlers.Comment{}
+		}
+		return a.printJSON(comments)
+	}
+	tw := tabwriter.NewWriter(a.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tDATE\tUSER\tREPLY TO\tTEXT")
+	for _, c := range comments {
+		parent := ""
+		if c.ParentID != 0 {
+			parent = strconv.Itoa(c.ParentID)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n",
+			c.ID, c.CreatedAt.Format("2006-01-02 15:04"), c.Username, parent, strings.ReplaceAll(c.Text, "\n", " "))
+	}
+	return tw.Flush()
+}
@@ -17,21 +17,32 @@ func DeleteAccHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
 	userID := r.FormValue("user_id")
 	if userID == "" {
 		http.Error(w, "User ID missing", http.StatusBadRequest)
 		return
 	}
 
-	currentUserID, err := getUserIDFromSession(r)
-	if err != nil {
-		log.Println("Session error:", err)
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	if fmt.Sprintf("%d", admin.UserID) == userID {
+		http.Error(w, "You cannot delete yourself", http.StatusForbidden)
 		return
 	}
 
-	if fmt.Sprintf("%d", currentUserID) == userID {
-		http.Error(w, "You cannot delete yourself", http.StatusForbidden)
+	// snapshot for the audit log, the row is gone afterwards
+	var before struct {
+		Username string `json:"username"`
+		Email    string `json:"email"`
+		IsAdmin  bool   `json:"isadmin"`
+	}
+	err := db.QueryRow("SELECT username, email, isadmin FROM users WHERE id = ?", userID).
+		Scan(&before.Username, &before.Email, &before.IsAdmin)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
@@ -53,5 +64,6 @@ func DeleteAccHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("✅ User %s deleted by admin", userID)
+	audit(r, admin, AuditDeleteUser, AuditTargetUser, userID, before, nil)
 	http.Redirect(w, r, "/adminpanel", http.StatusSeeOther)
 }
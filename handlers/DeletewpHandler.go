@@ -3,30 +3,52 @@ package handlers
 import (
 	"log"
 	"net/http"
+	"strconv"
 )
 
+// DeletewpHandler moves a wallpaper to the trash (owner or admin), see TrashHandler
 func DeletewpHandler(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/wallpapers", http.StatusSeeOther)
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
 
-	userID, err := getUserIDFromSession(r)
-	if err != nil {
-		log.Println("Session error:", err)
+	user := getCurrentUser(r)
+	if user == nil {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	wallpaperID := r.FormValue("wallpaper_id")
-	if wallpaperID == "" {
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
 		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
 		return
 	}
 
-	//delete seleccted wp
-	_, err = db.Exec("DELETE FROM wallpapers WHERE id = ?", wallpaperID)
+	var ownerID int
+	var originalName, status string
+	err = db.QueryRow("SELECT user_id, original_name, status FROM wallpapers WHERE id = ? AND deleted_at IS NULL", wallpaperID).
+		Scan(&ownerID, &originalName, &status)
 	if err != nil {
-		log.Println("failed to delete..", err)
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	if ownerID != user.UserID && !user.IsAdmin {
+		log.Printf("⚠️ Unauthorized delete attempt: user %d on wallpaper owned by %d", user.UserID, ownerID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
 	}
 
-	log.Println("user", userID, "deleted a wp!")
+	if err := softDeleteWallpaper(wallpaperID, user.UserID); err != nil {
+		log.Println("Failed to delete wallpaper:", err)
+		http.Error(w, "Failed to delete wallpaper", http.StatusInternalServerError)
+		return
+	}
 
+	log.Printf("🗑️ Wallpaper %d moved to the trash by user %d", wallpaperID, user.UserID)
+	if ownerID != user.UserID {
+		audit(r, user, AuditDeleteWallpaper, AuditTargetWallpaper, wallpaperID,
+			map[string]interface{}{"owner_id": ownerID, "original_name": originalName, "status": status}, nil)
+	}
+	http.Redirect(w, r, redirectBack(r, "/wallpapers"), http.StatusSeeOther)
 }
@@ -16,17 +16,30 @@ func DemoteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
 	username := r.FormValue("username")
 	if username == "" {
 		http.Error(w, "Username missing", http.StatusBadRequest)
 		return
 	}
 
+	var userID int
+	var wasAdmin bool
+	err := db.QueryRow("SELECT id, isadmin FROM users WHERE username = ?", username).Scan(&userID, &wasAdmin)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
 	result, err := db.Exec(`
 		UPDATE users
 		SET isadmin = 0
-		WHERE username = ?
-	`, username)
+		WHERE id = ?
+	`, userID)
 
 	if err != nil {
 		log.Println("Database error:", err)
@@ -41,5 +54,8 @@ func DemoteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("User %s demoted by admin", username)
+	audit(r, admin, AuditDemote, AuditTargetUser, userID,
+		map[string]interface{}{"username": username, "isadmin": wasAdmin},
+		map[string]interface{}{"username": username, "isadmin": false})
 	http.Redirect(w, r, "/adminpanel", http.StatusSeeOther)
 }
@@ -18,18 +18,31 @@ func PromoteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
 	username := r.FormValue("username")
 	if username == "" {
 		http.Error(w, "Username missing", http.StatusBadRequest)
 		return
 	}
 
+	var userID int
+	var wasAdmin bool
+	err := db.QueryRow("SELECT id, isadmin FROM users WHERE username = ?", username).Scan(&userID, &wasAdmin)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
 	// Execute update
 	result, err := db.Exec(`
 		UPDATE users
 		SET isadmin = 1
-		WHERE username = ?
-	`, username)
+		WHERE id = ?
+	`, userID)
 
 	if err != nil {
 		log.Println("Database error:", err)
@@ -44,6 +57,9 @@ func PromoteUserHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("✅ User %s promoted to admin", username)
+	audit(r, admin, AuditPromote, AuditTargetUser, userID,
+		map[string]interface{}{"username": username, "isadmin": wasAdmin},
+		map[string]interface{}{"username": username, "isadmin": true})
 	// Redirect back to admin panel
 	http.Redirect(w, r, "/adminpanel", http.StatusSeeOther)
 }
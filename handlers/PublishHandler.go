@@ -1,87 +1,30 @@
 package handlers
 
 import (
-	"database/sql"
-	"log"
 	"net/http"
+	"time"
 )
 
+// PublishHandler approves a pending wallpaper (admin). With a publish_at in the future
+// it's scheduled instead and the scheduler makes it public at that time.
 func PublishHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	log.Println("TogglePublishHandler called")
-
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
-		return
-	}
-
-	wallpaperID := r.FormValue("wallpaper_id")
-	if wallpaperID == "" {
-		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
-		return
-	}
-
-	// Get userid
-	userID, err := getUserIDFromSession(r)
-	if err != nil {
-		log.Println("Session error:", err)
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	// check if wallpaper is owned by user + get current ispublic status
-	var ownerID int
-	var isPublic bool
-	err = db.QueryRow("SELECT user_id, COALESCE(ispublic, 0) FROM wallpapers WHERE id = ?", wallpaperID).
-		Scan(&ownerID, &isPublic)
-	if err != nil {
-		log.Println("Wallpaper not found:", err)
-		http.Error(w, "Wallpaper not found", http.StatusNotFound)
-		return
-	}
-
-	user := getCurrentUser(r)
-	isAdmin := user != nil && user.IsAdmin
-
-	if !isAdmin && ownerID != userID {
-		log.Printf("⚠️ Unauthorized toggle attempt: user %d tried to toggle wallpaper owned by %d", userID, ownerID)
-		http.Error(w, "Unauthorized", http.StatusForbidden)
-		return
-	}
-
-	// Toggle the ispublic status
-	var result sql.Result
-	if isPublic {
-		// if public > make it private
-		result, err = db.Exec("UPDATE wallpapers SET ispublic = 0 WHERE id = ?", wallpaperID)
-		if err != nil {
-			log.Println("Failed to unpublish wallpaper:", err)
-			http.Error(w, "Failed to unpublish wallpaper", http.StatusInternalServerError)
+	var publishAt *time.Time
+	if r.Method == http.MethodPost && r.FormValue("publish_at") != "" {
+		admin := requireAdmin(w, r)
+		if admin == nil {
 			return
 		}
-
-		log.Printf("Wallpaper %s unpublished by user %d", wallpaperID, userID)
-	} else {
-		// if private > make it public
-		result, err = db.Exec("UPDATE wallpapers SET ispublic = 1, toreview = 0 WHERE id = ?", wallpaperID)
+		var err error
+		publishAt, err = parseScheduleTime(r.FormValue("publish_at"))
 		if err != nil {
-			log.Println("Failed to publish wallpaper:", err)
-			http.Error(w, "Failed to publish wallpaper", http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if publishAt != nil && !publishAt.After(time.Now()) {
+			http.Error(w, errScheduleInPast.Error(), http.StatusBadRequest)
 			return
 		}
-		log.Printf("Wallpaper %s published by user %d", wallpaperID, userID)
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil || rows == 0 {
-		http.Error(w, "Wallpaper not found", http.StatusNotFound)
-		return
 	}
 
-	http.Redirect(w, r, "/adminpanel", http.StatusSeeOther)
+	moderate(w, r, func(string) string { return StatusApproved }, publishAt, "/adminpanel")
 }
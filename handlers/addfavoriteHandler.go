@@ -5,7 +5,58 @@ import (
 	"net/http"
 )
 
+// AddfavoriteHandler toggles a wallpaper in the user's favorites
 func AddfavoriteHandler(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/wallpapers", http.StatusSeeOther)
-	log.Println("you better finish this feature bib.... (favorite..)")
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID := r.FormValue("wallpaper_id")
+	if wallpaperID == "" {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID, id int
+	err = db.QueryRow("SELECT id, user_id FROM wallpapers WHERE id = ? AND deleted_at IS NULL", wallpaperID).Scan(&id, &ownerID)
+	if err != nil {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	if visible, err := canViewWallpaper(r, id); err != nil || !visible {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+
+	// already a favorite > remove it
+	result, err := db.Exec("DELETE FROM favorites WHERE user_id = ? AND wallpaper_id = ?", userID, id)
+	if err != nil {
+		log.Println("Failed to remove favorite:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		_, err = db.Exec("INSERT INTO favorites (user_id, wallpaper_id) VALUES (?, ?)", userID, id)
+		if err != nil {
+			log.Println("Failed to add favorite:", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("User %d favorited wallpaper %d", userID, id)
+		notify(ownerID, userID, NotifFavorite, id, getUsername(userID)+" added your wallpaper to their favorites")
+		evaluateBadges(BadgeEventFavorite, ownerID)
+	} else {
+		log.Printf("User %d removed wallpaper %d from favorites", userID, id)
+	}
+
+	http.Redirect(w, r, redirectBack(r, "/wallpapers"), http.StatusSeeOther)
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
 )
@@ -26,31 +27,21 @@ func AdminpannelHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rows, err := db.Query(`
-        SELECT id, filename, original_name, uploaded_at, ispublic, toreview, user_id
-        FROM wallpapers 
-        WHERE toreview = 1
-        ORDER BY uploaded_at DESC
-    `)
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
 	if err != nil {
-		log.Println("Failed to query wallpapers:", err)
-		http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	defer rows.Close()
 
-	var wallpapers []Wallpaper
-	for rows.Next() {
-		var w Wallpaper
-		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.IsPublic, &w.ToReview, &w.UserID); err != nil {
-			log.Println("Row scan error:", err)
-			continue
-		}
-		wallpapers = append(wallpapers, w)
+	wallpapers, next, err := reviewPage(cursor, galleryPageSize)
+	if err != nil {
+		log.Println("Failed to query wallpapers:", err)
+		http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
+		return
 	}
 
 	// get all users from db
-	rows, err = db.Query("SELECT id, username, email, name, surname, isadmin FROM users ORDER BY username")
+	rows, err := db.Query("SELECT id, username, email, name, surname, isadmin FROM users ORDER BY username")
 	if err != nil {
 		log.Println("Failed to query users:", err)
 		http.Error(w, "Failed to load users", http.StatusInternalServerError)
@@ -68,11 +59,26 @@ func AdminpannelHandler(w http.ResponseWriter, r *http.Request) {
 		allUsers = append(allUsers, u)
 	}
 
+	// badges of every user + the catalogue for the grant form
+	userBadges, err := badgesByUser()
+	if err != nil {
+		log.Println("Failed to query badges:", err)
+	}
+	for i := range allUsers {
+		allUsers[i].Badges = userBadges[allUsers[i].UserID]
+	}
+	catalogue, err := listBadges()
+	if err != nil {
+		log.Println("Failed to query badges:", err)
+	}
+
 	// Prepare data for template
 	data := AdminPanelData{
 		CurrentUser: user,
 		AllUsers:    allUsers,
 		Wallpapers:  wallpapers,
+		NextCursor:  next,
+		Badges:      catalogue,
 	}
 
 	if err := templates.ExecuteTemplate(w, "adminpannel.html", data); err != nil {
@@ -80,3 +86,15 @@ func AdminpannelHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
+
+// reviewPage loads a page of the wallpapers waiting for review
+func reviewPage(cursor *Cursor, limit int) ([]Wallpaper, string, error) {
+	return pageWallpapers(`
+		SELECT w.id, w.filename, w.original_name, w.uploaded_at, w.status, w.user_id, w.publish_at
+		FROM wallpapers w
+		WHERE w.status = 'pending' AND w.deleted_at IS NULL`, nil, cursor, limit, func(rows *sql.Rows) (Wallpaper, error) {
+		var w Wallpaper
+		err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.Status, &w.UserID, &w.PublishAt)
+		return w, err
+	})
+}
@@ -0,0 +1,114 @@
+// / this file contains the archive: wallpapers hidden from the galleries and listings without being deleted
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archive actions of the /archive form
+const (
+	ArchiveAdd    = "archive"
+	ArchiveRemove = "unarchive"
+)
+
+// setArchived archives or unarchives some of the user's wallpapers, the others are ignored.
+// Comments, ratings, favorites and the moderation state are kept, unarchiving puts it back as it was.
+func setArchived(userID int, wallpaperIDs []int, archived bool) (int64, error) {
+	if len(wallpaperIDs) == 0 {
+		return 0, nil
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(wallpaperIDs)), ", ")
+	args := []interface{}{archived, time.Now(), userID}
+	for _, id := range wallpaperIDs {
+		args = append(args, id)
+	}
+
+	result, err := db.Exec(`
+		UPDATE wallpapers SET archived_at = IF(?, COALESCE(archived_at, ?), NULL)
+		WHERE user_id = ? AND deleted_at IS NULL AND id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// ArchiveHandler shows the user's archived wallpapers (GET), and archives or unarchives
+// the selected ones (POST action=archive|unarchive, wallpaper_id repeated)
+// URL format: /archive?cursor=...
+func ArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		data, err := myWallpapersPage(user, cursor, galleryPageSize, true)
+		if err != nil {
+			log.Println("Failed to query the archive:", err)
+			http.Error(w, "Failed to load the archive", http.StatusInternalServerError)
+			return
+		}
+
+		if err := templates.ExecuteTemplate(w, "wallpapers.html", data); err != nil {
+			log.Println("Template error:", err)
+			http.Error(w, "Template error", http.StatusInternalServerError)
+		}
+
+	case http.MethodPost:
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+		action := r.FormValue("action")
+		if action != ArchiveAdd && action != ArchiveRemove {
+			http.Error(w, "action must be archive or unarchive", http.StatusBadRequest)
+			return
+		}
+
+		values := r.Form["wallpaper_id"]
+		if len(values) == 0 {
+			http.Error(w, "No wallpapers selected", http.StatusBadRequest)
+			return
+		}
+		if len(values) > maxBulkItems {
+			http.Error(w, fmt.Sprintf("Too many wallpapers (max %d)", maxBulkItems), http.StatusBadRequest)
+			return
+		}
+		ids := make([]int, 0, len(values))
+		for _, v := range values {
+			id, err := strconv.Atoi(v)
+			if err != nil {
+				http.Error(w, "Invalid wallpaper ID", http.StatusBadRequest)
+				return
+			}
+			ids = append(ids, id)
+		}
+
+		n, err := setArchived(user.UserID, ids, action == ArchiveAdd)
+		if err != nil {
+			log.Println("Failed to update the archive:", err)
+			http.Error(w, "Failed to update the archive", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("📦 %s: %d wallpapers by user %d", action, n, user.UserID)
+		http.Redirect(w, r, redirectBack(r, "/wallpapers"), http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
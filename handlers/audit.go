@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// audited actions (audit_log.action)
+const (
+	AuditPromote          = "user.promote"
+	AuditDemote           = "user.demote"
+	AuditDeleteUser       = "user.delete"
+	AuditStorageLimit     = "user.storage_limit"
+	AuditGrantBadge       = "badge.grant"
+	AuditRevokeBadge      = "badge.revoke"
+	AuditMergeTags        = "tag.merge"
+	AuditDeleteTag        = "tag.delete"
+	AuditEditTags         = "wallpaper.tags"
+	AuditDeleteWallpaper  = "wallpaper.delete"
+	AuditSchedule         = "wallpaper.schedule"
+	AuditRestoreWallpaper = "wallpaper.restore"
+	AuditPurgeWallpaper   = "wallpaper.purge"
+	AuditCreateWebhook    = "webhook.create"
+	AuditDeleteWebhook    = "webhook.delete"
+	AuditModeratePrefix   = "wallpaper." // + the new status, e.g. wallpaper.approved
+)
+
+// audited targets (audit_log.target_type)
+const (
+	AuditTargetUser      = "user"
+	AuditTargetWallpaper = "wallpaper"
+	AuditTargetTag       = "tag"
+	AuditTargetWebhook   = "webhook"
+)
+
+const (
+	auditPageSize      = 50
+	maxAuditExportRows = 100000
+)
+
+// AuditActions is the list shown in the filter of the audit page
+var AuditActions = []string{
+	AuditPromote, AuditDemote, AuditDeleteUser, AuditStorageLimit,
+	AuditGrantBadge, AuditRevokeBadge,
+	AuditMergeTags, AuditDeleteTag, AuditEditTags, AuditDeleteWallpaper, AuditRestoreWallpaper, AuditPurgeWallpaper, AuditSchedule,
+	AuditCreateWebhook, AuditDeleteWebhook,
+	AuditModeratePrefix + StatusApproved, AuditModeratePrefix + StatusScheduled,
+	AuditModeratePrefix + StatusRejected, AuditModeratePrefix + StatusUnpublished,
+}
+
+// AuditTargets is the list shown in the target filter
+var AuditTargets = []string{AuditTargetUser, AuditTargetWallpaper, AuditTargetTag, AuditTargetWebhook}
+
+// one row of audit_log, Before/After are JSON snapshots of what changed
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	ActorID    int       `json:"actor_id,omitempty"`
+	Actor      string    `json:"actor"`
+	Action     string    `json:"action"`
+	TargetType string    `json:"target_type"`
+	TargetID   string    `json:"target_id"`
+	Before     string    `json:"before,omitempty"`
+	After      string    `json:"after,omitempty"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// audit appends a privileged action to the audit log. The table is append-only:
+// nothing in the app updates or deletes its rows. A failure is logged, the action itself
+// already happened.
+func audit(r *http.Request, actor *UserProfile, action, targetType string, targetID interface{}, before, after interface{}) {
+	_, err := db.Exec(`
+		INSERT INTO audit_log (actor_id, actor_name, action, target_type, target_id, before_state, after_state, ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`, actor.UserID, actor.Username, action, targetType, fmt.Sprint(targetID),
+		auditJSON(before), auditJSON(after), clientIP(r))
+	if err != nil {
+		log.Printf("Failed to write the audit log (%s by %s on %s %v): %v", action, actor.Username, targetType, targetID, err)
+	}
+}
+
+// marshals a snapshot, nil is stored as NULL
+func auditJSON(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Failed to encode audit snapshot:", err)
+		return nil
+	}
+	return string(b)
+}
+
+// the address of the client, without the port. X-Forwarded-For is ignored,
+// the app is served directly and the header would let anyone pick their IP.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// AuditFilter are the filters of the audit page, all optional
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time
+	To         time.Time // inclusive day
+}
+
+func parseAuditFilter(r *http.Request) (AuditFilter, error) {
+	q := r.URL.Query()
+	f := AuditFilter{
+		Actor:      strings.TrimSpace(q.Get("actor")),
+		Action:     q.Get("action"),
+		TargetType: q.Get("target_type"),
+		TargetID:   strings.TrimSpace(q.Get("target_id")),
+	}
+	for name, dst := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(searchDate, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s date, expected YYYY-MM-DD", name)
+			}
+			*dst = t
+		}
+	}
+	return f, nil
+}
+
+// returns the SQL condition (audit_log aliased as a) + args for the filter
+func (f AuditFilter) where() (string, []interface{}) {
+	conds := []string{"1 = 1"}
+	var args []interface{}
+	if f.Actor != "" {
+		conds = append(conds, "a.actor_name = ?")
+		args = append(args, f.Actor)
+	}
+	if f.Action != "" {
+		conds = append(conds, "a.action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "a.target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		conds = append(conds, "a.target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "a.created_at >= ?")
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "a.created_at < ?")
+		args = append(args, f.To.AddDate(0, 0, 1))
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// the link to path with the filter, for the pagination and export links
+func (f AuditFilter) URL(path, cursor string) string {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" {
+			values.Set(key, value)
+		}
+	}
+	set("actor", f.Actor)
+	set("action", f.Action)
+	set("target_type", f.TargetType)
+	set("target_id", f.TargetID)
+	set("from", formatSearchDate(f.From))
+	set("to", formatSearchDate(f.To))
+	set("cursor", cursor)
+	if len(values) == 0 {
+		return path
+	}
+	return path + "?" + values.Encode()
+}
+
+func (f AuditFilter) FromDate() string { return formatSearchDate(f.From) }
+func (f AuditFilter) ToDate() string   { return formatSearchDate(f.To) }
+
+// queryAudit returns a page of the entries matching the filter, newest first
+func queryAudit(f AuditFilter, cursor *Cursor, limit int) ([]AuditEntry, string, error) {
+	cond, args := f.where()
+	after, afterArgs := cursor.where("a.created_at", "a.id")
+	args = append(args, afterArgs...)
+
+	rows, err := db.Query(`
+		SELECT a.id, COALESCE(a.actor_id, 0), a.actor_name, a.action, a.target_type, a.target_id,
+			a.before_state, a.after_state, a.ip, a.created_at
+		FROM audit_log a
+		WHERE `+cond+` AND `+after+`
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ?`, append(args, limit+1)...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	next := ""
+	for rows.Next() {
+		var e AuditEntry
+		var beforeState, afterState sql.NullString
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.Actor, &e.Action, &e.TargetType, &e.TargetID,
+			&beforeState, &afterState, &e.IP, &e.CreatedAt); err != nil {
+			return nil, "", err
+		}
+		e.Before, e.After = beforeState.String, afterState.String
+		if len(entries) == limit {
+			last := entries[len(entries)-1]
+			next = Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, next, rows.Err()
+}
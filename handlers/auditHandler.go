@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AuditPageData struct {
+	CurrentUser *UserProfile
+	Entries     []AuditEntry
+	Filter      AuditFilter
+	Actions     []string
+	Targets     []string
+	NextCursor  string
+	Error       string
+}
+
+// AuditHandler shows the audit log of the privileged actions, filterable
+// URL format: /admin/audit?actor=&action=&target_type=&target_id=&from=&to=&cursor=
+func AuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
+	data := AuditPageData{CurrentUser: admin, Actions: AuditActions, Targets: AuditTargets}
+	filter, err := parseAuditFilter(r)
+	data.Filter = filter
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data.Entries, data.NextCursor, err = queryAudit(filter, cursor, auditPageSize)
+		if err != nil {
+			log.Println("Failed to query the audit log:", err)
+			http.Error(w, "Failed to load the audit log", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := templates.ExecuteTemplate(w, "audit.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// AuditExportHandler downloads the filtered audit log as CSV
+// URL format: /admin/audit.csv?<same filters as /admin/audit>
+func AuditExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
+	filter, err := parseAuditFilter(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, next, err := queryAudit(filter, nil, maxAuditExportRows)
+	if err != nil {
+		log.Println("Failed to query the audit log:", err)
+		http.Error(w, "Failed to load the audit log", http.StatusInternalServerError)
+		return
+	}
+	if next != "" {
+		log.Printf("Audit export by %s truncated to %d rows", admin.Username, maxAuditExportRows)
+	}
+
+	filename := "audit-" + time.Now().Format("20060102-150405") + ".csv"
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	out := csv.NewWriter(w)
+	out.Write([]string{"id", "created_at", "actor_id", "actor", "action", "target_type", "target_id", "before", "after", "ip"})
+	for _, e := range entries {
+		out.Write([]string{
+			strconv.Itoa(e.ID),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.Itoa(e.ActorID),
+			csvSafe(e.Actor),
+			e.Action,
+			e.TargetType,
+			csvSafe(e.TargetID),
+			csvSafe(e.Before),
+			csvSafe(e.After),
+			e.IP,
+		})
+	}
+	out.Flush()
+	if err := out.Error(); err != nil {
+		log.Println("Failed to write the audit export:", err)
+	}
+}
+
+// prefixes values a spreadsheet would run as a formula (=, +, -, @)
+func csvSafe(s string) string {
+	if s != "" && (s[0] == '=' || s[0] == '+' || s[0] == '-' || s[0] == '@') {
+		return "'" + s
+	}
+	return s
+}
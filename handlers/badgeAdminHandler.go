@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// GrantBadgeHandler lets an admin give any badge of the catalogue to a user
+func GrantBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	admin, userID, code, ok := badgeAdminForm(w, r)
+	if !ok {
+		return
+	}
+
+	awardBadge(userID, code, admin.UserID)
+	log.Printf("Badge %s granted to user %d by admin %s", code, userID, admin.Username)
+	audit(r, admin, AuditGrantBadge, AuditTargetUser, userID, nil, map[string]string{"badge": code})
+	http.Redirect(w, r, "/adminpanel", http.StatusSeeOther)
+}
+
+// RevokeBadgeHandler lets an admin remove a badge from a user
+func RevokeBadgeHandler(w http.ResponseWriter, r *http.Request) {
+	admin, userID, code, ok := badgeAdminForm(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec("DELETE FROM user_badges WHERE user_id = ? AND badge_code = ?", userID, code)
+	if err != nil {
+		log.Println("Database error:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Badge %s revoked from user %d by admin %s", code, userID, admin.Username)
+	audit(r, admin, AuditRevokeBadge, AuditTargetUser, userID, map[string]string{"badge": code}, nil)
+	http.Redirect(w, r, "/adminpanel", http.StatusSeeOther)
+}
+
+// checks method + admin and reads user_id / badge_code from the form
+func badgeAdminForm(w http.ResponseWriter, r *http.Request) (admin *UserProfile, userID int, code string, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil, 0, "", false
+	}
+
+	admin = requireAdmin(w, r)
+	if admin == nil {
+		return nil, 0, "", false
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "User ID missing", http.StatusBadRequest)
+		return nil, 0, "", false
+	}
+
+	code = r.FormValue("badge_code")
+	var exists bool
+	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM badges WHERE code = ?)", code).Scan(&exists)
+	if err != nil || !exists {
+		http.Error(w, "Unknown badge", http.StatusBadRequest)
+		return nil, 0, "", false
+	}
+
+	return admin, userID, code, true
+}
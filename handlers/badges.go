@@ -0,0 +1,240 @@
+// / this file contains the badge catalogue and the rules engine that awards them on events
+package handlers
+
+import (
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+type Badge struct {
+	Code        string    `json:"code"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Icon        string    `json:"icon"`
+	AwardedAt   time.Time `json:"awarded_at,omitzero"`
+}
+
+// events the rules are evaluated on
+const (
+	BadgeEventUpload   = "upload"
+	BadgeEventPublish  = "publish"
+	BadgeEventFavorite = "favorite" // for the owner of the favorited wallpaper
+	BadgeEventComment  = "comment"
+)
+
+// badgeCatalogue is synced into the badges table on startup
+var badgeCatalogue = []Badge{
+	{Code: "first_upload", Name: "First steps", Description: "Uploaded a first wallpaper", Icon: "🌱"},
+	{Code: "ten_public", Name: "Exhibitor", Description: "10 public wallpapers", Icon: "🖼"},
+	{Code: "hundred_favorites", Name: "Crowd pleaser", Description: "Received 100 favorites", Icon: "💖"},
+	{Code: "wallpaper_of_month", Name: "Wallpaper of the month", Description: "Most favorited wallpaper of a month", Icon: "🏆"},
+	{Code: "top_commenter", Name: "Chatterbox", Description: "Top commenter of the last 30 days", Icon: "💬"},
+	{Code: "staff_pick", Name: "Staff pick", Description: "Handpicked by the admins", Icon: "✨"},
+}
+
+type badgeRule struct {
+	Code   string
+	Events []string
+	Check  func(userID int) (bool, error)
+}
+
+// badges without a rule (staff_pick) can only be granted by an admin
+var badgeRules = []badgeRule{
+	{
+		Code:   "first_upload",
+		Events: []string{BadgeEventUpload},
+		Check: func(userID int) (bool, error) {
+			return countAtLeast(1, "SELECT COUNT(*) FROM wallpapers WHERE user_id = ?", userID)
+		},
+	},
+	{
+		Code:   "ten_public",
+		Events: []string{BadgeEventPublish},
+		Check: func(userID int) (bool, error) {
+			return countAtLeast(10, "SELECT COUNT(*) FROM wallpapers WHERE user_id = ? AND status = 'approved' AND deleted_at IS NULL", userID)
+		},
+	},
+	{
+		Code:   "hundred_favorites",
+		Events: []string{BadgeEventFavorite},
+		Check: func(userID int) (bool, error) {
+			return countAtLeast(100, `
+				SELECT COUNT(*) FROM favorites f
+				JOIN wallpapers w ON w.id = f.wallpaper_id
+				WHERE w.user_id = ?
+			`, userID)
+		},
+	},
+	{
+		Code:   "wallpaper_of_month",
+		Events: []string{BadgeEventFavorite},
+		Check: func(userID int) (bool, error) {
+			// owner of the public wallpaper with the most favorites this month (at least 5)
+			var winnerID int
+			err := db.QueryRow(`
+				SELECT w.user_id FROM favorites f
+				JOIN wallpapers w ON w.id = f.wallpaper_id
+				WHERE w.status = 'approved' AND f.created_at >= DATE_FORMAT(NOW(), '%Y-%m-01')
+				GROUP BY w.id, w.user_id
+				HAVING COUNT(*) >= 5
+				ORDER BY COUNT(*) DESC, MIN(f.created_at) ASC
+				LIMIT 1
+			`).Scan(&winnerID)
+			if err != nil {
+				return false, ignoreNoRows(err)
+			}
+			return winnerID == userID, nil
+		},
+	},
+	{
+		Code:   "top_commenter",
+		Events: []string{BadgeEventComment},
+		Check: func(userID int) (bool, error) {
+			// most comments over the last 30 days (at least 10)
+			var topID int
+			err := db.QueryRow(`
+				SELECT user_id FROM comments
+				WHERE created_at >= NOW() - INTERVAL 30 DAY
+				GROUP BY user_id
+				HAVING COUNT(*) >= 10
+				ORDER BY COUNT(*) DESC, MIN(created_at) ASC
+				LIMIT 1
+			`).Scan(&topID)
+			if err != nil {
+				return false, ignoreNoRows(err)
+			}
+			return topID == userID, nil
+		},
+	},
+}
+
+// SyncBadgeCatalogue upserts the catalogue into the badges table, called on startup
+func SyncBadgeCatalogue() error {
+	for _, b := range badgeCatalogue {
+		_, err := db.Exec(`
+			INSERT INTO badges (code, name, description, icon)
+			VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE name = VALUES(name), description = VALUES(description), icon = VALUES(icon)
+		`, b.Code, b.Name, b.Description, b.Icon)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// evaluateBadges runs every rule listening to event for userID and awards the ones that pass
+func evaluateBadges(event string, userID int) {
+	if userID == 0 {
+		return
+	}
+
+	for _, rule := range badgeRules {
+		if !slices.Contains(rule.Events, event) || hasBadge(userID, rule.Code) {
+			continue
+		}
+
+		ok, err := rule.Check(userID)
+		if err != nil {
+			log.Printf("Badge rule %s failed: %v", rule.Code, err)
+			continue
+		}
+		if ok {
+			awardBadge(userID, rule.Code, 0)
+		}
+	}
+}
+
+// awardBadge gives a badge, grantedBy is the admin id or 0 for the rules engine
+func awardBadge(userID int, code string, grantedBy int) bool {
+	var granter interface{}
+	if grantedBy != 0 {
+		granter = grantedBy
+	}
+
+	result, err := db.Exec("INSERT IGNORE INTO user_badges (user_id, badge_code, granted_by) VALUES (?, ?, ?)", userID, code, granter)
+	if err != nil {
+		log.Println("Failed to award badge:", err)
+		return false
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return false
+	}
+
+	log.Printf("🏅 Badge %s awarded to user %d", code, userID)
+	for _, b := range badgeCatalogue {
+		if b.Code == code {
+			notify(userID, 0, NotifBadge, 0, "You earned the badge "+b.Icon+" "+b.Name+"!")
+			break
+		}
+	}
+	return true
+}
+
+func hasBadge(userID int, code string) bool {
+	var has bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM user_badges WHERE user_id = ? AND badge_code = ?)", userID, code).Scan(&has)
+	return err == nil && has
+}
+
+// returns every badge of the catalogue
+func listBadges() ([]Badge, error) {
+	rows, err := db.Query("SELECT code, name, description, icon FROM badges ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var badges []Badge
+	for rows.Next() {
+		var b Badge
+		if err := rows.Scan(&b.Code, &b.Name, &b.Description, &b.Icon); err != nil {
+			return nil, err
+		}
+		badges = append(badges, b)
+	}
+	return badges, rows.Err()
+}
+
+// returns user id -> badges, for the given users (all users if none given)
+func badgesByUser(userIDs ...int) (map[int][]Badge, error) {
+	query := `
+		SELECT ub.user_id, b.code, b.name, b.description, b.icon, ub.awarded_at
+		FROM user_badges ub
+		JOIN badges b ON b.code = ub.badge_code`
+	var args []interface{}
+	if len(userIDs) > 0 {
+		query += " WHERE ub.user_id IN (?" + strings.Repeat(", ?", len(userIDs)-1) + ")"
+		for _, id := range userIDs {
+			args = append(args, id)
+		}
+	}
+	query += " ORDER BY ub.awarded_at"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	badges := make(map[int][]Badge)
+	for rows.Next() {
+		var userID int
+		var b Badge
+		if err := rows.Scan(&userID, &b.Code, &b.Name, &b.Description, &b.Icon, &b.AwardedAt); err != nil {
+			return nil, err
+		}
+		badges[userID] = append(badges[userID], b)
+	}
+	return badges, rows.Err()
+}
+
+func countAtLeast(n int, query string, args ...interface{}) (bool, error) {
+	var count int
+	if err := db.QueryRow(query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count >= n, nil
+}
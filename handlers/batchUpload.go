@@ -0,0 +1,226 @@
+// / this file contains the batch uploads of the upload form: several files and ZIP archives
+// / in one request, each wallpaper going through storeWallpaper, with a report per file
+package handlers
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"path"
+	"strings"
+)
+
+const (
+	maxBatchRequestSize = 500 << 20 // the whole form
+	maxBatchFiles       = 100       // wallpapers per request, the ZIP entries included
+	maxZipEntrySize     = 50 << 20  // uncompressed, per wallpaper
+	maxZipTotalSize     = 1 << 30   // uncompressed, per archive
+	maxZipRatio         = 100       // uncompressed / compressed, past 1 MB
+)
+
+var (
+	errZipInvalid        = errors.New("not a valid ZIP archive")
+	errZipUnsafePath     = errors.New("unsafe path in the archive")
+	errZipEntryTooBig    = fmt.Errorf("file too large once extracted (max %d MB)", maxZipEntrySize>>20)
+	errZipTotalTooBig    = fmt.Errorf("archive too large once extracted (max %d MB)", maxZipTotalSize>>20)
+	errZipRatio          = errors.New("compressed too much to be a wallpaper, skipped")
+	errBatchTooManyFiles = fmt.Errorf("too many files, only the first %d are uploaded", maxBatchFiles)
+)
+
+// UploadResult is the outcome of one file of a batch
+type UploadResult struct {
+	Name        string `json:"name"` // the file, archive.zip/entry.png for the ZIP entries
+	WallpaperID int    `json:"wallpaper_id,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// UploadReport sums up a batch upload
+type UploadReport struct {
+	Results      []UploadResult `json:"results"`
+	Uploaded     int            `json:"uploaded"`
+	Failed       int            `json:"failed"`
+	CollectionID int            `json:"collection_id,omitempty"` // the new collection holding the batch
+}
+
+func (rep *UploadReport) add(name string, wallpaperID int, err error) {
+	res := UploadResult{Name: name, WallpaperID: wallpaperID}
+	if err != nil {
+		res.Error = uploadErrorMessage(err)
+		rep.Failed++
+	} else {
+		rep.Uploaded++
+	}
+	rep.Results = append(rep.Results, res)
+}
+
+// the reason shown to the user, the internal errors are only logged
+func uploadErrorMessage(err error) string {
+	if errors.Is(err, errQuotaExceeded) {
+		return err.Error() // with the usage
+	}
+	for _, known := range []error{errInvalidFileType, errFilenameTooLong, errDescriptionTooLong, errImageTooLarge, errZipInvalid,
+		errZipUnsafePath, errZipEntryTooBig, errZipTotalTooBig, errZipRatio, errBatchTooManyFiles} {
+		if errors.Is(err, known) {
+			return known.Error()
+		}
+	}
+	log.Println("Batch upload error:", err)
+	return "failed to save the file"
+}
+
+func isZipFile(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".zip")
+}
+
+// storeBatch stores the files of the form, the ZIP archives entry by entry, and puts what
+// was stored into a new private collection when collectionName is set
+func storeBatch(userID int, files []*multipart.FileHeader, description string, tags []string, collectionName string) (UploadReport, error) {
+	var rep UploadReport
+	var ids []int
+	budget := maxBatchFiles
+
+	fail := func(name string, err error) { rep.add(name, 0, err) }
+	store := func(name, originalName string, src io.Reader) {
+		if budget == 0 {
+			fail(name, errBatchTooManyFiles)
+			return
+		}
+		budget--
+		id, err := storeWallpaper(userID, originalName, src, description, tags)
+		if err == nil {
+			ids = append(ids, id)
+		}
+		rep.add(name, id, err)
+	}
+
+	for _, fh := range files {
+		f, err := fh.Open()
+		if err != nil {
+			fail(fh.Filename, err)
+			continue
+		}
+		if isZipFile(fh.Filename) {
+			if err := storeZip(fh.Filename, f, fh.Size, store, fail); err != nil {
+				fail(fh.Filename, err)
+			}
+		} else {
+			store(fh.Filename, fh.Filename, f)
+		}
+		f.Close()
+	}
+
+	if collectionName != "" && len(ids) > 0 {
+		id, err := createCollection(userID, collectionName, "", CollectionPrivate)
+		if err != nil {
+			return rep, err
+		}
+		c := Collection{ID: id, UserID: userID}
+		for _, wallpaperID := range ids {
+			if err := addToCollection(c, wallpaperID); err != nil {
+				return rep, err
+			}
+		}
+		rep.CollectionID = id
+		log.Printf("📚 Collection %d created by user %d for a batch of %d", id, userID, len(ids))
+	}
+	return rep, nil
+}
+
+// storeZip passes the wallpapers of an archive to store. Nothing is extracted to the disk
+// under the entry names (storeWallpaper names the files), the unsafe names are refused anyway,
+// and the sizes are counted on the bytes actually read, not on what the headers claim.
+func storeZip(archiveName string, f multipart.File, size int64,
+	store func(name, originalName string, src io.Reader), fail func(name string, err error)) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return errZipInvalid
+	}
+
+	total := &zipBudget{left: maxZipTotalSize}
+	for _, entry := range zr.File {
+		name := archiveName + "/" + entry.Name
+		if entry.FileInfo().IsDir() || skippedZipEntry(entry.Name) {
+			continue
+		}
+		if !safeZipPath(entry.Name) {
+			fail(name, errZipUnsafePath)
+			continue
+		}
+		if !IsWallpaperFile(entry.Name) {
+			continue // the readme, the thumbs.db...
+		}
+		if entry.UncompressedSize64 > maxZipEntrySize {
+			fail(name, errZipEntryTooBig)
+			continue
+		}
+		if entry.UncompressedSize64 > 1<<20 && entry.UncompressedSize64 > maxZipRatio*entry.CompressedSize64 {
+			fail(name, errZipRatio)
+			continue
+		}
+
+		rc, err := entry.Open()
+		if err != nil {
+			fail(name, errZipInvalid)
+			continue
+		}
+		src := &zipEntryReader{r: rc, left: maxZipEntrySize, compressed: int64(entry.CompressedSize64), total: total}
+		store(name, path.Base(entry.Name), src)
+		rc.Close()
+		if total.left <= 0 {
+			return errZipTotalTooBig
+		}
+	}
+	return nil
+}
+
+// the entries the archivers add by themselves
+func skippedZipEntry(name string) bool {
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
+
+// zip slip: no absolute path, no .. and no backslash (a separator on Windows)
+func safeZipPath(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, `\`) || strings.Contains(name, ":") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// the uncompressed bytes an archive may still produce
+type zipBudget struct {
+	left int64
+}
+
+// zipEntryReader fails, and so makes storeWallpaper drop the file, as soon as an entry
+// inflates past its limit, its ratio or the budget of the archive
+type zipEntryReader struct {
+	r          io.Reader
+	read       int64
+	left       int64
+	compressed int64
+	total      *zipBudget
+}
+
+func (z *zipEntryReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	z.read += int64(n)
+	z.left -= int64(n)
+	z.total.left -= int64(n)
+	switch {
+	case z.left < 0:
+		return n, errZipEntryTooBig
+	case z.total.left < 0:
+		return n, errZipTotalTooBig
+	case z.read > 1<<20 && z.read > maxZipRatio*z.compressed:
+		return n, errZipRatio
+	}
+	return n, err
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+)
+
+func TestSafeZipPath(t *testing.T) {
+	tests := []struct {
+		name string
+		safe bool
+	}{
+		{"nebula.png", true},
+		{"space/nebula.png", true},
+		{"space/..nebula.png", true},
+		{"", false},
+		{"../nebula.png", false},
+		{"space/../../nebula.png", false},
+		{"space/..", false},
+		{"/etc/passwd", false},
+		{"/nebula.png", false},
+		{`..\nebula.png`, false},
+		{`space\nebula.png`, false},
+		{`C:\Windows\nebula.png`, false},
+		{"C:/Windows/nebula.png", false},
+		{"C:nebula.png", false},
+	}
+	for _, tt := range tests {
+		if got := safeZipPath(tt.name); got != tt.safe {
+			t.Errorf("safeZipPath(%q) = %v, want %v", tt.name, got, tt.safe)
+		}
+	}
+}
+
+// zipFile is the multipart.File of an archive held in memory
+type zipFile struct{ *bytes.Reader }
+
+func (zipFile) Close() error { return nil }
+
+func TestStoreZipEntryLargerThanDeclared(t *testing.T) {
+	content := bytes.Repeat([]byte("wallpaper"), 1000)
+	const declared = 16
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "nebula.png",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(content),
+		CompressedSize64:   uint64(len(content)),
+		UncompressedSize64: declared,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(content)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var opened, stored, failed []string
+	store := func(name, originalName string, src io.Reader) {
+		opened = append(opened, name)
+		n, err := io.Copy(io.Discard, src)
+		if err == nil {
+			stored = append(stored, name)
+		}
+		if n > declared {
+			t.Errorf("%s: %d bytes read, %d declared", name, n, declared)
+		}
+	}
+	fail := func(name string, err error) { failed = append(failed, name) }
+
+	err = storeZip("batch.zip", zipFile{bytes.NewReader(buf.Bytes())}, int64(buf.Len()), store, fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(opened) != 1 || len(stored) != 0 || len(failed) != 0 {
+		t.Errorf("opened %v, stored %v, failed %v: the entry should have been dropped by store", opened, stored, failed)
+	}
+}
+
+func TestZipEntryReaderLimit(t *testing.T) {
+	// an entry whose header claims a small size: only the bytes read count
+	src := &zipEntryReader{
+		r:          io.LimitReader(zeroReader{}, maxZipEntrySize+1),
+		left:       maxZipEntrySize,
+		compressed: maxZipEntrySize, // keeps the ratio check out of the way
+		total:      &zipBudget{left: maxZipTotalSize},
+	}
+	n, err := io.Copy(io.Discard, src)
+	if !errors.Is(err, errZipEntryTooBig) {
+		t.Errorf("err = %v, want %v", err, errZipEntryTooBig)
+	}
+	if n > maxZipEntrySize+1 {
+		t.Errorf("%d bytes read", n)
+	}
+
+	total := &zipBudget{left: 10}
+	src = &zipEntryReader{r: io.LimitReader(zeroReader{}, 11), left: maxZipEntrySize, compressed: 11, total: total}
+	if _, err := io.Copy(io.Discard, src); !errors.Is(err, errZipTotalTooBig) {
+		t.Errorf("err = %v, want %v", err, errZipTotalTooBig)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// bulk actions of the review queue
+const (
+	BulkApprove = "approve"
+	BulkReject  = "reject"
+	BulkTag     = "tag"
+	BulkDelete  = "delete"
+)
+
+const maxBulkItems = 100
+
+type BulkRequest struct {
+	Action string `json:"action"`
+	IDs    []int  `json:"ids"`
+	Reason string `json:"reason,omitempty"` // reject
+	Tags   string `json:"tags,omitempty"`   // tag, comma separated
+}
+
+// the outcome for one wallpaper, each one is applied in its own transaction
+type BulkResult struct {
+	ID     int    `json:"id"`
+	OK     bool   `json:"ok"`
+	Status string `json:"status,omitempty"` // the new moderation state
+	Error  string `json:"error,omitempty"`
+}
+
+type BulkResponse struct {
+	Action    string       `json:"action"`
+	Results   []BulkResult `json:"results"`
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+}
+
+// BulkModerationHandler applies one action to many wallpapers of the review queue (admin),
+// delete moves them to the trash
+// POST /api/admin/bulk {"action": "approve|reject|tag|delete", "ids": [1, 2], "reason": "...", "tags": "a, b"}
+// An item failing doesn't stop the others, the response lists what happened to each.
+func BulkModerationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	admin := getCurrentUser(r)
+	if admin == nil {
+		jsonError(w, http.StatusUnauthorized, "Please log in")
+		return
+	}
+	if !admin.IsAdmin {
+		jsonError(w, http.StatusForbidden, "Admin access required")
+		return
+	}
+
+	var req BulkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid JSON")
+		return
+	}
+	if len(req.IDs) == 0 {
+		jsonError(w, http.StatusBadRequest, "No wallpapers selected")
+		return
+	}
+	if len(req.IDs) > maxBulkItems {
+		jsonError(w, http.StatusBadRequest, fmt.Sprintf("Too many wallpapers (max %d)", maxBulkItems))
+		return
+	}
+
+	// checked once up front rather than failing every item
+	var apply func(id int) (string, error)
+	switch req.Action {
+	case BulkApprove:
+		apply = func(id int) (string, error) {
+			return moderateWallpaper(r, admin, id, func(string) string { return StatusApproved }, "", nil)
+		}
+	case BulkReject:
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			jsonError(w, http.StatusBadRequest, errReasonRequired.Error())
+			return
+		}
+		if len(req.Reason) > maxReasonLength {
+			jsonError(w, http.StatusBadRequest, errReasonTooLong.Error())
+			return
+		}
+		apply = func(id int) (string, error) {
+			return moderateWallpaper(r, admin, id, func(string) string { return StatusRejected }, req.Reason, nil)
+		}
+	case BulkTag:
+		tags, err := parseTags(req.Tags)
+		if err != nil {
+			jsonError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if len(tags) == 0 {
+			jsonError(w, http.StatusBadRequest, "No tags given")
+			return
+		}
+		apply = func(id int) (string, error) {
+			return "", bulkTag(r, admin, id, tags)
+		}
+	case BulkDelete:
+		apply = func(id int) (string, error) {
+			return "", bulkDelete(r, admin, id)
+		}
+	default:
+		jsonError(w, http.StatusBadRequest, "action must be approve, reject, tag or delete")
+		return
+	}
+
+	resp := BulkResponse{Action: req.Action, Results: []BulkResult{}}
+	seen := make(map[int]bool)
+	for _, id := range req.IDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		result := BulkResult{ID: id}
+		status, err := apply(id)
+		if err != nil {
+			result.Error = bulkErrorMessage(err)
+			resp.Failed++
+		} else {
+			result.OK, result.Status = true, status
+			resp.Succeeded++
+		}
+		resp.Results = append(resp.Results, result)
+	}
+
+	log.Printf("Bulk %s by admin %s: %d ok, %d failed", req.Action, admin.Username, resp.Succeeded, resp.Failed)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func bulkTag(r *http.Request, admin *UserProfile, wallpaperID int, tags []string) error {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM wallpapers WHERE id = ? AND deleted_at IS NULL)", wallpaperID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	before, err := tagsByWallpaper(wallpaperID)
+	if err != nil {
+		return err
+	}
+
+	if err := addWallpaperTags(wallpaperID, tags); err != nil {
+		return err
+	}
+
+	after, err := tagsByWallpaper(wallpaperID)
+	if err != nil {
+		log.Println("Failed to load tags:", err)
+	}
+	audit(r, admin, AuditEditTags, AuditTargetWallpaper, wallpaperID,
+		map[string][]string{"tags": before[wallpaperID]}, map[string][]string{"tags": after[wallpaperID]})
+	return nil
+}
+
+func bulkDelete(r *http.Request, admin *UserProfile, wallpaperID int) error {
+	var before struct {
+		OwnerID      int    `json:"owner_id"`
+		OriginalName string `json:"original_name"`
+		Status       string `json:"status"`
+	}
+	err := db.QueryRow("SELECT user_id, original_name, status FROM wallpapers WHERE id = ? AND deleted_at IS NULL", wallpaperID).
+		Scan(&before.OwnerID, &before.OriginalName, &before.Status)
+	if err != nil {
+		return err
+	}
+
+	if err := softDeleteWallpaper(wallpaperID, admin.UserID); err != nil {
+		return err
+	}
+	audit(r, admin, AuditDeleteWallpaper, AuditTargetWallpaper, wallpaperID, before, nil)
+	return nil
+}
+
+// the message shown for a failed item, internal errors are only logged
+func bulkErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return "wallpaper not found"
+	case errors.Is(err, errInvalidTransition), errors.Is(err, errTransitionDenied),
+		errors.Is(err, errReasonRequired), errors.Is(err, errReasonTooLong), errors.Is(err, errTooManyTags):
+		return err.Error()
+	default:
+		log.Println("Bulk moderation error:", err)
+		return "internal error"
+	}
+}
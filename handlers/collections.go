@@ -0,0 +1,263 @@
+// / this file contains the collections (albums) queries shared by the pages and the JSON API
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// collection visibilities
+const (
+	CollectionPrivate  = "private"  // owner only
+	CollectionUnlisted = "unlisted" // anyone with the link
+	CollectionPublic   = "public"   // listed on the collections page and the owner's profile
+)
+
+type Collection struct {
+	ID               int              `json:"id"`
+	UserID           int              `json:"user_id"`
+	Owner            string           `json:"owner"`
+	Name             string           `json:"name"`
+	Description      string           `json:"description"`
+	CoverWallpaperID int              `json:"cover_wallpaper_id,omitempty"`
+	CoverFilename    string           `json:"cover_filename,omitempty"`
+	Visibility       string           `json:"visibility"`
+	ItemCount        int              `json:"item_count"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+	Items            []CollectionItem `json:"items,omitempty"`
+}
+
+type CollectionItem struct {
+	WallpaperID  int       `json:"wallpaper_id"`
+	Filename     string    `json:"filename"`
+	OriginalName string    `json:"original_name"`
+	Owner        string    `json:"owner"`
+	Position     int       `json:"position"`
+	AddedAt      time.Time `json:"added_at"`
+}
+
+type CollectionRequest struct {
+	Name             *string `json:"name"`
+	Description      *string `json:"description"`
+	Visibility       *string `json:"visibility"`
+	CoverWallpaperID *int    `json:"cover_wallpaper_id"`
+}
+
+var errCoverNotInCollection = errors.New("the cover must be a wallpaper of the collection")
+
+func validVisibility(v string) bool {
+	return v == CollectionPrivate || v == CollectionUnlisted || v == CollectionPublic
+}
+
+// checks the name/description/visibility of a create or update request
+func (req CollectionRequest) validate() error {
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" || len(name) > 100 {
+			return fmt.Errorf("Name must be 1-100 characters")
+		}
+		*req.Name = name
+	}
+	if req.Description != nil && len(*req.Description) > 2000 {
+		return fmt.Errorf("Description too long (max 2000 characters)")
+	}
+	if req.Visibility != nil && !validVisibility(*req.Visibility) {
+		return fmt.Errorf("Visibility must be private, unlisted or public")
+	}
+	return nil
+}
+
+// collectionSelectSQL returns the SELECT of the collections as viewerID sees them: the cover falls
+// back to the first item when none is set, both among the wallpapers listed to the viewer only,
+// so a cover never reveals a wallpaper the viewer can't see
+func collectionSelectSQL(viewerID int) (string, []interface{}) {
+	cond, args := listedToSQL(viewerID)
+	query := `
+	SELECT c.id, c.user_id, u.username, c.name, COALESCE(c.description, ''),
+		COALESCE(c.cover_wallpaper_id, 0),
+		COALESCE(
+			(SELECT w.filename FROM wallpapers w WHERE w.id = c.cover_wallpaper_id AND ` + cond + `),
+			(SELECT w.filename FROM collection_items ci
+				JOIN wallpapers w ON w.id = ci.wallpaper_id
+				WHERE ci.collection_id = c.id AND ` + cond + `
+				ORDER BY ci.position, ci.added_at
+				LIMIT 1),
+			''),
+		c.visibility, c.created_at, c.updated_at,
+		(SELECT COUNT(*) FROM collection_items ci WHERE ci.collection_id = c.id)
+	FROM collections c
+	JOIN users u ON u.id = c.user_id`
+	return query, append(append([]interface{}{}, args...), args...)
+}
+
+func scanCollection(row interface{ Scan(...interface{}) error }) (Collection, error) {
+	var c Collection
+	err := row.Scan(&c.ID, &c.UserID, &c.Owner, &c.Name, &c.Description,
+		&c.CoverWallpaperID, &c.CoverFilename,
+		&c.Visibility, &c.CreatedAt, &c.UpdatedAt, &c.ItemCount)
+	return c, err
+}
+
+// returns collections matching the condition as viewerID sees them, most recently updated first
+func queryCollections(viewerID int, where string, args ...interface{}) ([]Collection, error) {
+	query, selectArgs := collectionSelectSQL(viewerID)
+	rows, err := db.Query(query+" WHERE "+where+" ORDER BY c.updated_at DESC, c.id DESC", append(selectArgs, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collections := []Collection{}
+	for rows.Next() {
+		c, err := scanCollection(rows)
+		if err != nil {
+			return nil, err
+		}
+		collections = append(collections, c)
+	}
+	return collections, rows.Err()
+}
+
+// getCollection loads a collection as viewerID sees it (0 when logged out)
+func getCollection(id, viewerID int) (Collection, error) {
+	query, args := collectionSelectSQL(viewerID)
+	return scanCollection(db.QueryRow(query+" WHERE c.id = ?", append(args, id)...))
+}
+
+// private collections are for their owner (and admins), unlisted/public for everyone
+func canViewCollection(c Collection, viewer *UserProfile) bool {
+	if c.Visibility != CollectionPrivate {
+		return true
+	}
+	return viewer != nil && (viewer.UserID == c.UserID || viewer.IsAdmin)
+}
+
+// returns the items of a collection in order, only the wallpapers viewerID is allowed to see
+func collectionItems(collectionID, viewerID int) ([]CollectionItem, error) {
+	cond, args := listedToSQL(viewerID)
+	rows, err := db.Query(`
+		SELECT w.id, w.filename, w.original_name, u.username, ci.position, ci.added_at
+		FROM collection_items ci
+		JOIN wallpapers w ON w.id = ci.wallpaper_id
+		JOIN users u ON u.id = w.user_id
+		WHERE ci.collection_id = ? AND `+cond+`
+		ORDER BY ci.position, ci.added_at
+	`, append([]interface{}{collectionID}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []CollectionItem{}
+	for rows.Next() {
+		var it CollectionItem
+		if err := rows.Scan(&it.WallpaperID, &it.Filename, &it.OriginalName, &it.Owner, &it.Position, &it.AddedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+func createCollection(userID int, name, description, visibility string) (int, error) {
+	result, err := db.Exec(`
+		INSERT INTO collections (user_id, name, description, visibility)
+		VALUES (?, ?, ?, ?)
+	`, userID, name, description, visibility)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// adds a wallpaper at the end of a collection, the owner must be able to see it
+func addToCollection(c Collection, wallpaperID int) error {
+	cond, args := visibleToSQL(c.UserID)
+	var visible bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM wallpapers w WHERE w.id = ? AND "+cond+")",
+		append([]interface{}{wallpaperID}, args...)...).Scan(&visible)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		return sql.ErrNoRows
+	}
+
+	_, err = db.Exec(`
+		INSERT IGNORE INTO collection_items (collection_id, wallpaper_id, position)
+		SELECT ?, ?, COALESCE(MAX(position), -1) + 1 FROM collection_items WHERE collection_id = ?
+	`, c.ID, wallpaperID, c.ID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("UPDATE collections SET updated_at = NOW() WHERE id = ?", c.ID)
+	return err
+}
+
+// rewrites the positions from the given order, ids not in the collection are ignored
+func reorderCollection(collectionID int, wallpaperIDs []int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for position, wallpaperID := range wallpaperIDs {
+		_, err := tx.Exec("UPDATE collection_items SET position = ? WHERE collection_id = ? AND wallpaper_id = ?",
+			position, collectionID, wallpaperID)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE collections SET updated_at = NOW() WHERE id = ?", collectionID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applies the non-nil fields of req
+func updateCollection(c Collection, req CollectionRequest) error {
+	var sets []string
+	var args []interface{}
+	if req.Name != nil {
+		sets = append(sets, "name = ?")
+		args = append(args, *req.Name)
+	}
+	if req.Description != nil {
+		sets = append(sets, "description = ?")
+		args = append(args, *req.Description)
+	}
+	if req.Visibility != nil {
+		sets = append(sets, "visibility = ?")
+		args = append(args, *req.Visibility)
+	}
+	if req.CoverWallpaperID != nil {
+		// 0 clears the cover, anything else must be in the collection
+		if *req.CoverWallpaperID == 0 {
+			sets = append(sets, "cover_wallpaper_id = NULL")
+		} else {
+			var inCollection bool
+			err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM collection_items WHERE collection_id = ? AND wallpaper_id = ?)",
+				c.ID, *req.CoverWallpaperID).Scan(&inCollection)
+			if err != nil {
+				return err
+			}
+			if !inCollection {
+				return errCoverNotInCollection
+			}
+			sets = append(sets, "cover_wallpaper_id = ?")
+			args = append(args, *req.CoverWallpaperID)
+		}
+	}
+	if len(sets) == 0 {
+		return nil
+	}
+
+	_, err := db.Exec("UPDATE collections SET "+strings.Join(sets, ", ")+" WHERE id = ?", append(args, c.ID)...)
+	return err
+}
@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type AddItemRequest struct {
+	WallpaperID int `json:"wallpaper_id"`
+}
+
+type ReorderRequest struct {
+	WallpaperIDs []int `json:"wallpaper_ids"`
+}
+
+// CollectionsAPIHandler serves the collections JSON API:
+//
+//	GET    /api/collections                      the user's collections
+//	POST   /api/collections                      create {name, description, visibility}
+//	GET    /api/collections/{id}                 a collection with its items
+//	PATCH  /api/collections/{id}                 update {name, description, visibility, cover_wallpaper_id}
+//	DELETE /api/collections/{id}                 delete
+//	POST   /api/collections/{id}/items           add {wallpaper_id}
+//	DELETE /api/collections/{id}/items/{wid}     remove a wallpaper
+//	PUT    /api/collections/{id}/order           reorder {wallpaper_ids}
+func CollectionsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/collections"), "/")
+	// wpctl reads collections with its token, the changes stay on the session
+	var user *UserProfile
+	if r.Method == http.MethodGet {
+		user = getAPIUser(r)
+	} else {
+		user = getCurrentUser(r)
+	}
+
+	if path == "" {
+		if user == nil {
+			jsonError(w, http.StatusUnauthorized, "Please log in")
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			listCollectionsAPI(w, user)
+		case http.MethodPost:
+			createCollectionAPI(w, r, user)
+		default:
+			jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+	viewerID := 0
+	if user != nil {
+		viewerID = user.UserID
+	}
+	c, err := getCollection(id, viewerID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Failed to load collection:", err)
+		}
+		jsonError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	// reading follows the visibility, everything else is for the owner
+	if len(parts) == 1 && r.Method == http.MethodGet {
+		getCollectionAPI(w, c, user)
+		return
+	}
+	if user == nil {
+		jsonError(w, http.StatusUnauthorized, "Please log in")
+		return
+	}
+	if user.UserID != c.UserID {
+		if canViewCollection(c, user) {
+			jsonError(w, http.StatusForbidden, "Only the owner can edit this collection")
+		} else {
+			jsonError(w, http.StatusNotFound, "Collection not found")
+		}
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		updateCollectionAPI(w, r, c, user)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		deleteCollectionAPI(w, c)
+	case len(parts) == 2 && parts[1] == "items" && r.Method == http.MethodPost:
+		addItemAPI(w, r, c, user)
+	case len(parts) == 3 && parts[1] == "items" && r.Method == http.MethodDelete:
+		removeItemAPI(w, c, parts[2])
+	case len(parts) == 2 && parts[1] == "order" && r.Method == http.MethodPut:
+		reorderAPI(w, r, c, user)
+	case len(parts) <= 3:
+		jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	default:
+		jsonError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func listCollectionsAPI(w http.ResponseWriter, user *UserProfile) {
+	collections, err := queryCollections(user.UserID, "c.user_id = ?", user.UserID)
+	if err != nil {
+		log.Println("Failed to query collections:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load collections")
+		return
+	}
+	writeJSON(w, http.StatusOK, collections)
+}
+
+func createCollectionAPI(w http.ResponseWriter, r *http.Request, user *UserProfile) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if req.Name == nil {
+		jsonError(w, http.StatusBadRequest, "Name is required")
+		return
+	}
+	if req.Description == nil {
+		req.Description = new(string)
+	}
+	if req.Visibility == nil {
+		visibility := CollectionPrivate
+		req.Visibility = &visibility
+	}
+	if err := req.validate(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	id, err := createCollection(user.UserID, *req.Name, *req.Description, *req.Visibility)
+	if err != nil {
+		log.Println("Failed to create collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to create collection")
+		return
+	}
+	log.Printf("📚 Collection %d created by user %d", id, user.UserID)
+
+	c, err := getCollection(id, user.UserID)
+	if err != nil {
+		log.Println("Failed to load collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load collection")
+		return
+	}
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func getCollectionAPI(w http.ResponseWriter, c Collection, user *UserProfile) {
+	if !canViewCollection(c, user) {
+		jsonError(w, http.StatusNotFound, "Collection not found")
+		return
+	}
+
+	viewerID := 0
+	if user != nil {
+		viewerID = user.UserID
+	}
+	items, err := collectionItems(c.ID, viewerID)
+	if err != nil {
+		log.Println("Failed to load collection items:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load collection")
+		return
+	}
+	c.Items = items
+	writeJSON(w, http.StatusOK, c)
+}
+
+func updateCollectionAPI(w http.ResponseWriter, r *http.Request, c Collection, user *UserProfile) {
+	var req CollectionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+	if err := req.validate(); err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := updateCollection(c, req); err != nil {
+		if errors.Is(err, errCoverNotInCollection) {
+			jsonError(w, http.StatusBadRequest, "The cover must be a wallpaper of the collection")
+			return
+		}
+		log.Println("Failed to update collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to update collection")
+		return
+	}
+
+	updated, err := getCollection(c.ID, user.UserID)
+	if err != nil {
+		log.Println("Failed to load collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load collection")
+		return
+	}
+	getCollectionAPI(w, updated, user)
+}
+
+func deleteCollectionAPI(w http.ResponseWriter, c Collection) {
+	// items go with the ON DELETE CASCADE
+	if _, err := db.Exec("DELETE FROM collections WHERE id = ?", c.ID); err != nil {
+		log.Println("Failed to delete collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to delete collection")
+		return
+	}
+	log.Printf("🗑️ Collection %d deleted", c.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func addItemAPI(w http.ResponseWriter, r *http.Request, c Collection, user *UserProfile) {
+	var req AddItemRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.WallpaperID == 0 {
+		jsonError(w, http.StatusBadRequest, "wallpaper_id is required")
+		return
+	}
+
+	if err := addToCollection(c, req.WallpaperID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			jsonError(w, http.StatusNotFound, "Wallpaper not found")
+			return
+		}
+		log.Println("Failed to add to collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to add to collection")
+		return
+	}
+
+	updated, err := getCollection(c.ID, user.UserID)
+	if err != nil {
+		log.Println("Failed to load collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load collection")
+		return
+	}
+	getCollectionAPI(w, updated, user)
+}
+
+func removeItemAPI(w http.ResponseWriter, c Collection, rawWallpaperID string) {
+	wallpaperID, err := strconv.Atoi(rawWallpaperID)
+	if err != nil {
+		jsonError(w, http.StatusNotFound, "Wallpaper not found")
+		return
+	}
+
+	result, err := db.Exec("DELETE FROM collection_items WHERE collection_id = ? AND wallpaper_id = ?", c.ID, wallpaperID)
+	if err != nil {
+		log.Println("Failed to remove from collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to remove from collection")
+		return
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		jsonError(w, http.StatusNotFound, "Wallpaper not in this collection")
+		return
+	}
+
+	// a removed cover falls back to the first item
+	_, err = db.Exec(`
+		UPDATE collections
+		SET updated_at = NOW(),
+			cover_wallpaper_id = IF(cover_wallpaper_id = ?, NULL, cover_wallpaper_id)
+		WHERE id = ?
+	`, wallpaperID, c.ID)
+	if err != nil {
+		log.Println("Failed to update collection:", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func reorderAPI(w http.ResponseWriter, r *http.Request, c Collection, user *UserProfile) {
+	var req ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonError(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := reorderCollection(c.ID, req.WallpaperIDs); err != nil {
+		log.Println("Failed to reorder collection:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to reorder collection")
+		return
+	}
+	getCollectionAPI(w, c, user)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type CollectionsPageData struct {
+	Username string
+	IsAdmin  bool
+	LoggedIn bool
+	Mine     []Collection
+	Public   []Collection
+	Error    string
+}
+
+type CollectionPageData struct {
+	Username   string
+	IsAdmin    bool
+	LoggedIn   bool
+	IsOwner    bool
+	Collection Collection
+}
+
+// CollectionsHandler lists the user's collections and the public ones (GET), or creates one (POST)
+func CollectionsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+
+	switch r.Method {
+	case http.MethodGet:
+		data := CollectionsPageData{}
+		viewerID := 0
+		if user != nil {
+			viewerID = user.UserID
+			data.Username = user.Username
+			data.IsAdmin = user.IsAdmin
+			data.LoggedIn = true
+
+			mine, err := queryCollections(user.UserID, "c.user_id = ?", user.UserID)
+			if err != nil {
+				log.Println("Failed to query collections:", err)
+				http.Error(w, "Failed to load collections", http.StatusInternalServerError)
+				return
+			}
+			data.Mine = mine
+		}
+		renderCollections(w, data, viewerID)
+
+	case http.MethodPost:
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		name := r.FormValue("name")
+		description := r.FormValue("description")
+		visibility := r.FormValue("visibility")
+		if visibility == "" {
+			visibility = CollectionPrivate
+		}
+		req := CollectionRequest{Name: &name, Description: &description, Visibility: &visibility}
+		if err := req.validate(); err != nil {
+			mine, _ := queryCollections(user.UserID, "c.user_id = ?", user.UserID)
+			renderCollections(w, CollectionsPageData{
+				Username: user.Username,
+				IsAdmin:  user.IsAdmin,
+				LoggedIn: true,
+				Mine:     mine,
+				Error:    err.Error(),
+			}, user.UserID)
+			return
+		}
+
+		id, err := createCollection(user.UserID, name, description, visibility)
+		if err != nil {
+			log.Println("Failed to create collection:", err)
+			http.Error(w, "Failed to create collection", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("📚 Collection %d created by user %d", id, user.UserID)
+		http.Redirect(w, r, "/collections/"+strconv.Itoa(id), http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func renderCollections(w http.ResponseWriter, data CollectionsPageData, viewerID int) {
+	public, err := queryCollections(viewerID, "c.visibility = ?", CollectionPublic)
+	if err != nil {
+		log.Println("Failed to query public collections:", err)
+	}
+	data.Public = public
+
+	if err := templates.ExecuteTemplate(w, "collections.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// CollectionPageHandler shows a collection, the owner gets the edit controls
+// URL format: /collections/{id}
+func CollectionPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/collections/"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	user := getCurrentUser(r)
+	viewerID := 0
+	if user != nil {
+		viewerID = user.UserID
+	}
+
+	c, err := getCollection(id, viewerID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Failed to load collection:", err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if !canViewCollection(c, user) {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := CollectionPageData{}
+	if user != nil {
+		data.Username = user.Username
+		data.IsAdmin = user.IsAdmin
+		data.LoggedIn = true
+		data.IsOwner = user.UserID == c.UserID
+	}
+
+	c.Items, err = collectionItems(c.ID, viewerID)
+	if err != nil {
+		log.Println("Failed to load collection items:", err)
+		http.Error(w, "Failed to load collection", http.StatusInternalServerError)
+		return
+	}
+	data.Collection = c
+
+	if err := templates.ExecuteTemplate(w, "collection.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// AddToCollectionHandler is the form version of POST /api/collections/{id}/items,
+// used by the "add to collection" select on the wallpaper cards
+func AddToCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+	collectionID, err := strconv.Atoi(r.FormValue("collection_id"))
+	if err != nil {
+		http.Error(w, "Collection ID missing", http.StatusBadRequest)
+		return
+	}
+
+	c, err := getCollection(collectionID, userID)
+	if err != nil || c.UserID != userID {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+
+	if err := addToCollection(c, wallpaperID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Wallpaper not found", http.StatusNotFound)
+			return
+		}
+		log.Println("Failed to add to collection:", err)
+		http.Error(w, "Failed to add to collection", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, redirectBack(r, "/collections/"+strconv.Itoa(c.ID)), http.StatusSeeOther)
+}
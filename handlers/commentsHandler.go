@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"database/sql"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -13,13 +14,16 @@ type Comment struct {
 	ID          int       `json:"id"`
 	WallpaperID int       `json:"wallpaper_id"`
 	UserID      int       `json:"user_id"`
+	ParentID    int       `json:"parent_id,omitempty"`
 	Username    string    `json:"username"`
 	Text        string    `json:"text"`
 	CreatedAt   time.Time `json:"created_at"`
+	Badges      []Badge   `json:"badges,omitempty"`
 }
 
 type CommentRequest struct {
 	WallpaperID int    `json:"wallpaper_id"`
+	ParentID    int    `json:"parent_id,omitempty"`
 	Text        string `json:"text"`
 }
 
@@ -45,11 +49,23 @@ func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// same ACL as the wallpaper itself, wpctl reads the comments with its token
+	visible, err := canViewWallpaperAs(getAPIUser(r), wallpaperID)
+	if err != nil {
+		log.Println("❌ ACL check failed:", err)
+		http.Error(w, "Failed to load comments", http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+
 	log.Println("🔍 Querying comments for wallpaper:", wallpaperID)
 
 	// Query comments from database
 	rows, err := db.Query(`
-       SELECT c.id, c.wallpaper_id, c.user_id, u.username, c.text, c.created_at
+       SELECT c.id, c.wallpaper_id, c.user_id, COALESCE(c.parent_id, 0), u.username, c.text, c.created_at
        FROM comments c
        JOIN users u ON c.user_id = u.id
        WHERE c.wallpaper_id = ?
@@ -65,7 +81,7 @@ func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 	var comments []Comment
 	for rows.Next() {
 		var c Comment
-		if err := rows.Scan(&c.ID, &c.WallpaperID, &c.UserID, &c.Username, &c.Text, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.WallpaperID, &c.UserID, &c.ParentID, &c.Username, &c.Text, &c.CreatedAt); err != nil {
 			log.Println("❌ Row scan error:", err)
 			continue
 		}
@@ -77,6 +93,21 @@ func GetCommentsHandler(w http.ResponseWriter, r *http.Request) {
 		comments = []Comment{}
 	}
 
+	// badges shown next to the usernames
+	if len(comments) > 0 {
+		var authorIDs []int
+		for _, c := range comments {
+			authorIDs = append(authorIDs, c.UserID)
+		}
+		badges, err := badgesByUser(authorIDs...)
+		if err != nil {
+			log.Println("❌ Failed to load badges:", err)
+		}
+		for i := range comments {
+			comments[i].Badges = badges[comments[i].UserID]
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
 }
@@ -134,28 +165,54 @@ func PostCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Verify wallpaper exists
+	// Verify wallpaper exists + get owner to notify
 	log.Println("🔍 Checking if wallpaper exists...")
-	var wallpaperExists bool
-	err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM wallpapers WHERE id = ?)", req.WallpaperID).Scan(&wallpaperExists)
+	var ownerID int
+	err = db.QueryRow("SELECT user_id FROM wallpapers WHERE id = ? AND deleted_at IS NULL", req.WallpaperID).Scan(&ownerID)
+	if err == sql.ErrNoRows {
+		log.Println("❌ Wallpaper not found:", req.WallpaperID)
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		log.Println("❌ Database error checking wallpaper:", err)
 		http.Error(w, "Database error", http.StatusInternalServerError)
 		return
 	}
-	if !wallpaperExists {
-		log.Println("❌ Wallpaper not found:", req.WallpaperID)
+	// can't comment on what you can't see
+	visible, err := canViewWallpaper(r, req.WallpaperID)
+	if err != nil {
+		log.Println("❌ ACL check failed:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if !visible {
+		log.Println("❌ Wallpaper not visible to user:", req.WallpaperID, userID)
 		http.Error(w, "Wallpaper not found", http.StatusNotFound)
 		return
 	}
 	log.Println("Wallpaper exists")
 
+	// a reply must point to a comment of the same wallpaper
+	var parent interface{}
+	var parentAuthorID int
+	if req.ParentID != 0 {
+		err = db.QueryRow("SELECT user_id FROM comments WHERE id = ? AND wallpaper_id = ?", req.ParentID, req.WallpaperID).
+			Scan(&parentAuthorID)
+		if err != nil {
+			log.Println("❌ Parent comment not found:", req.ParentID, err)
+			http.Error(w, "Parent comment not found", http.StatusBadRequest)
+			return
+		}
+		parent = req.ParentID
+	}
+
 	// Insert comment
 	log.Println("Inserting comment into database...")
 	result, err := db.Exec(`
-       INSERT INTO comments (wallpaper_id, user_id, text, created_at)
-       VALUES (?, ?, ?, NOW())
-    `, req.WallpaperID, userID, req.Text)
+       INSERT INTO comments (wallpaper_id, user_id, parent_id, text, created_at)
+       VALUES (?, ?, ?, ?, NOW())
+    `, req.WallpaperID, userID, parent, req.Text)
 	if err != nil {
 		log.Println("❌ Failed to insert comment:", err)
 		http.Error(w, "Failed to post comment", http.StatusInternalServerError)
@@ -165,6 +222,29 @@ func PostCommentHandler(w http.ResponseWriter, r *http.Request) {
 	commentID, _ := result.LastInsertId()
 	log.Printf("Comment posted successfully: ID=%d, User=%d, Wallpaper=%d\n", commentID, userID, req.WallpaperID)
 
+	// push it to everyone looking at this wallpaper
+	username := getUsername(userID)
+	comment := Comment{
+		ID:          int(commentID),
+		WallpaperID: req.WallpaperID,
+		UserID:      userID,
+		ParentID:    req.ParentID,
+		Username:    username,
+		Text:        req.Text,
+		CreatedAt:   time.Now(),
+	}
+	publishEvent(commentsTopic(req.WallpaperID), "comment", comment)
+	emitWebhook(EventCommentCreated, ownerID, comment)
+
+	// the parent author gets a "reply", the owner a "comment" (only one if it's the same person)
+	if parentAuthorID != 0 {
+		notify(parentAuthorID, userID, NotifReply, req.WallpaperID, username+" replied to your comment")
+	}
+	if ownerID != parentAuthorID {
+		notify(ownerID, userID, NotifComment, req.WallpaperID, username+" commented on your wallpaper")
+	}
+	evaluateBadges(BadgeEventComment, userID)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -1,58 +1,106 @@
 package handlers
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
 )
 
+// CommunityHandler shows the public wallpapers, a page at a time
+// URL format: /community?cursor=...
 func CommunityHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Get all public wallpapers
-	rows, err := db.Query(`
-       SELECT id, filename, original_name, uploaded_at, ispublic
-       FROM wallpapers 
-       WHERE ispublic = 1
-       ORDER BY uploaded_at DESC
-    `)
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Get current user info (if logged in)
+	user := getCurrentUser(r)
+	data, err := communityPage(user, cursor, galleryPageSize)
 	if err != nil {
 		log.Println("Failed to query wallpapers:", err)
 		http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	// Add all wallpapers to the list
-	var wallpapers []Wallpaper
-	for rows.Next() {
-		var w Wallpaper
-		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.IsPublic); err != nil {
-			log.Println("Row scan error:", err)
-			continue
+	if user != nil && cursor == nil {
+		// private wallpapers friends shared with us, on the first page only
+		data.SharedWallpapers, err = sharedWallpapers(user.UserID)
+		if err != nil {
+			log.Println("Failed to query shared wallpapers:", err)
+			http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
+			return
 		}
-		wallpapers = append(wallpapers, w)
+		attachTags(data.SharedWallpapers)
 	}
 
-	// Get current user info (if logged in)
-	user := getCurrentUser(r)
-	username := ""
-	isAdmin := false
+	if err := templates.ExecuteTemplate(w, "community.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// communityPage loads a page of public wallpapers + what the cards need for user (nil when logged out)
+func communityPage(user *UserProfile, cursor *Cursor, limit int) (WallpapersPageData, error) {
+	var data WallpapersPageData
 	if user != nil {
-		username = user.Username
-		isAdmin = user.IsAdmin
+		data.Username = user.Username
+		data.IsAdmin = user.IsAdmin
+
+		collections, err := queryCollections(user.UserID, "c.user_id = ?", user.UserID)
+		if err != nil {
+			log.Println("Failed to query collections:", err)
+		}
+		data.Collections = collections
 	}
 
-	data := WallpapersPageData{
-		Wallpapers: wallpapers,
-		Username:   username,
-		IsAdmin:    isAdmin,
+	wallpapers, next, err := pageWallpapers(`
+		SELECT w.id, w.filename, w.original_name, w.uploaded_at, w.status, u.username
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.status = 'approved' AND w.deleted_at IS NULL AND w.archived_at IS NULL`, nil, cursor, limit, func(rows *sql.Rows) (Wallpaper, error) {
+		var w Wallpaper
+		err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.Status, &w.Owner)
+		return w, err
+	})
+	if err != nil {
+		return data, err
 	}
+	attachTags(wallpapers)
+	data.Wallpapers = wallpapers
+	data.NextCursor = next
+	return data, nil
+}
 
-	if err := templates.ExecuteTemplate(w, "community.html", data); err != nil {
-		log.Println("Template error:", err)
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
+// returns the wallpapers shared with userID by their friends, newest first
+func sharedWallpapers(userID int) ([]Wallpaper, error) {
+	cond, args := sharedWithSQL(userID)
+	rows, err := db.Query(`
+		SELECT w.id, w.filename, w.original_name, w.uploaded_at, u.username
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		WHERE `+cond+`
+		ORDER BY w.uploaded_at DESC
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallpapers []Wallpaper
+	for rows.Next() {
+		var w Wallpaper
+		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.Owner); err != nil {
+			log.Println("Row scan error:", err)
+			continue
+		}
+		wallpapers = append(wallpapers, w)
 	}
+	return wallpapers, rows.Err()
 }
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+const maxDescriptionLength = 2000
+
+// DescribeHandler sets the description of a wallpaper, it's matched by the search
+func DescribeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID := r.FormValue("wallpaper_id")
+	description := strings.TrimSpace(r.FormValue("description"))
+	if wallpaperID == "" {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+	if len(description) > maxDescriptionLength {
+		http.Error(w, "Description too long (max 2000 characters)", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	err = db.QueryRow("SELECT user_id FROM wallpapers WHERE id = ?", wallpaperID).Scan(&ownerID)
+	if err != nil {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	if ownerID != userID {
+		log.Printf("⚠️ Unauthorized describe attempt: user %d tried to edit wallpaper owned by %d", userID, ownerID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	_, err = db.Exec("UPDATE wallpapers SET description = ? WHERE id = ?", nullIfEmpty(description), wallpaperID)
+	if err != nil {
+		log.Println("Failed to update description:", err)
+		http.Error(w, "Failed to update description", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("✅ Wallpaper %s described by user %d", wallpaperID, userID)
+	http.Redirect(w, r, redirectBack(r, "/wallpapers"), http.StatusSeeOther)
+}
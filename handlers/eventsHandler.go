@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const sseHeartbeat = 25 * time.Second
+
+// EventsHandler streams live updates with Server-Sent Events
+// URL format: /api/events?wallpaper_id=123
+//   - "comment" events for the given wallpaper (if wallpaper_id is set)
+//   - "notification" events for the logged-in user (if logged in)
+func EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	var topics []string
+	if raw := r.URL.Query().Get("wallpaper_id"); raw != "" {
+		wallpaperID, err := strconv.Atoi(raw)
+		if err != nil {
+			http.Error(w, "Invalid wallpaper ID", http.StatusBadRequest)
+			return
+		}
+		if visible, err := canViewWallpaper(r, wallpaperID); err != nil || !visible {
+			http.Error(w, "Wallpaper not found", http.StatusNotFound)
+			return
+		}
+		topics = append(topics, commentsTopic(wallpaperID))
+	}
+	if userID, err := getUserIDFromSession(r); err == nil {
+		topics = append(topics, userTopic(userID))
+	}
+	if len(topics) == 0 {
+		http.Error(w, "Nothing to subscribe to", http.StatusBadRequest)
+		return
+	}
+
+	// merge every subscription into one channel
+	events := make(chan Event, 16)
+	for _, topic := range topics {
+		ch, cancel := broker.Subscribe(topic)
+		defer cancel()
+		go func() {
+			for {
+				select {
+				case e := <-ch:
+					select {
+					case events <- e:
+					case <-r.Context().Done():
+						return
+					}
+				case <-r.Context().Done():
+					return
+				}
+			}
+		}()
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// tell the browser how long to wait before reconnecting
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			// comment line, keeps proxies from closing an idle connection
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case e := <-events:
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, e.Data); err != nil {
+				log.Println("SSE write error:", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
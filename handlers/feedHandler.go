@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"time"
+)
+
+type FeedPageData struct {
+	Username   string
+	IsAdmin    bool
+	Wallpapers []Wallpaper
+	Following  int
+	NextCursor string
+}
+
+const feedPageSize = 24
+
+// FeedHandler shows the newest published wallpapers of the users we follow
+// URL format: /feed?cursor=...
+func FeedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	after, afterArgs := cursor.where("w.published_at", "w.id")
+
+	args := append([]interface{}{user.UserID}, afterArgs...)
+	rows, err := db.Query(`
+		SELECT w.id, w.filename, w.original_name, w.uploaded_at, w.published_at, u.username
+		FROM wallpapers w
+		JOIN follows f ON f.followee_id = w.user_id AND f.follower_id = ?
+		JOIN users u ON u.id = w.user_id
+		WHERE w.status = 'approved' AND w.deleted_at IS NULL AND w.archived_at IS NULL AND w.published_at IS NOT NULL AND `+after+`
+		ORDER BY w.published_at DESC, w.id DESC
+		LIMIT ?
+	`, append(args, feedPageSize+1)...)
+	if err != nil {
+		log.Println("Failed to query feed:", err)
+		http.Error(w, "Failed to load feed", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	data := FeedPageData{
+		Username: user.Username,
+		IsAdmin:  user.IsAdmin,
+	}
+
+	var last Cursor
+	for rows.Next() {
+		var w Wallpaper
+		var publishedAt time.Time
+		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &publishedAt, &w.Owner); err != nil {
+			log.Println("Row scan error:", err)
+			continue
+		}
+		// one extra row was fetched to know if there's a next page
+		if len(data.Wallpapers) == feedPageSize {
+			data.NextCursor = last.String()
+			break
+		}
+		last = Cursor{Time: publishedAt, ID: w.ID}
+		data.Wallpapers = append(data.Wallpapers, w)
+	}
+
+	attachTags(data.Wallpapers)
+
+	if err := db.QueryRow("SELECT COUNT(*) FROM follows WHERE follower_id = ?", user.UserID).Scan(&data.Following); err != nil {
+		log.Println("Failed to count follows:", err)
+	}
+
+	if err := templates.ExecuteTemplate(w, "feed.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
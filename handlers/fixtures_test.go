@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useTemplates parses the pages as server.go does, some endpoints render HTML fragments
+func useTemplates(t *testing.T) {
+	t.Helper()
+	parsed, err := template.New("").
+		Funcs(template.FuncMap{
+			"add":        func(a, b int) int { return a + b },
+			"pathEscape": url.PathEscape,
+			"join":       strings.Join,
+		}).
+		ParseGlob("../web/html/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := templates
+	SetTemplates(parsed)
+	t.Cleanup(func() { templates = previous })
+}
+
+// useFixtureDB points the handlers at a database where every table is empty, see seedFixtureDB
+// to answer some queries
+func useFixtureDB(t *testing.T) {
+	t.Helper()
+	registerFixtureDriver.Do(func() { sql.Register("fixture", fixtureDriver{}) })
+	fixture, err := sql.Open("fixture", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := db
+	SetDB(fixture)
+	t.Cleanup(func() {
+		fixture.Close()
+		db = previous
+		takeFixtureExecs()
+		seedFixtureDB()
+	})
+}
+
+// fixtureAnswer answers the queries containing Match, spaces collapsed, with Rows. The
+// statements matching an answer report one row changed.
+type fixtureAnswer struct {
+	Match string
+	Rows  [][]driver.Value
+}
+
+var fixtureAnswers struct {
+	sync.Mutex
+	list []fixtureAnswer
+}
+
+// seedFixtureDB replaces the answers of the fixture database, the first match wins and the
+// other queries get no rows
+func seedFixtureDB(answers ...fixtureAnswer) {
+	fixtureAnswers.Lock()
+	defer fixtureAnswers.Unlock()
+	fixtureAnswers.list = answers
+}
+
+func fixtureAnswerFor(query string) (fixtureAnswer, bool) {
+	query = strings.Join(strings.Fields(query), " ")
+	fixtureAnswers.Lock()
+	defer fixtureAnswers.Unlock()
+	for _, a := range fixtureAnswers.list {
+		if strings.Contains(query, a.Match) {
+			return a, true
+		}
+	}
+	return fixtureAnswer{}, false
+}
+
+var registerFixtureDriver sync.Once
+
+// fixtureDriver answers the queries with the seeded rows, or none, and the statements with
+// nothing changed unless seeded. The statements are kept in fixtureExecs, for the tests
+// checking what was written.
+type fixtureDriver struct{}
+
+func (fixtureDriver) Open(string) (driver.Conn, error) { return fixtureConn{}, nil }
+
+type fixtureExec struct {
+	Query string
+	Args  []driver.Value
+}
+
+var fixtureExecs struct {
+	sync.Mutex
+	list []fixtureExec
+}
+
+// takeFixtureExecs returns the statements run since the last call
+func takeFixtureExecs() []fixtureExec {
+	fixtureExecs.Lock()
+	defer fixtureExecs.Unlock()
+	list := fixtureExecs.list
+	fixtureExecs.list = nil
+	return list
+}
+
+type fixtureConn struct{}
+
+func (fixtureConn) Prepare(query string) (driver.Stmt, error) { return fixtureStmt{query}, nil }
+func (fixtureConn) Close() error                              { return nil }
+func (fixtureConn) Begin() (driver.Tx, error)                 { return fixtureTx{}, nil }
+
+type fixtureTx struct{}
+
+func (fixtureTx) Commit() error   { return nil }
+func (fixtureTx) Rollback() error { return nil }
+
+type fixtureStmt struct {
+	query string
+}
+
+func (fixtureStmt) Close() error  { return nil }
+func (fixtureStmt) NumInput() int { return -1 }
+
+func (s fixtureStmt) Query([]driver.Value) (driver.Rows, error) {
+	a, _ := fixtureAnswerFor(s.query)
+	return &fixtureRows{rows: a.Rows}, nil
+}
+
+func (s fixtureStmt) Exec(args []driver.Value) (driver.Result, error) {
+	fixtureExecs.Lock()
+	fixtureExecs.list = append(fixtureExecs.list, fixtureExec{s.query, args})
+	fixtureExecs.Unlock()
+	_, seeded := fixtureAnswerFor(s.query)
+	return fixtureResult{seeded}, nil
+}
+
+type fixtureResult struct {
+	seeded bool
+}
+
+func (r fixtureResult) LastInsertId() (int64, error) { return r.RowsAffected() }
+
+func (r fixtureResult) RowsAffected() (int64, error) {
+	if r.seeded {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+type fixtureRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fixtureRows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	return make([]string, len(r.rows[0]))
+}
+
+func (r *fixtureRows) Close() error { return nil }
+
+func (r *fixtureRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// FollowHandler makes the current user follow the uploader named in the form
+func FollowHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if isBlocked(userID, targetID) {
+		http.Error(w, "You cannot follow this user", http.StatusForbidden)
+		return
+	}
+
+	result, err := db.Exec("INSERT IGNORE INTO follows (follower_id, followee_id) VALUES (?, ?)", userID, targetID)
+	if err != nil {
+		log.Println("Failed to follow user:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows > 0 {
+		log.Printf("User %d now follows %d", userID, targetID)
+		notify(targetID, userID, NotifFollow, 0, getUsername(userID)+" started following you")
+	}
+
+	http.Redirect(w, r, redirectBack(r, "/feed"), http.StatusSeeOther)
+}
+
+// UnfollowHandler stops following the user named in the form
+func UnfollowHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := followTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec("DELETE FROM follows WHERE follower_id = ? AND followee_id = ?", userID, targetID)
+	if err != nil {
+		log.Println("Failed to unfollow user:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d unfollowed %d", userID, targetID)
+	http.Redirect(w, r, redirectBack(r, "/feed"), http.StatusSeeOther)
+}
+
+// checks method + session and resolves "username" from the form
+func followTarget(w http.ResponseWriter, r *http.Request) (userID, targetID int, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, 0, false
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, 0, false
+	}
+
+	err = db.QueryRow("SELECT id FROM users WHERE username = ?", r.FormValue("username")).Scan(&targetID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return 0, 0, false
+	}
+
+	if targetID == userID {
+		http.Error(w, "You cannot follow yourself", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	return userID, targetID, true
+}
+
+// drops follows in both directions, used when one user blocks the other
+func removeFollowsBetween(a, b int) error {
+	_, err := db.Exec(`
+		DELETE FROM follows
+		WHERE (follower_id = ? AND followee_id = ?) OR (follower_id = ? AND followee_id = ?)
+	`, a, b, b, a)
+	return err
+}
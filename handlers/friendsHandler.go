@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type FriendsPageData struct {
+	Username string
+	IsAdmin  bool
+	Friends  []UserProfile
+	Incoming []UserProfile
+	Outgoing []UserProfile
+	Blocked  []UserProfile
+	Error    string
+}
+
+// FriendsHandler renders the friends page: friends, pending requests and blocked users
+func FriendsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	friends, err := listFriends(user.UserID)
+	if err != nil {
+		log.Println("Failed to query friends:", err)
+		http.Error(w, "Failed to load friends", http.StatusInternalServerError)
+		return
+	}
+
+	// requests sent to me / by me, and users I blocked
+	incoming, err := friendshipUsers("f.addressee_id = ? AND f.status = 'pending'", "f.requester_id", user.UserID)
+	if err != nil {
+		log.Println("Failed to query friend requests:", err)
+		http.Error(w, "Failed to load friends", http.StatusInternalServerError)
+		return
+	}
+	outgoing, err := friendshipUsers("f.requester_id = ? AND f.status = 'pending'", "f.addressee_id", user.UserID)
+	if err != nil {
+		log.Println("Failed to query friend requests:", err)
+		http.Error(w, "Failed to load friends", http.StatusInternalServerError)
+		return
+	}
+	blocked, err := friendshipUsers("f.requester_id = ? AND f.status = 'blocked'", "f.addressee_id", user.UserID)
+	if err != nil {
+		log.Println("Failed to query blocked users:", err)
+		http.Error(w, "Failed to load friends", http.StatusInternalServerError)
+		return
+	}
+
+	data := FriendsPageData{
+		Username: user.Username,
+		IsAdmin:  user.IsAdmin,
+		Friends:  friends,
+		Incoming: incoming,
+		Outgoing: outgoing,
+		Blocked:  blocked,
+		Error:    r.URL.Query().Get("error"),
+	}
+	if err := templates.ExecuteTemplate(w, "friends.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// FriendRequestHandler sends a friend request to the user named in the form
+func FriendRequestHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := friendActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if isBlocked(userID, targetID) {
+		http.Redirect(w, r, "/friends?error=You+cannot+send+a+request+to+this+user", http.StatusSeeOther)
+		return
+	}
+
+	id, requesterID, status, err := friendshipBetween(userID, targetID)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		log.Println("Database error:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	case status == FriendAccepted:
+		http.Redirect(w, r, "/friends", http.StatusSeeOther)
+		return
+	case status == FriendPending && requesterID == targetID:
+		// they already asked us: sending one back means yes
+		acceptFriendRequest(w, r, userID, targetID)
+		return
+	case status == FriendPending:
+		http.Redirect(w, r, "/friends", http.StatusSeeOther)
+		return
+	default:
+		// declined before, start over
+		if _, err := db.Exec("DELETE FROM friendships WHERE id = ?", id); err != nil {
+			log.Println("Database error:", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	_, err = db.Exec("INSERT INTO friendships (requester_id, addressee_id) VALUES (?, ?)", userID, targetID)
+	if err != nil {
+		log.Println("Failed to send friend request:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d sent a friend request to %d", userID, targetID)
+	notify(targetID, userID, NotifFriendRequest, 0, getUsername(userID)+" sent you a friend request")
+	http.Redirect(w, r, "/friends", http.StatusSeeOther)
+}
+
+// AcceptFriendHandler accepts a pending request sent to the current user
+func AcceptFriendHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := friendActionTarget(w, r)
+	if !ok {
+		return
+	}
+	acceptFriendRequest(w, r, userID, targetID)
+}
+
+func acceptFriendRequest(w http.ResponseWriter, r *http.Request, userID, requesterID int) {
+	result, err := db.Exec(`
+		UPDATE friendships SET status = 'accepted'
+		WHERE requester_id = ? AND addressee_id = ? AND status = 'pending'
+	`, requesterID, userID)
+	if err != nil {
+		log.Println("Failed to accept friend request:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		http.Error(w, "Friend request not found", http.StatusNotFound)
+		return
+	}
+
+	log.Printf("User %d accepted the friend request of %d", userID, requesterID)
+	notify(requesterID, userID, NotifFriendAccepted, 0, getUsername(userID)+" accepted your friend request")
+	http.Redirect(w, r, "/friends", http.StatusSeeOther)
+}
+
+// DeclineFriendHandler declines a pending request sent to the current user
+func DeclineFriendHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := friendActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec(`
+		UPDATE friendships SET status = 'declined'
+		WHERE requester_id = ? AND addressee_id = ? AND status = 'pending'
+	`, targetID, userID)
+	if err != nil {
+		log.Println("Failed to decline friend request:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/friends", http.StatusSeeOther)
+}
+
+// RemoveFriendHandler removes a friend (or cancels a request) and every share between the two users
+func RemoveFriendHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := friendActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec(`
+		DELETE FROM friendships
+		WHERE status IN ('pending', 'accepted')
+		AND ((requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?))
+	`, userID, targetID, targetID, userID)
+	if err == nil {
+		err = removeSharesBetween(userID, targetID)
+	}
+	if err != nil {
+		log.Println("Failed to remove friend:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d removed friend %d", userID, targetID)
+	http.Redirect(w, r, "/friends", http.StatusSeeOther)
+}
+
+// BlockUserHandler blocks a user: drops the friendship, pending requests, shares and follows
+func BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := friendActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	// keep a block the other user may have set on us
+	_, err := db.Exec(`
+		DELETE FROM friendships
+		WHERE ((requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?))
+		AND NOT (requester_id = ? AND status = 'blocked')
+	`, userID, targetID, targetID, userID, targetID)
+	if err == nil {
+		_, err = db.Exec(`
+			INSERT INTO friendships (requester_id, addressee_id, status) VALUES (?, ?, 'blocked')
+			ON DUPLICATE KEY UPDATE status = 'blocked'
+		`, userID, targetID)
+	}
+	if err == nil {
+		err = removeSharesBetween(userID, targetID)
+	}
+	if err == nil {
+		err = removeFollowsBetween(userID, targetID)
+	}
+	if err != nil {
+		log.Println("Failed to block user:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("User %d blocked %d", userID, targetID)
+	http.Redirect(w, r, redirectBack(r, "/friends"), http.StatusSeeOther)
+}
+
+// UnblockUserHandler removes a block set by the current user
+func UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, targetID, ok := friendActionTarget(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := db.Exec("DELETE FROM friendships WHERE requester_id = ? AND addressee_id = ? AND status = 'blocked'", userID, targetID)
+	if err != nil {
+		log.Println("Failed to unblock user:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/friends", http.StatusSeeOther)
+}
+
+// checks method + session and resolves the other user from "user_id" or "username".
+// writes the error response and returns ok=false when something is wrong.
+func friendActionTarget(w http.ResponseWriter, r *http.Request) (userID, targetID int, ok bool) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return 0, 0, false
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return 0, 0, false
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return 0, 0, false
+	}
+
+	if raw := r.FormValue("user_id"); raw != "" {
+		targetID, err = strconv.Atoi(raw)
+		if err == nil {
+			err = db.QueryRow("SELECT id FROM users WHERE id = ?", targetID).Scan(&targetID)
+		}
+	} else {
+		err = db.QueryRow("SELECT id FROM users WHERE username = ?", r.FormValue("username")).Scan(&targetID)
+	}
+	if err != nil {
+		http.Redirect(w, r, "/friends?error=User+not+found", http.StatusSeeOther)
+		return 0, 0, false
+	}
+
+	if targetID == userID {
+		http.Redirect(w, r, "/friends?error=That's+you!", http.StatusSeeOther)
+		return 0, 0, false
+	}
+
+	return userID, targetID, true
+}
+
+// returns the users on the other side (otherColumn) of the matching friendships of userID
+func friendshipUsers(where, otherColumn string, userID int) ([]UserProfile, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username
+		FROM friendships f
+		JOIN users u ON u.id = `+otherColumn+`
+		WHERE `+where+`
+		ORDER BY f.created_at DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserProfile
+	for rows.Next() {
+		var u UserProfile
+		if err := rows.Scan(&u.UserID, &u.Username); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// removes the "selected" shares between two users, in both directions
+func removeSharesBetween(a, b int) error {
+	_, err := db.Exec(`
+		DELETE s FROM wallpaper_shares s
+		JOIN wallpapers w ON w.id = s.wallpaper_id
+		WHERE (w.user_id = ? AND s.user_id = ?) OR (w.user_id = ? AND s.user_id = ?)
+	`, a, b, b, a)
+	return err
+}
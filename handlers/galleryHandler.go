@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+)
+
+type GalleryPage struct {
+	View       string      `json:"view"`
+	Wallpapers []Wallpaper `json:"wallpapers"`
+	HTML       string      `json:"html"` // the cards, rendered with the same template as the page
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+// GalleryAPIHandler returns the next page of a gallery for the infinite scroll
+// URL format: /api/gallery?view=community|wallpapers|archive|review&cursor=...&limit=24
+func GalleryAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := queryInt(r, "limit", galleryPageSize, 1, maxGalleryPageSize)
+
+	view := r.URL.Query().Get("view")
+	user := getCurrentUser(r)
+	if view != "community" && user == nil {
+		jsonError(w, http.StatusUnauthorized, "Please log in")
+		return
+	}
+
+	// the template gets the same data as the full page, so the cards are identical
+	var tmpl string
+	var data interface{}
+	var page GalleryPage
+	switch view {
+	case "community":
+		d, err := communityPage(user, cursor, limit)
+		if err != nil {
+			log.Println("Failed to query wallpapers:", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to load wallpapers")
+			return
+		}
+		tmpl, data = "community-cards", d
+		page.Wallpapers, page.NextCursor = d.Wallpapers, d.NextCursor
+	case "wallpapers", "archive":
+		d, err := myWallpapersPage(user, cursor, limit, view == "archive")
+		if err != nil {
+			log.Println("Failed to query wallpapers:", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to load wallpapers")
+			return
+		}
+		tmpl, data = "wallpapers-cards", d
+		page.Wallpapers, page.NextCursor = d.Wallpapers, d.NextCursor
+	case "review":
+		if !user.IsAdmin {
+			jsonError(w, http.StatusForbidden, "Admin access required")
+			return
+		}
+		wallpapers, next, err := reviewPage(cursor, limit)
+		if err != nil {
+			log.Println("Failed to query wallpapers:", err)
+			jsonError(w, http.StatusInternalServerError, "Failed to load wallpapers")
+			return
+		}
+		tmpl, data = "review-cards", AdminPanelData{CurrentUser: user, Wallpapers: wallpapers}
+		page.Wallpapers, page.NextCursor = wallpapers, next
+	default:
+		jsonError(w, http.StatusBadRequest, "view must be community, wallpapers, archive or review")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, tmpl, data); err != nil {
+		log.Println("Template error:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to render wallpapers")
+		return
+	}
+
+	page.View = view
+	page.HTML = buf.String()
+	if page.Wallpapers == nil {
+		page.Wallpapers = []Wallpaper{}
+	}
+	writeJSON(w, http.StatusOK, page)
+}
@@ -0,0 +1,97 @@
+// / this file contains the pub/sub hub that feeds the live updates (SSE) endpoint
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+)
+
+// Event is one message pushed to subscribers, Data is already JSON so any broker can carry it
+type Event struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Broker fans events out to subscribers of a topic.
+// The default one lives in memory, so it only reaches clients connected to this instance.
+// When running several instances, plug a db-polling or broker-backed (redis, nats..) one with SetBroker.
+type Broker interface {
+	Publish(topic string, event Event)
+	// Subscribe returns the event channel and a func to call when done listening
+	Subscribe(topic string) (<-chan Event, func())
+}
+
+var broker Broker = NewMemoryHub()
+
+func SetBroker(b Broker) {
+	broker = b
+}
+
+// topics
+func commentsTopic(wallpaperID int) string {
+	return fmt.Sprintf("wallpaper:%d:comments", wallpaperID)
+}
+
+func userTopic(userID int) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+// publishes v as JSON under the given event type
+func publishEvent(topic, kind string, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Failed to encode event:", err)
+		return
+	}
+	broker.Publish(topic, Event{Type: kind, Data: data})
+}
+
+// MemoryHub is the in-process Broker
+type MemoryHub struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan Event]struct{}
+}
+
+func NewMemoryHub() *MemoryHub {
+	return &MemoryHub{subscribers: make(map[string]map[chan Event]struct{})}
+}
+
+func (h *MemoryHub) Publish(topic string, event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers[topic] {
+		// never block the publisher on a slow client, it just misses the event
+		select {
+		case ch <- event:
+		default:
+			log.Println("Dropped event for slow subscriber on", topic)
+		}
+	}
+}
+
+func (h *MemoryHub) Subscribe(topic string) (<-chan Event, func()) {
+	ch := make(chan Event, 16)
+
+	h.mu.Lock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = make(map[chan Event]struct{})
+	}
+	h.subscribers[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[topic], ch)
+			if len(h.subscribers[topic]) == 0 {
+				delete(h.subscribers, topic)
+			}
+			h.mu.Unlock()
+		})
+	}
+	return ch, cancel
+}
@@ -0,0 +1,159 @@
+// / this file contains the image analysis done at upload: resolution and dominant color
+package handlers
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+)
+
+type ImageInfo struct {
+	Width         int
+	Height        int
+	DominantColor string // #rrggbb, empty when the format can't be decoded (webp)
+	ColorName     string // one of ColorNames
+}
+
+// color buckets, used by the search color filter
+var ColorNames = []string{"red", "orange", "yellow", "green", "cyan", "blue", "purple", "pink", "brown", "black", "white", "gray"}
+
+// number of pixels sampled on each axis for the dominant color
+const colorSamples = 64
+
+// the largest image decoded, a few KB of PNG can declare billions of pixels
+const maxImagePixels = 100_000_000
+
+var errImageTooLarge = fmt.Errorf("image too large (max %d megapixels)", maxImagePixels/1_000_000)
+
+// analyzeImage reads the resolution and the dominant color of an image file
+func analyzeImage(path string) (ImageInfo, error) {
+	var info ImageInfo
+
+	f, err := os.Open(path)
+	if err != nil {
+		return info, err
+	}
+	defer f.Close()
+
+	// the header first: the size is checked before anything is allocated for the pixels
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return info, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return info, errImageTooLarge
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return info, err
+	}
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return info, err
+	}
+	bounds := img.Bounds()
+	info.Width, info.Height = bounds.Dx(), bounds.Dy()
+	if info.Width == 0 || info.Height == 0 {
+		return info, nil
+	}
+
+	// sample a grid of pixels, the most common bucket wins and its average is the color
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[string]*bucket)
+	for sy := 0; sy < colorSamples; sy++ {
+		y := bounds.Min.Y + sy*info.Height/colorSamples
+		for sx := 0; sx < colorSamples; sx++ {
+			x := bounds.Min.X + sx*info.Width/colorSamples
+			r32, g32, b32, a32 := img.At(x, y).RGBA()
+			if a32 < 0x8000 {
+				continue // mostly transparent
+			}
+			r, g, b := int(r32>>8), int(g32>>8), int(b32>>8)
+
+			name := colorName(r, g, b)
+			bk := buckets[name]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[name] = bk
+			}
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+		}
+	}
+
+	var best *bucket
+	for _, name := range ColorNames {
+		if bk := buckets[name]; bk != nil && (best == nil || bk.count > best.count) {
+			best = bk
+			info.ColorName = name
+		}
+	}
+	if best != nil {
+		info.DominantColor = fmt.Sprintf("#%02x%02x%02x", best.r/best.count, best.g/best.count, best.b/best.count)
+	}
+	return info, nil
+}
+
+// colorName puts an 8-bit RGB color in one of the ColorNames buckets, using its hue/saturation/value
+func colorName(r, g, b int) string {
+	maxC := max(r, g, b)
+	minC := min(r, g, b)
+	value := float64(maxC) / 255
+	saturation := 0.0
+	if maxC > 0 {
+		saturation = float64(maxC-minC) / float64(maxC)
+	}
+
+	switch {
+	case value < 0.2:
+		return "black"
+	case saturation < 0.15 && value > 0.85:
+		return "white"
+	case saturation < 0.15:
+		return "gray"
+	}
+
+	var hue float64
+	delta := float64(maxC - minC)
+	switch maxC {
+	case r:
+		hue = 60 * (float64(g-b) / delta)
+	case g:
+		hue = 60 * (2 + float64(b-r)/delta)
+	default:
+		hue = 60 * (4 + float64(r-g)/delta)
+	}
+	if hue < 0 {
+		hue += 360
+	}
+
+	switch {
+	case hue < 15 || hue >= 335:
+		return "red"
+	case hue < 45 && value < 0.6:
+		return "brown"
+	case hue < 45:
+		return "orange"
+	case hue < 70:
+		return "yellow"
+	case hue < 170:
+		return "green"
+	case hue < 200:
+		return "cyan"
+	case hue < 260:
+		return "blue"
+	case hue < 290:
+		return "purple"
+	default:
+		return "pink"
+	}
+}
@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// moderation states of a wallpaper (wallpapers.status)
+const (
+	StatusPrivate     = "private"
+	StatusPending     = "pending"
+	StatusApproved    = "approved"
+	StatusRejected    = "rejected"
+	StatusScheduled   = "scheduled" // approved, waiting for its publish_at
+	StatusUnpublished = "unpublished"
+)
+
+const maxReasonLength = 500
+
+// who may perform a transition
+const (
+	byOwner = 1 << iota
+	byAdmin
+	byScheduler
+)
+
+// allowed transitions: from -> to -> who
+var transitions = map[string]map[string]int{
+	StatusPrivate:     {StatusPending: byOwner},
+	StatusPending:     {StatusPrivate: byOwner, StatusApproved: byAdmin, StatusScheduled: byAdmin, StatusRejected: byAdmin},
+	StatusScheduled:   {StatusApproved: byScheduler, StatusUnpublished: byOwner | byAdmin},
+	StatusApproved:    {StatusUnpublished: byOwner | byAdmin | byScheduler},
+	StatusRejected:    {StatusPending: byOwner, StatusPrivate: byOwner},
+	StatusUnpublished: {StatusPending: byOwner, StatusPrivate: byOwner},
+}
+
+// the actor of the transitions made by the scheduler (see scheduler.go)
+var schedulerActor = &UserProfile{Username: "scheduler"}
+
+var (
+	errInvalidTransition = errors.New("this change is not possible from the current state")
+	errTransitionDenied  = errors.New("you are not allowed to make this change")
+	errReasonRequired    = errors.New("a reason is required to reject a wallpaper")
+	errReasonTooLong     = fmt.Errorf("the reason is too long (max %d characters)", maxReasonLength)
+)
+
+// one row of wallpaper_transitions
+type Transition struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// transitionRule returns the rule of who that lets actor make a transition on a wallpaper of
+// ownerID, 0 if none does. The admin rule comes last: it's only used when no other one applies.
+func transitionRule(who int, actor *UserProfile, ownerID int) int {
+	switch {
+	case who&byOwner != 0 && actor != schedulerActor && actor.UserID == ownerID:
+		return byOwner
+	case who&byScheduler != 0 && actor == schedulerActor:
+		return byScheduler
+	case who&byAdmin != 0 && actor.IsAdmin:
+		return byAdmin
+	}
+	return 0
+}
+
+// transitionWallpaper moves a wallpaper to another state, if the actor is allowed to,
+// records it in the history and notifies the owner and the webhooks. Approving a wallpaper with a publish_at
+// in the future schedules it instead, the returned state is the one it ended in, with the rule that allowed it.
+// A schedule given with an approval is stored as the publish_at in the same transaction, nil keeps the stored one.
+func transitionWallpaper(wallpaperID int, actor *UserProfile, to, reason string, schedule *time.Time) (string, int, error) {
+	reason = strings.TrimSpace(reason)
+	if to == StatusRejected && reason == "" {
+		return "", 0, errReasonRequired
+	}
+	if len(reason) > maxReasonLength {
+		return "", 0, errReasonTooLong
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", 0, err
+	}
+	defer tx.Rollback()
+
+	var ownerID int
+	var from string
+	var publishAt sql.NullTime
+	err = tx.QueryRow("SELECT user_id, status, publish_at FROM wallpapers WHERE id = ? AND deleted_at IS NULL FOR UPDATE", wallpaperID).
+		Scan(&ownerID, &from, &publishAt)
+	if err != nil {
+		return "", 0, err
+	}
+
+	if to == StatusApproved && schedule != nil {
+		publishAt = sql.NullTime{Time: *schedule, Valid: true}
+	} else {
+		schedule = nil
+	}
+	if to == StatusApproved && actor != schedulerActor && publishAt.Valid && publishAt.Time.After(time.Now()) {
+		to = StatusScheduled
+	}
+
+	who, ok := transitions[from][to]
+	if !ok {
+		return "", 0, errInvalidTransition
+	}
+	rule := transitionRule(who, actor, ownerID)
+	if rule == 0 {
+		return "", 0, errTransitionDenied
+	}
+
+	// the rejection reason stays visible to the uploader until the next transition
+	rejection := ""
+	if to == StatusRejected {
+		rejection = reason
+	}
+	// an unpublish_at that was applied, or is already past when approving, is dropped:
+	// it would take the wallpaper down again on the next run of the scheduler
+	clearUnpublish := to == StatusUnpublished && actor == schedulerActor
+	_, err = tx.Exec(`
+		UPDATE wallpapers
+		SET status = ?, rejection_reason = ?, published_at = IF(? = 'approved', NOW(), published_at),
+			unpublish_at = IF(? OR (? = 'approved' AND unpublish_at <= NOW()), NULL, unpublish_at),
+			publish_at = COALESCE(?, publish_at)
+		WHERE id = ?
+	`, to, nullIfEmpty(rejection), to, clearUnpublish, to, schedule, wallpaperID)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var actorID interface{}
+	if actor != schedulerActor {
+		actorID = actor.UserID
+	}
+	_, err = tx.Exec(`
+		INSERT INTO wallpaper_transitions (wallpaper_id, actor_id, from_status, to_status, reason)
+		VALUES (?, ?, ?, ?, ?)
+	`, wallpaperID, actorID, from, to, nullIfEmpty(reason))
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", 0, err
+	}
+	log.Printf("Wallpaper %d: %s -> %s by %s", wallpaperID, from, to, actor.Username)
+
+	switch {
+	case to == StatusApproved && from == StatusScheduled:
+		notify(ownerID, 0, NotifApproved, wallpaperID, "Your scheduled wallpaper is now public!")
+		evaluateBadges(BadgeEventPublish, ownerID)
+		emitWallpaperEvent(EventWallpaperPublished, wallpaperID, nil, "")
+	case to == StatusApproved:
+		notify(ownerID, actor.UserID, NotifApproved, wallpaperID, "Your wallpaper was approved and is now public!")
+		evaluateBadges(BadgeEventPublish, ownerID)
+		emitWallpaperEvent(EventWallpaperPublished, wallpaperID, actor, "")
+	case to == StatusScheduled:
+		notify(ownerID, actor.UserID, NotifApproved, wallpaperID,
+			"Your wallpaper was approved and will be public on "+publishAt.Time.UTC().Format("Jan 2, 2006 at 3:04 PM")+" UTC")
+	case to == StatusRejected:
+		notify(ownerID, actor.UserID, NotifDenied, wallpaperID, truncate("Your wallpaper was not approved: "+reason, 255))
+		emitWallpaperEvent(EventWallpaperRejected, wallpaperID, actor, reason)
+	}
+	return to, rule, nil
+}
+
+// cuts s to at most n bytes without splitting a character
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	n -= len("...")
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + "..."
+}
+
+// returns the history of a wallpaper, oldest first
+func wallpaperTransitions(wallpaperID int) ([]Transition, error) {
+	rows, err := db.Query(`
+		SELECT t.from_status, t.to_status, COALESCE(u.username, ''), COALESCE(t.reason, ''), t.created_at
+		FROM wallpaper_transitions t
+		LEFT JOIN users u ON u.id = t.actor_id
+		WHERE t.wallpaper_id = ?
+		ORDER BY t.created_at, t.id
+	`, wallpaperID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []Transition
+	for rows.Next() {
+		var t Transition
+		if err := rows.Scan(&t.From, &t.To, &t.Actor, &t.Reason, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, t)
+	}
+	return history, rows.Err()
+}
+
+// moderateWallpaper moves a wallpaper from its current state to to(current) for the actor of r.
+// Decisions allowed by the admin rule are privileged and go to the audit log, on the admin's own
+// wallpapers too. schedule is passed on to transitionWallpaper.
+func moderateWallpaper(r *http.Request, actor *UserProfile, wallpaperID int, to func(current string) string, reason string, schedule *time.Time) (string, error) {
+	var current string
+	err := db.QueryRow("SELECT status FROM wallpapers WHERE id = ? AND deleted_at IS NULL", wallpaperID).Scan(&current)
+	if err != nil {
+		return "", err
+	}
+
+	target, rule, err := transitionWallpaper(wallpaperID, actor, to(current), reason, schedule)
+	if err != nil {
+		return "", err
+	}
+	if rule == byAdmin {
+		audit(r, actor, AuditModeratePrefix+target, AuditTargetWallpaper, wallpaperID,
+			map[string]string{"status": current}, map[string]string{"status": target, "reason": strings.TrimSpace(reason)})
+	}
+	return target, nil
+}
+
+// moderate handles the form posts of the moderation buttons: wallpaper_id (+ reason) -> to,
+// schedule is the publish_at of an approval (nil for none)
+func moderate(w http.ResponseWriter, r *http.Request, to func(current string) string, schedule *time.Time, fallback string) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	_, err = moderateWallpaper(r, user, wallpaperID, to, r.FormValue("reason"), schedule)
+	switch {
+	case err == nil:
+		http.Redirect(w, r, redirectBack(r, fallback), http.StatusSeeOther)
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+	case errors.Is(err, errTransitionDenied):
+		log.Printf("⚠️ Unauthorized moderation attempt: user %d on wallpaper %d", user.UserID, wallpaperID)
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, errInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errReasonRequired), errors.Is(err, errReasonTooLong):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Println("Failed to change wallpaper status:", err)
+		http.Error(w, "Failed to change wallpaper status", http.StatusInternalServerError)
+	}
+}
+
+type HistoryPageData struct {
+	Username  string
+	IsAdmin   bool
+	Wallpaper Wallpaper
+	History   []Transition
+}
+
+// HistoryHandler shows the moderation history of a wallpaper to its owner and the admins
+// URL format: /history?id=42
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	data := HistoryPageData{Username: user.Username, IsAdmin: user.IsAdmin}
+	wp := &data.Wallpaper
+	err = db.QueryRow(`
+		SELECT id, user_id, filename, original_name, status, COALESCE(rejection_reason, '')
+		FROM wallpapers WHERE id = ?
+	`, id).Scan(&wp.ID, &wp.UserID, &wp.Filename, &wp.OriginalName, &wp.Status, &wp.RejectionReason)
+	if err != nil {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	if wp.UserID != user.UserID && !user.IsAdmin {
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	data.History, err = wallpaperTransitions(id)
+	if err != nil {
+		log.Println("Failed to query the moderation history:", err)
+		http.Error(w, "Failed to load the history", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.ExecuteTemplate(w, "history.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,190 @@
+// / this file contains the notification service used by the other handlers to record events
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// notification types, also used as keys for the per-user preferences
+const (
+	NotifComment  = "comment"
+	NotifReply    = "reply"
+	NotifApproved = "publish_approved"
+	NotifDenied   = "publish_denied"
+	NotifFavorite = "favorite"
+
+	NotifFriendRequest  = "friend_request"
+	NotifFriendAccepted = "friend_accepted"
+	NotifShared         = "shared"
+	NotifFollow         = "follow"
+	NotifBadge          = "badge"
+)
+
+// NotificationTypes lists every type with the label shown on the preferences form
+var NotificationTypes = []NotificationType{
+	{Key: NotifComment, Label: "Someone comments on my wallpaper"},
+	{Key: NotifReply, Label: "Someone replies to my comment"},
+	{Key: NotifApproved, Label: "My wallpaper is approved"},
+	{Key: NotifDenied, Label: "My wallpaper is denied"},
+	{Key: NotifFavorite, Label: "Someone favorites my wallpaper"},
+	{Key: NotifFriendRequest, Label: "Someone sends me a friend request"},
+	{Key: NotifFriendAccepted, Label: "Someone accepts my friend request"},
+	{Key: NotifShared, Label: "A friend shares a wallpaper with me"},
+	{Key: NotifFollow, Label: "Someone starts following me"},
+	{Key: NotifBadge, Label: "I earn a badge"},
+}
+
+type NotificationType struct {
+	Key   string
+	Label string
+}
+
+type Notification struct {
+	ID          int       `json:"id"`
+	Type        string    `json:"type"`
+	Actor       string    `json:"actor,omitempty"`
+	WallpaperID int       `json:"wallpaper_id,omitempty"`
+	Message     string    `json:"message"`
+	IsRead      bool      `json:"is_read"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// notify records a notification for userID, unless the user is the actor or disabled that type
+func notify(userID, actorID int, kind string, wallpaperID int, message string) {
+	if userID == 0 || userID == actorID {
+		return
+	}
+
+	enabled, err := notificationEnabled(userID, kind)
+	if err != nil {
+		log.Println("Failed to read notification preferences:", err)
+		return
+	}
+	if !enabled {
+		return
+	}
+
+	var actor, wallpaper interface{}
+	if actorID != 0 {
+		actor = actorID
+	}
+	if wallpaperID != 0 {
+		wallpaper = wallpaperID
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO notifications (user_id, actor_id, wallpaper_id, type, message)
+		VALUES (?, ?, ?, ?, ?)
+	`, userID, actor, wallpaper, kind, message)
+	if err != nil {
+		log.Println("Failed to save notification:", err)
+		return
+	}
+
+	// push it to the user's open pages
+	id, _ := result.LastInsertId()
+	n := Notification{
+		ID:          int(id),
+		Type:        kind,
+		WallpaperID: wallpaperID,
+		Message:     message,
+		CreatedAt:   time.Now(),
+	}
+	if actorID != 0 {
+		n.Actor = getUsername(actorID)
+	}
+	publishEvent(userTopic(userID), "notification", n)
+}
+
+// no row in notification_preferences means the type is enabled
+func notificationEnabled(userID int, kind string) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled FROM notification_preferences WHERE user_id = ? AND type = ?", userID, kind).
+		Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return enabled, nil
+}
+
+// returns type -> enabled for every known type
+func notificationPreferences(userID int) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[t.Key] = true
+	}
+
+	rows, err := db.Query("SELECT type, enabled FROM notification_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var enabled bool
+		if err := rows.Scan(&kind, &enabled); err != nil {
+			return nil, err
+		}
+		if _, known := prefs[kind]; known {
+			prefs[kind] = enabled
+		}
+	}
+	return prefs, rows.Err()
+}
+
+func setNotificationPreferences(userID int, prefs map[string]bool) error {
+	for _, t := range NotificationTypes {
+		enabled, ok := prefs[t.Key]
+		if !ok {
+			continue
+		}
+		_, err := db.Exec(`
+			INSERT INTO notification_preferences (user_id, type, enabled)
+			VALUES (?, ?, ?)
+			ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)
+		`, userID, t.Key, enabled)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns one page of notifications, newest first
+func listNotifications(userID, limit, offset int) ([]Notification, error) {
+	rows, err := db.Query(`
+		SELECT n.id, n.type, COALESCE(u.username, ''), COALESCE(n.wallpaper_id, 0), n.message, n.is_read, n.created_at
+		FROM notifications n
+		LEFT JOIN users u ON n.actor_id = u.id
+		WHERE n.user_id = ?
+		ORDER BY n.created_at DESC, n.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.Actor, &n.WallpaperID, &n.Message, &n.IsRead, &n.CreatedAt); err != nil {
+			log.Println("Row scan error:", err)
+			continue
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+func unreadNotificationCount(userID int) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = 0", userID).Scan(&count)
+	return count, err
+}
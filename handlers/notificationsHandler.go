@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type NotificationsResponse struct {
+	UnreadCount   int            `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+	Page          int            `json:"page"`
+	HasMore       bool           `json:"has_more"`
+}
+
+type MarkReadRequest struct {
+	IDs []int `json:"ids"`
+	All bool  `json:"all"`
+}
+
+type NotificationsPageData struct {
+	Username      string
+	IsAdmin       bool
+	Notifications []Notification
+	Types         []NotificationType
+	Preferences   map[string]bool
+	Page          int
+	HasMore       bool
+}
+
+const notificationsPerPage = 20
+
+// GetNotificationsHandler returns a page of the user's notifications + unread count
+// URL format: /api/notifications?page=1&limit=20
+func GetNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Please log in"})
+		return
+	}
+
+	page := queryInt(r, "page", 1, 1, 1<<20)
+	limit := queryInt(r, "limit", notificationsPerPage, 1, 50)
+
+	// fetch one extra row to know if there's a next page
+	notifications, err := listNotifications(userID, limit+1, (page-1)*limit)
+	if err != nil {
+		log.Println("Failed to query notifications:", err)
+		http.Error(w, "Failed to load notifications", http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := unreadNotificationCount(userID)
+	if err != nil {
+		log.Println("Failed to count notifications:", err)
+		http.Error(w, "Failed to load notifications", http.StatusInternalServerError)
+		return
+	}
+
+	resp := NotificationsResponse{
+		UnreadCount:   unread,
+		Notifications: notifications,
+		Page:          page,
+	}
+	if len(notifications) > limit {
+		resp.Notifications = notifications[:limit]
+		resp.HasMore = true
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// MarkNotificationsReadHandler marks the given notifications (or all of them) as read
+func MarkNotificationsReadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Please log in"})
+		return
+	}
+
+	var req MarkReadRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.All {
+		_, err = db.Exec("UPDATE notifications SET is_read = 1 WHERE user_id = ? AND is_read = 0", userID)
+	} else {
+		for _, id := range req.IDs {
+			// user_id in the WHERE so nobody can mark someone else's notifications
+			_, err = db.Exec("UPDATE notifications SET is_read = 1 WHERE id = ? AND user_id = ?", id, userID)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		log.Println("Failed to mark notifications as read:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	unread, err := unreadNotificationCount(userID)
+	if err != nil {
+		log.Println("Failed to count notifications:", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"success":      true,
+		"unread_count": unread,
+	})
+}
+
+// NotificationPreferencesHandler reads (GET) or updates (POST) the per-type preferences as JSON
+func NotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "Please log in"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var prefs map[string]bool
+		if err := json.NewDecoder(r.Body).Decode(&prefs); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := setNotificationPreferences(userID, prefs); err != nil {
+			log.Println("Failed to save notification preferences:", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	prefs, err := notificationPreferences(userID)
+	if err != nil {
+		log.Println("Failed to read notification preferences:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+// NotificationsHandler renders the "all notifications" page, POST saves the preferences form
+func NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid form", http.StatusBadRequest)
+			return
+		}
+
+		// unchecked checkboxes are not sent, so every known type is set explicitly
+		prefs := make(map[string]bool, len(NotificationTypes))
+		for _, t := range NotificationTypes {
+			prefs[t.Key] = r.FormValue(t.Key) == "on"
+		}
+		if err := setNotificationPreferences(user.UserID, prefs); err != nil {
+			log.Println("Failed to save notification preferences:", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+
+		http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+		return
+	}
+
+	page := queryInt(r, "page", 1, 1, 1<<20)
+	notifications, err := listNotifications(user.UserID, notificationsPerPage+1, (page-1)*notificationsPerPage)
+	if err != nil {
+		log.Println("Failed to query notifications:", err)
+		http.Error(w, "Failed to load notifications", http.StatusInternalServerError)
+		return
+	}
+
+	prefs, err := notificationPreferences(user.UserID)
+	if err != nil {
+		log.Println("Failed to read notification preferences:", err)
+		http.Error(w, "Failed to load notifications", http.StatusInternalServerError)
+		return
+	}
+
+	data := NotificationsPageData{
+		Username:      user.Username,
+		IsAdmin:       user.IsAdmin,
+		Notifications: notifications,
+		Types:         NotificationTypes,
+		Preferences:   prefs,
+		Page:          page,
+	}
+	if len(notifications) > notificationsPerPage {
+		data.Notifications = notifications[:notificationsPerPage]
+		data.HasMore = true
+	}
+
+	if err := templates.ExecuteTemplate(w, "notifications.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// returns the int query param or def when missing/invalid, clamped to [min, max]
+func queryInt(r *http.Request, name string, def, min, max int) int {
+	v, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil {
+		return def
+	}
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
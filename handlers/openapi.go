@@ -0,0 +1,477 @@
+// / this file contains the OpenAPI 3.1 document of the JSON endpoints, generated from the handlers
+// / and their request/response types (openapi_test.go checks that the handlers still answer what it says)
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// media types of the bodies
+const (
+	mediaJSON      = "application/json"
+	mediaText      = "text/plain"
+	mediaSSE       = "text/event-stream"
+	mediaMultipart = "multipart/form-data"
+)
+
+// apiBody is a request or response body: its media type and a value of its Go type,
+// or a ready-made schema (map[string]interface{}) for the ad-hoc ones
+type apiBody struct {
+	Media  string
+	Schema interface{}
+}
+
+type apiParam struct {
+	Name        string
+	In          string // path or query
+	Type        string // string, integer or boolean
+	Description string
+}
+
+// apiOperation documents one method + path of the API
+type apiOperation struct {
+	Method    string
+	Path      string // OpenAPI template, e.g. /api/comments/{id}
+	Tag       string
+	Summary   string
+	Handler   http.HandlerFunc
+	Auth      bool // needs a session, or a personal token under /api/v1
+	Params    []apiParam
+	Request   *apiBody
+	Responses map[int]apiBody
+	Probe     string // query string added to the request of TestAPISpec
+}
+
+// shorthands for the tables below
+var (
+	textErr    = apiBody{mediaText, ""}
+	jsonErr    = apiBody{mediaJSON, ErrorResponse{}}
+	v1Err      = apiBody{mediaJSON, APIError{}}
+	noContent  = apiBody{}
+	idParam    = apiParam{"id", "path", "integer", "wallpaper id"}
+	collParam  = apiParam{"id", "path", "integer", "collection id"}
+	cursorArgs = []apiParam{
+		{"cursor", "query", "string", "next_cursor of the previous page"},
+		{"limit", "query", "integer", "page size, 1 to 100"},
+	}
+	fieldsParam       = apiParam{"fields", "query", "string", "comma separated Wallpaper fields to return, all by default"}
+	uploadIDParam     = apiParam{"id", "path", "string", "upload id, the end of the Location of the creation"}
+	tusResumableParam = apiParam{"Tus-Resumable", "header", "string", "1.0.0, required"}
+)
+
+func jsonBody(v interface{}) apiBody { return apiBody{mediaJSON, v} }
+
+// apiOperations lists every JSON endpoint. A new endpoint, or a new status code or body
+// in an existing one, goes here too: TestAPISpec fails otherwise.
+var apiOperations = []apiOperation{
+	{
+		Method: "GET", Path: "/api/comments/{id}", Tag: "comments", Summary: "Comments of a wallpaper, newest first",
+		Handler: GetCommentsHandler, Params: []apiParam{idParam},
+		Responses: map[int]apiBody{200: jsonBody([]Comment{}), 400: textErr, 404: textErr, 405: textErr, 500: textErr},
+	},
+	{
+		Method: "POST", Path: "/api/comments", Tag: "comments", Summary: "Post a comment or a reply",
+		Handler: PostCommentHandler, Auth: true, Request: &apiBody{mediaJSON, CommentRequest{}},
+		Responses: map[int]apiBody{
+			201: jsonBody(objectSchema(map[string]interface{}{"success": typeSchema("boolean"), "id": typeSchema("integer")}, "success", "id")),
+			400: textErr,
+			401: jsonBody(objectSchema(map[string]interface{}{"error": typeSchema("string"), "details": typeSchema("string")}, "error")),
+			404: textErr, 405: textErr, 500: textErr,
+		},
+	},
+	{
+		Method: "GET", Path: "/api/notifications", Tag: "notifications", Summary: "A page of the user's notifications and the unread count",
+		Handler: GetNotificationsHandler, Auth: true,
+		Params:    []apiParam{{"page", "query", "integer", "from 1"}, {"limit", "query", "integer", "page size, 1 to 50"}},
+		Responses: map[int]apiBody{200: jsonBody(NotificationsResponse{}), 401: jsonErr, 405: textErr, 500: textErr},
+	},
+	{
+		Method: "POST", Path: "/api/notifications/read", Tag: "notifications", Summary: "Mark notifications as read",
+		Handler: MarkNotificationsReadHandler, Auth: true, Request: &apiBody{mediaJSON, MarkReadRequest{}},
+		Responses: map[int]apiBody{
+			200: jsonBody(objectSchema(map[string]interface{}{"success": typeSchema("boolean"), "unread_count": typeSchema("integer")}, "success", "unread_count")),
+			400: textErr, 401: jsonErr, 405: textErr, 500: textErr,
+		},
+	},
+	{
+		Method: "GET", Path: "/api/notifications/preferences", Tag: "notifications", Summary: "Notification preferences, by type",
+		Handler: NotificationPreferencesHandler, Auth: true,
+		Responses: map[int]apiBody{200: jsonBody(map[string]bool{}), 401: jsonErr, 500: textErr},
+	},
+	{
+		Method: "POST", Path: "/api/notifications/preferences", Tag: "notifications", Summary: "Update notification preferences",
+		Handler: NotificationPreferencesHandler, Auth: true, Request: &apiBody{mediaJSON, map[string]bool{}},
+		Responses: map[int]apiBody{200: jsonBody(map[string]bool{}), 400: textErr, 401: jsonErr, 500: textErr},
+	},
+	{
+		Method: "GET", Path: "/api/events", Tag: "events", Summary: "Server-Sent Events: comments of a wallpaper and the user's notifications",
+		Handler: EventsHandler, Params: []apiParam{{"wallpaper_id", "query", "integer", "stream its comments"}},
+		Responses: map[int]apiBody{200: {mediaSSE, ""}, 400: textErr, 404: textErr, 405: textErr, 500: textErr},
+	},
+	{
+		Method: "GET", Path: "/api/collections", Tag: "collections", Summary: "The user's collections",
+		Handler: CollectionsAPIHandler, Auth: true,
+		Responses: map[int]apiBody{200: jsonBody([]Collection{}), 401: jsonErr, 405: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "POST", Path: "/api/collections", Tag: "collections", Summary: "Create a collection",
+		Handler: CollectionsAPIHandler, Auth: true, Request: &apiBody{mediaJSON, CollectionRequest{}},
+		Responses: map[int]apiBody{201: jsonBody(Collection{}), 400: jsonErr, 401: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "GET", Path: "/api/collections/{id}", Tag: "collections", Summary: "A collection with its items",
+		Handler: CollectionsAPIHandler, Params: []apiParam{collParam},
+		Responses: map[int]apiBody{200: jsonBody(Collection{}), 404: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "PATCH", Path: "/api/collections/{id}", Tag: "collections", Summary: "Update a collection",
+		Handler: CollectionsAPIHandler, Auth: true, Params: []apiParam{collParam}, Request: &apiBody{mediaJSON, CollectionRequest{}},
+		Responses: map[int]apiBody{200: jsonBody(Collection{}), 400: jsonErr, 401: jsonErr, 403: jsonErr, 404: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "DELETE", Path: "/api/collections/{id}", Tag: "collections", Summary: "Delete a collection",
+		Handler: CollectionsAPIHandler, Auth: true, Params: []apiParam{collParam},
+		Responses: map[int]apiBody{204: noContent, 401: jsonErr, 403: jsonErr, 404: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "POST", Path: "/api/collections/{id}/items", Tag: "collections", Summary: "Add a wallpaper to a collection",
+		Handler: CollectionsAPIHandler, Auth: true, Params: []apiParam{collParam}, Request: &apiBody{mediaJSON, AddItemRequest{}},
+		Responses: map[int]apiBody{200: jsonBody(Collection{}), 400: jsonErr, 401: jsonErr, 403: jsonErr, 404: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "DELETE", Path: "/api/collections/{id}/items/{wallpaper_id}", Tag: "collections", Summary: "Remove a wallpaper from a collection",
+		Handler: CollectionsAPIHandler, Auth: true,
+		Params:    []apiParam{collParam, {"wallpaper_id", "path", "integer", "wallpaper id"}},
+		Responses: map[int]apiBody{204: noContent, 401: jsonErr, 403: jsonErr, 404: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "PUT", Path: "/api/collections/{id}/order", Tag: "collections", Summary: "Reorder a collection",
+		Handler: CollectionsAPIHandler, Auth: true, Params: []apiParam{collParam}, Request: &apiBody{mediaJSON, ReorderRequest{}},
+		Responses: map[int]apiBody{200: jsonBody(Collection{}), 400: jsonErr, 401: jsonErr, 403: jsonErr, 404: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "GET", Path: "/api/tags", Tag: "tags", Summary: "Tag autocomplete, most used first",
+		Handler:   TagsAPIHandler,
+		Params:    []apiParam{{"q", "query", "string", "prefix"}, {"limit", "query", "integer", "1 to 50"}},
+		Responses: map[int]apiBody{200: jsonBody([]Tag{}), 400: jsonErr, 405: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "GET", Path: "/api/search", Tag: "search", Summary: "Search the wallpapers the user can see",
+		Handler: SearchAPIHandler,
+		Params: []apiParam{
+			{"q", "query", "string", "words, matched on names, descriptions, tags and uploaders"},
+			{"tag", "query", "string", ""}, {"uploader", "query", "string", ""},
+			{"min_width", "query", "integer", ""}, {"min_height", "query", "integer", ""},
+			{"orientation", "query", "string", "landscape, portrait or square"},
+			{"color", "query", "string", ""},
+			{"from", "query", "string", "YYYY-MM-DD"}, {"to", "query", "string", "YYYY-MM-DD"},
+			{"sort", "query", "string", "relevance, newest, oldest or popular"},
+			{"page", "query", "integer", ""}, {"limit", "query", "integer", ""},
+		},
+		Responses: map[int]apiBody{200: jsonBody(SearchResponse{}), 400: jsonErr, 405: jsonErr, 500: jsonErr},
+	},
+	{
+		Method: "GET", Path: "/api/gallery", Tag: "gallery", Summary: "Next page of a gallery, as data and as rendered cards",
+		Handler:   GalleryAPIHandler,
+		Params:    append([]apiParam{{"view", "query", "string", "community, wallpapers, archive or review"}}, cursorArgs...),
+		Responses: map[int]apiBody{200: jsonBody(GalleryPage{}), 400: jsonErr, 401: jsonErr, 403: jsonErr, 405: jsonErr, 500: jsonErr},
+		Probe:     "view=community",
+	},
+	{
+		Method: "POST", Path: "/api/admin/bulk", Tag: "admin", Summary: "Apply a moderation action to many wallpapers (admin)",
+		Handler: BulkModerationHandler, Auth: true, Request: &apiBody{mediaJSON, BulkRequest{}},
+		Responses: map[int]apiBody{200: jsonBody(BulkResponse{}), 400: jsonErr, 401: jsonErr, 403: jsonErr, 405: jsonErr},
+	},
+	{
+		Method: "GET", Path: "/api/v1/wallpapers", Tag: "wallpapers", Summary: "List wallpapers",
+		Handler: WallpapersAPIHandler,
+		Params: append([]apiParam{
+			{"scope", "query", "string", "mine (default when logged in), archive or public"},
+			{"status", "query", "string", "moderation state, with mine and archive"},
+			fieldsParam,
+		}, cursorArgs...),
+		Responses: map[int]apiBody{200: jsonBody(WallpaperList{}), 400: v1Err, 401: v1Err, 500: v1Err},
+	},
+	{
+		Method: "POST", Path: "/api/v1/wallpapers", Tag: "wallpapers", Summary: "Upload a wallpaper",
+		Handler: WallpapersAPIHandler, Auth: true,
+		Request: &apiBody{mediaMultipart, objectSchema(map[string]interface{}{
+			"wallpaper":   map[string]interface{}{"type": "string", "contentMediaType": "application/octet-stream"},
+			"tags":        typeSchema("string"),
+			"description": typeSchema("string"),
+		}, "wallpaper")},
+		Responses: map[int]apiBody{201: jsonBody(Wallpaper{}), 400: v1Err, 401: v1Err, 403: v1Err, 413: v1Err, 500: v1Err},
+	},
+	{
+		Method: "GET", Path: "/api/v1/wallpapers/{id}", Tag: "wallpapers", Summary: "Get a wallpaper",
+		Handler: WallpapersAPIHandler, Params: []apiParam{idParam, fieldsParam},
+		Responses: map[int]apiBody{200: jsonBody(Wallpaper{}), 400: v1Err, 404: v1Err, 500: v1Err},
+	},
+	{
+		Method: "PATCH", Path: "/api/v1/wallpapers/{id}", Tag: "wallpapers", Summary: "Rename, describe or tag a wallpaper",
+		Handler: WallpapersAPIHandler, Auth: true, Params: []apiParam{idParam}, Request: &apiBody{mediaJSON, WallpaperUpdate{}},
+		Responses: map[int]apiBody{200: jsonBody(Wallpaper{}), 400: v1Err, 401: v1Err, 403: v1Err, 404: v1Err, 409: v1Err, 500: v1Err},
+	},
+	{
+		Method: "DELETE", Path: "/api/v1/wallpapers/{id}", Tag: "wallpapers", Summary: "Move a wallpaper to the trash",
+		Handler: WallpapersAPIHandler, Auth: true, Params: []apiParam{idParam},
+		Responses: map[int]apiBody{204: noContent, 401: v1Err, 403: v1Err, 404: v1Err, 409: v1Err, 500: v1Err},
+	},
+	{
+		Method: "POST", Path: "/api/v1/wallpapers/{id}/publish-request", Tag: "wallpapers", Summary: "Submit a wallpaper for review",
+		Handler: WallpapersAPIHandler, Auth: true, Params: []apiParam{idParam},
+		Responses: map[int]apiBody{200: jsonBody(Wallpaper{}), 401: v1Err, 403: v1Err, 404: v1Err, 409: v1Err, 500: v1Err},
+	},
+	{
+		Method: "GET", Path: "/api/v1/random", Tag: "wallpapers", Summary: "A random public wallpaper, or a redirect to its image",
+		Handler: RandomAPIHandler,
+		Params: []apiParam{
+			{"uploader", "query", "string", "username"},
+			{"orientation", "query", "string", "landscape, portrait or square"},
+			{"min_width", "query", "integer", "in pixels"}, {"min_height", "query", "integer", "in pixels"},
+			{"seed", "query", "string", "the same seed and filters give the same wallpaper, e.g. the date for a daily pick"},
+			{"exclude_recent", "query", "integer", "skip the last N wallpapers served to this client, up to 100"},
+			{"client", "query", "string", "the client the recent ones are remembered for, the user or the IP by default"},
+			{"redirect", "query", "boolean", "302 to the image instead of the JSON"},
+			fieldsParam,
+		},
+		Responses: map[int]apiBody{200: jsonBody(Wallpaper{}), 302: noContent, 400: v1Err, 404: v1Err, 405: v1Err, 500: v1Err},
+	},
+	{
+		Method: "OPTIONS", Path: "/api/v1/uploads", Tag: "uploads", Summary: "tus discovery: Tus-Version, Tus-Extension and Tus-Max-Size",
+		Handler:   TusUploadsHandler,
+		Responses: map[int]apiBody{204: noContent},
+	},
+	{
+		Method: "POST", Path: "/api/v1/uploads", Tag: "uploads", Summary: "Start a resumable upload (tus creation), its URL is in Location",
+		Handler: TusUploadsHandler, Auth: true,
+		Params: []apiParam{
+			tusResumableParam,
+			{"Upload-Length", "header", "integer", "size of the file in bytes, required"},
+			{"Upload-Metadata", "header", "string", "filename (required), tags and description, as key base64 pairs"},
+		},
+		Responses: map[int]apiBody{201: noContent, 400: v1Err, 401: v1Err, 403: v1Err, 405: v1Err, 412: v1Err, 413: v1Err, 500: v1Err},
+	},
+	{
+		Method: "HEAD", Path: "/api/v1/uploads/{id}", Tag: "uploads", Summary: "Where to resume: Upload-Offset, and X-Wallpaper-Id once finished",
+		Handler: TusUploadsHandler, Auth: true, Params: []apiParam{uploadIDParam, tusResumableParam},
+		Responses: map[int]apiBody{200: noContent, 401: v1Err, 404: v1Err, 410: v1Err, 412: v1Err, 500: v1Err},
+	},
+	{
+		Method: "PATCH", Path: "/api/v1/uploads/{id}", Tag: "uploads", Summary: "Append bytes at Upload-Offset, the last ones store the wallpaper",
+		Handler: TusUploadsHandler, Auth: true,
+		Params:  []apiParam{uploadIDParam, tusResumableParam, {"Upload-Offset", "header", "integer", "the current offset of the upload, required"}},
+		Request: &apiBody{mediaOffsetStream, ""},
+		Responses: map[int]apiBody{
+			204: noContent, 400: v1Err, 401: v1Err, 403: v1Err, 404: v1Err, 409: v1Err, 410: v1Err, 412: v1Err, 415: v1Err, 423: v1Err, 500: v1Err,
+		},
+	},
+	{
+		Method: "DELETE", Path: "/api/v1/uploads/{id}", Tag: "uploads", Summary: "Abandon a resumable upload (tus termination)",
+		Handler: TusUploadsHandler, Auth: true, Params: []apiParam{uploadIDParam, tusResumableParam},
+		Responses: map[int]apiBody{204: noContent, 401: v1Err, 404: v1Err, 412: v1Err, 423: v1Err, 500: v1Err},
+	},
+}
+
+func typeSchema(t string) map[string]interface{} { return map[string]interface{}{"type": t} }
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+// schemaBuilder turns Go types into JSON Schemas, the named structs go to components
+type schemaBuilder struct {
+	components map[string]interface{}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *schemaBuilder) schemaOf(v interface{}) map[string]interface{} {
+	if s, ok := v.(map[string]interface{}); ok {
+		return s
+	}
+	if s, ok := v.(string); ok && s == "" {
+		return typeSchema("string")
+	}
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Ptr:
+		return b.schema(t.Elem())
+	case t.Kind() == reflect.Struct:
+		name := t.Name()
+		if _, done := b.components[name]; !done {
+			b.components[name] = nil // placeholder, for the recursive types
+			b.components[name] = b.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Slice:
+		return map[string]interface{}{"type": "array", "items": b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case t.Kind() == reflect.String:
+		return typeSchema("string")
+	case t.Kind() == reflect.Bool:
+		return typeSchema("boolean")
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return typeSchema("integer")
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return typeSchema("number")
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// the properties are the JSON fields, the ones without omitempty/omitzero are required
+func (b *schemaBuilder) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		opts := strings.Split(f.Tag.Get("json"), ",")
+		name := opts[0]
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = b.schema(f.Type)
+		optional := f.Type.Kind() == reflect.Ptr
+		for _, opt := range opts[1:] {
+			optional = optional || opt == "omitempty" || opt == "omitzero"
+		}
+		if !optional {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(required)
+	return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]interface{}
+)
+
+// OpenAPISpec builds the OpenAPI 3.1 document from apiOperations
+func OpenAPISpec() map[string]interface{} {
+	openAPIOnce.Do(func() {
+		b := &schemaBuilder{components: map[string]interface{}{}}
+		paths := map[string]interface{}{}
+		for _, op := range apiOperations {
+			item, _ := paths[op.Path].(map[string]interface{})
+			if item == nil {
+				item = map[string]interface{}{}
+				paths[op.Path] = item
+			}
+			item[strings.ToLower(op.Method)] = b.operation(op)
+		}
+		openAPIDoc = map[string]interface{}{
+			"openapi": "3.1.0",
+			"info": map[string]interface{}{
+				"title":       "WPManager API",
+				"version":     "1.0.0",
+				"description": "JSON endpoints of WPManager. The session cookie of the website authenticates the requests. The /api/v1 endpoints and the reads of wpctl (search, collections, comments, image files) also take a personal token from /tokens, sent as a Bearer token.",
+			},
+			"paths": paths,
+			"components": map[string]interface{}{
+				"schemas": b.components,
+				"securitySchemes": map[string]interface{}{
+					"session": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": "session_id"},
+					"token":   map[string]interface{}{"type": "http", "scheme": "bearer"},
+				},
+			},
+		}
+	})
+	return openAPIDoc
+}
+
+func (b *schemaBuilder) operation(op apiOperation) map[string]interface{} {
+	o := map[string]interface{}{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+	if op.Auth {
+		o["security"] = []map[string][]string{{"session": {}}}
+		if strings.HasPrefix(op.Path, "/api/v1/") {
+			o["security"] = []map[string][]string{{"session": {}}, {"token": {}}}
+		}
+	}
+
+	var params []map[string]interface{}
+	for _, p := range op.Params {
+		param := map[string]interface{}{
+			"name":     p.Name,
+			"in":       p.In,
+			"required": p.In == "path",
+			"schema":   typeSchema(p.Type),
+		}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if params != nil {
+		o["parameters"] = params
+	}
+
+	if op.Request != nil {
+		o["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  map[string]interface{}{op.Request.Media: map[string]interface{}{"schema": b.schemaOf(op.Request.Schema)}},
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for status, body := range op.Responses {
+		resp := map[string]interface{}{"description": http.StatusText(status)}
+		if body.Media != "" {
+			resp["content"] = map[string]interface{}{body.Media: map[string]interface{}{"schema": b.schemaOf(body.Schema)}}
+		}
+		responses[strconv.Itoa(status)] = resp
+	}
+	o["responses"] = responses
+	return o
+}
+
+var nonWord = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// e.g. get_api_comments_id
+func operationID(op apiOperation) string {
+	return strings.ToLower(op.Method) + strings.TrimSuffix(nonWord.ReplaceAllString(op.Path, "_"), "_")
+}
+
+// OpenAPIHandler serves the OpenAPI document
+// URL format: /api/openapi.json
+func OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	writeJSON(w, http.StatusOK, OpenAPISpec())
+}
+
+// APIDocsHandler renders the API documentation page, it reads /api/openapi.json
+func APIDocsHandler(w http.ResponseWriter, r *http.Request) {
+	data := PageData{}
+	if user := getCurrentUser(r); user != nil {
+		data.Username, data.IsAdmin = user.Username, user.IsAdmin
+	}
+	if err := templates.ExecuteTemplate(w, "apidocs.html", data); err != nil {
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,445 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestAPISpec fails when a JSON endpoint drifts from /api/openapi.json: a new status, a body
+// that doesn't match its schema, a route that doesn't reach the documented handler, a success
+// answer that none of apiProbes reaches
+func TestAPISpec(t *testing.T) {
+	useFixtureDB(t)
+	useTemplates(t)
+	// the probes upload, the files go to web/uploads and web/tus under the working directory
+	t.Chdir(t.TempDir())
+	if err := checkAPISpec(apiMux()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// apiMux routes the JSON endpoints as server.go does
+func apiMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	for pattern, h := range map[string]http.HandlerFunc{
+		"/api/comments/":                 GetCommentsHandler,
+		"/api/comments":                  PostCommentHandler,
+		"/api/notifications":             GetNotificationsHandler,
+		"/api/notifications/read":        MarkNotificationsReadHandler,
+		"/api/notifications/preferences": NotificationPreferencesHandler,
+		"/api/events":                    EventsHandler,
+		"/api/collections":               CollectionsAPIHandler,
+		"/api/collections/":              CollectionsAPIHandler,
+		"/api/tags":                      TagsAPIHandler,
+		"/api/search":                    SearchAPIHandler,
+		"/api/gallery":                   GalleryAPIHandler,
+		"/api/admin/bulk":                BulkModerationHandler,
+		"/api/v1/wallpapers":             WallpapersAPIHandler,
+		"/api/v1/wallpapers/":            WallpapersAPIHandler,
+		"/api/v1/random":                 RandomAPIHandler,
+		"/api/v1/uploads":                TusUploadsHandler,
+		"/api/v1/uploads/":               TusUploadsHandler,
+		"/api/openapi.json":              OpenAPIHandler,
+	} {
+		mux.HandleFunc(pattern, h)
+	}
+	return mux
+}
+
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+// checkAPISpec requests every operation of the spec on mux, first without a session and then with
+// its apiProbes, and checks that the route reaches the documented handler, that the status, media
+// type and body of each answer are documented and that every documented success is answered
+func checkAPISpec(mux *http.ServeMux) error {
+	spec := OpenAPISpec()
+	schemas := spec["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	b := &schemaBuilder{components: map[string]interface{}{}}
+
+	var problems []string
+	for _, op := range apiOperations {
+		name := op.Method + " " + op.Path
+		target := pathParam.ReplaceAllString(op.Path, "0")
+		if op.Probe != "" {
+			target += "?" + op.Probe
+		}
+		req := httptest.NewRequest(op.Method, target, strings.NewReader("{}"))
+		req.Header.Set("Content-Type", mediaJSON)
+
+		h, pattern := mux.Handler(req)
+		if pattern == "" || reflect.ValueOf(h).Pointer() != reflect.ValueOf(op.Handler).Pointer() {
+			problems = append(problems, name+": not routed to its handler")
+			continue
+		}
+
+		answered := map[int]bool{}
+		check := func(req *http.Request) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+			answered[rec.Code] = true
+			if err := checkAnswer(op, rec, b, schemas); err != nil {
+				problems = append(problems, name+": "+err.Error())
+			}
+		}
+		check(req)
+		for _, probe := range apiProbes[name] {
+			seedFixtureDB(append(probe.Seed, fixtureSession...)...)
+			check(probe.request(op))
+			seedFixtureDB()
+		}
+
+		for status := range op.Responses {
+			if status < 400 && !answered[status] {
+				problems = append(problems, fmt.Sprintf("%s: %d is documented, no probe answered it", name, status))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("the API drifted from its OpenAPI document:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// checkAnswer checks that the status, media type and body of an answer of op are documented
+func checkAnswer(op apiOperation, rec *httptest.ResponseRecorder, b *schemaBuilder, schemas map[string]interface{}) error {
+	body, documented := op.Responses[rec.Code]
+	if !documented {
+		return fmt.Errorf("answered %d, which is not documented", rec.Code)
+	}
+	media := strings.TrimSpace(strings.Split(rec.Header().Get("Content-Type"), ";")[0])
+	if body.Media == "" {
+		if rec.Body.Len() > 0 {
+			return fmt.Errorf("%d has a body, none is documented", rec.Code)
+		}
+		return nil
+	}
+	if media != body.Media {
+		return fmt.Errorf("%d answered %q, documented %q", rec.Code, media, body.Media)
+	}
+	if body.Media == mediaJSON {
+		var value interface{}
+		if err := json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&value); err != nil {
+			return fmt.Errorf("%d is not valid JSON: %v", rec.Code, err)
+		}
+		if err := validateSchema(b.schemaOf(body.Schema), value, schemas, "body"); err != nil {
+			return fmt.Errorf("%d %v", rec.Code, err)
+		}
+	}
+	return nil
+}
+
+// validateSchema checks a decoded JSON value against the subset of JSON Schema the builder emits
+func validateSchema(schema map[string]interface{}, value interface{}, components map[string]interface{}, at string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		component, _ := components[strings.TrimPrefix(ref, "#/components/schemas/")].(map[string]interface{})
+		if component == nil {
+			return fmt.Errorf("%s: unknown schema %s", at, ref)
+		}
+		return validateSchema(component, value, components, at)
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object, got %s", at, jsonKind(value))
+		}
+		required, _ := schema["required"].([]string)
+		for _, key := range required {
+			if _, ok := obj[key]; !ok {
+				return fmt.Errorf("%s: missing required %q", at, key)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		extra, _ := schema["additionalProperties"].(map[string]interface{})
+		for key, v := range obj {
+			if p, ok := properties[key].(map[string]interface{}); ok {
+				if err := validateSchema(p, v, components, at+"."+key); err != nil {
+					return err
+				}
+			} else if extra != nil {
+				if err := validateSchema(extra, v, components, at+"."+key); err != nil {
+					return err
+				}
+			} else {
+				return fmt.Errorf("%s: undocumented field %q", at, key)
+			}
+		}
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array, got %s", at, jsonKind(value))
+		}
+		itemSchema, _ := schema["items"].(map[string]interface{})
+		for i, item := range items {
+			if err := validateSchema(itemSchema, item, components, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string", "boolean", "integer", "number":
+		kind := jsonKind(value)
+		if kind == "number" && schema["type"] == "integer" {
+			if f := value.(float64); f == float64(int64(f)) {
+				kind = "integer"
+			}
+		}
+		if kind != schema["type"] {
+			return fmt.Errorf("%s: expected %s, got %s", at, schema["type"], kind)
+		}
+	}
+	return nil
+}
+
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// apiProbe is a request of fixtureSession's user reaching a success answer of an operation,
+// with the rows it reads seeded
+type apiProbe struct {
+	Target string // path and query, the path of the operation with its parameters at 1 when empty
+	Body   string // {} when empty
+	Header map[string]string
+	Stream bool              // the answer streams until the client leaves, the request is canceled up front
+	Files  map[string]string // written under the working directory before the request
+	Seed   []fixtureAnswer
+}
+
+func (p apiProbe) request(op apiOperation) *http.Request {
+	target := p.Target
+	if target == "" {
+		target = pathParam.ReplaceAllString(op.Path, "1")
+	}
+	body := p.Body
+	if body == "" {
+		body = "{}"
+	}
+	for name, content := range p.Files {
+		os.MkdirAll(filepath.Dir(name), 0755)
+		os.WriteFile(name, []byte(content), 0644)
+	}
+	req := httptest.NewRequest(op.Method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", mediaJSON)
+	for name, value := range p.Header {
+		req.Header.Set(name, value)
+	}
+	req.AddCookie(&http.Cookie{Name: "session_id", Value: "fixture"})
+	if p.Stream {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancel()
+		req = req.WithContext(ctx)
+	}
+	return req
+}
+
+// fixtureSession logs the probes in as alice (user 1), who is not an admin
+var fixtureSession = []fixtureAnswer{
+	{"FROM sessions WHERE id = ?", row(1, time.Now().Add(time.Hour))},
+	{"SELECT id, username, email, name, surname, isadmin FROM users WHERE id = ?", row(1, "alice", "alice@example.com", "Alice", "Liddell", false)},
+}
+
+// row is one row of a fixtureAnswer, the ints become int64 as a driver returns them
+func row(values ...interface{}) [][]driver.Value {
+	r := make([]driver.Value, len(values))
+	for i, v := range values {
+		if n, ok := v.(int); ok {
+			v = int64(n)
+		}
+		r[i] = v
+	}
+	return [][]driver.Value{r}
+}
+
+// the rows the probes share
+var (
+	fixtureTime       = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	fixtureVisible    = fixtureAnswer{"SELECT EXISTS(SELECT 1 FROM wallpapers", row(true)}
+	fixtureCollection = fixtureAnswer{"FROM collections c JOIN users u ON u.id = c.user_id",
+		row(1, 1, "alice", "Nebulas", "Deep space", 1, "a1b2.jpg", CollectionPublic, fixtureTime, fixtureTime, 1)}
+	fixtureWallpaper = fixtureAnswer{"COALESCE(w.sha256, ''), w.status, COALESCE(w.rejection_reason, '')",
+		row(1, 1, "alice", "a1b2.jpg", "nebula.jpg", "Deep space", fixtureTime, 3840, 2160, "blue", "9f86d081",
+			StatusApproved, "", nil, nil, nil, nil, ShareNone)}
+	fixtureTags = fixtureAnswer{"SELECT wt.wallpaper_id, t.name FROM wallpaper_tags wt", row(1, "space")}
+	// the seed of a probe comes before fixtureSession, this makes alice an admin
+	fixtureAdmin = fixtureAnswer{"SELECT id, username, email, name, surname, isadmin FROM users WHERE id = ?",
+		row(1, "alice", "alice@example.com", "Alice", "Liddell", true)}
+	fixtureUsage     = fixtureAnswer{"SELECT u.username, u.isadmin, COUNT(w.id)", row("alice", false, 0, 0)}
+	fixtureTusUpload = fixtureAnswer{"FROM tus_uploads WHERE id = ? AND user_id = ?",
+		row(1, 4, 0, "nebula.png", "", "", nil, time.Now().Add(time.Hour))}
+	fixturePublicCount = fixtureAnswer{"SELECT COUNT(*) FROM wallpapers w", row(1)}
+	fixtureItems       = fixtureAnswer{"FROM collection_items ci JOIN wallpapers w ON w.id = ci.wallpaper_id JOIN users u",
+		row(1, "a1b2.jpg", "nebula.jpg", "alice", 0, fixtureTime)}
+)
+
+// apiProbes reach the success answers of the operations, by "METHOD path" of apiOperations
+var apiProbes = map[string][]apiProbe{
+	"GET /api/comments/{id}": {{Seed: []fixtureAnswer{
+		fixtureVisible,
+		{"FROM comments c JOIN users u", row(1, 1, 2, 0, "bob", "Nice colors", fixtureTime)},
+	}}},
+	"POST /api/comments": {{
+		Body: `{"wallpaper_id": 1, "text": "Nice colors"}`,
+		Seed: []fixtureAnswer{
+			{"SELECT user_id FROM wallpapers WHERE id = ?", row(2)},
+			fixtureVisible,
+			{"INSERT INTO comments", nil},
+		},
+	}},
+	"GET /api/notifications": {{Seed: []fixtureAnswer{
+		{"FROM notifications n", row(1, NotifComment, "bob", 1, "bob commented on your wallpaper", false, fixtureTime)},
+		{"SELECT COUNT(*) FROM notifications", row(1)},
+	}}},
+	"POST /api/notifications/read": {{
+		Body: `{"all": true}`,
+		Seed: []fixtureAnswer{{"SELECT COUNT(*) FROM notifications", row(0)}},
+	}},
+	"GET /api/notifications/preferences": {{Seed: []fixtureAnswer{
+		{"SELECT type, enabled FROM notification_preferences", row(NotifComment, false)},
+	}}},
+	"POST /api/notifications/preferences": {{
+		Body: `{"comment": false}`,
+		Seed: []fixtureAnswer{{"SELECT type, enabled FROM notification_preferences", row(NotifComment, false)}},
+	}},
+	"GET /api/events":      {{Target: "/api/events?wallpaper_id=1", Stream: true, Seed: []fixtureAnswer{fixtureVisible}}},
+	"GET /api/collections": {{Seed: []fixtureAnswer{fixtureCollection}}},
+	"POST /api/collections": {{
+		Body: `{"name": "Nebulas", "visibility": "public"}`,
+		Seed: []fixtureAnswer{{"INSERT INTO collections", nil}, fixtureCollection},
+	}},
+	"GET /api/collections/{id}": {{Seed: []fixtureAnswer{fixtureCollection, fixtureItems}}},
+	"PATCH /api/collections/{id}": {{
+		Body: `{"description": "Deep space"}`,
+		Seed: []fixtureAnswer{fixtureCollection, fixtureItems},
+	}},
+	"DELETE /api/collections/{id}": {{Seed: []fixtureAnswer{fixtureCollection}}},
+	"POST /api/collections/{id}/items": {{
+		Body: `{"wallpaper_id": 1}`,
+		Seed: []fixtureAnswer{fixtureCollection, fixtureVisible, fixtureItems},
+	}},
+	"DELETE /api/collections/{id}/items/{wallpaper_id}": {{Seed: []fixtureAnswer{
+		fixtureCollection,
+		{"DELETE FROM collection_items", nil},
+	}}},
+	"PUT /api/collections/{id}/order": {{
+		Body: `{"wallpaper_ids": [1]}`,
+		Seed: []fixtureAnswer{fixtureCollection, fixtureItems},
+	}},
+	"GET /api/tags": {{
+		Target: "/api/tags?q=neb",
+		Seed:   []fixtureAnswer{{"SELECT t.name, COALESCE(a.name, ''), COUNT(w.id) FROM tags t", row("nebula", "", 3)}},
+	}},
+	"GET /api/search": {{
+		Target: "/api/search?q=nebula",
+		Seed: []fixtureAnswer{{"AS score FROM wallpapers w",
+			row(1, "a1b2.jpg", "nebula.jpg", "Deep space", fixtureTime, 3840, 2160, "blue", StatusApproved, "alice", 2.5)}},
+	}},
+	"GET /api/gallery": {{
+		Target: "/api/gallery?view=community",
+		Seed: []fixtureAnswer{{"SELECT w.id, w.filename, w.original_name, w.uploaded_at, w.status, u.username FROM wallpapers w",
+			row(1, "a1b2.jpg", "nebula.jpg", fixtureTime, StatusApproved, "alice")}},
+	}},
+	"POST /api/admin/bulk": {{
+		Body: `{"action": "approve", "ids": [1]}`,
+		Seed: []fixtureAnswer{
+			fixtureAdmin,
+			{"SELECT status FROM wallpapers", row(StatusPending)},
+			{"SELECT user_id, status, publish_at FROM wallpapers", row(2, StatusPending, nil)},
+			{"UPDATE wallpapers SET status", nil},
+		},
+	}},
+	"GET /api/v1/wallpapers": {
+		{Seed: []fixtureAnswer{fixtureWallpaper, fixtureTags}},
+		// as wpctl, with a personal token
+		{
+			Header: map[string]string{"Authorization": "Bearer " + tokenPrefix + "fixture"},
+			Seed:   []fixtureAnswer{{"SELECT user_id FROM api_tokens", row(1)}, fixtureWallpaper},
+		},
+	},
+	"POST /api/v1/wallpapers": {{
+		Body:   fixtureUpload,
+		Header: map[string]string{"Content-Type": fixtureUploadType},
+		Seed:   []fixtureAnswer{fixtureUsage, {"INSERT INTO wallpapers", nil}, fixtureWallpaper},
+	}},
+	"GET /api/v1/wallpapers/{id}": {{Seed: []fixtureAnswer{fixtureVisible, fixtureWallpaper, fixtureTags}}},
+	"PATCH /api/v1/wallpapers/{id}": {{
+		Body: `{"original_name": "Nebula", "tags": ["space"]}`,
+		Seed: []fixtureAnswer{
+			fixtureVisible, fixtureWallpaper, fixtureTags,
+			{"SELECT COALESCE(a.id, t.id), COALESCE(a.name, t.name) FROM tags t", row(1, "space")},
+		},
+	}},
+	"DELETE /api/v1/wallpapers/{id}": {{Seed: []fixtureAnswer{fixtureVisible, fixtureWallpaper, {"UPDATE wallpapers SET deleted_at", nil}}}},
+	"POST /api/v1/wallpapers/{id}/publish-request": {{Seed: []fixtureAnswer{
+		fixtureVisible,
+		{"SELECT status FROM wallpapers", row(StatusPrivate)},
+		{"SELECT user_id, status, publish_at FROM wallpapers", row(1, StatusPrivate, nil)},
+		{"UPDATE wallpapers SET status", nil}, fixtureWallpaper,
+	}}},
+	"GET /api/v1/random": {
+		{Seed: []fixtureAnswer{fixturePublicCount, fixtureWallpaper}},
+		{Target: "/api/v1/random?redirect=true", Seed: []fixtureAnswer{fixturePublicCount, fixtureWallpaper}},
+	},
+	"POST /api/v1/uploads": {{
+		Header: map[string]string{"Tus-Resumable": TusVersion, "Upload-Length": "4", "Upload-Metadata": "filename bmVidWxhLnBuZw=="},
+		Seed: []fixtureAnswer{fixtureUsage, {"SELECT COALESCE(SUM(length), 0) FROM tus_uploads", row(0)},
+			{"SELECT COUNT(*) FROM tus_uploads", row(0)}, {"INSERT INTO tus_uploads", nil}},
+	}},
+	"HEAD /api/v1/uploads/{id}": {{
+		Header: map[string]string{"Tus-Resumable": TusVersion},
+		Seed:   []fixtureAnswer{fixtureTusUpload},
+	}},
+	"PATCH /api/v1/uploads/{id}": {{
+		Body:   "ab",
+		Header: map[string]string{"Tus-Resumable": TusVersion, "Content-Type": mediaOffsetStream, "Upload-Offset": "0"},
+		Files:  map[string]string{"web/tus/1": ""},
+		Seed:   []fixtureAnswer{fixtureTusUpload, {"UPDATE tus_uploads SET upload_offset", nil}},
+	}},
+	"DELETE /api/v1/uploads/{id}": {{
+		Header: map[string]string{"Tus-Resumable": TusVersion},
+		Seed:   []fixtureAnswer{fixtureTusUpload, {"DELETE FROM tus_uploads", nil}},
+	}},
+}
+
+// fixtureUpload is a multipart body with a 1x1 PNG as "wallpaper"
+var fixtureUpload, fixtureUploadType = func() (string, string) {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 1, 1)))
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, _ := mw.CreateFormFile("wallpaper", "nebula.png")
+	part.Write(img.Bytes())
+	mw.WriteField("tags", "space")
+	mw.Close()
+	return body.String(), mw.FormDataContentType()
+}()
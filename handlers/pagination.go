@@ -0,0 +1,94 @@
+// / this file contains the keyset (cursor) pagination helpers
+package handlers
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor points right after the last row of a page, ordered by (time DESC, id DESC)
+type Cursor struct {
+	Time time.Time
+	ID   int
+}
+
+// encodes the cursor as an opaque url-safe string
+func (c Cursor) String() string {
+	raw := fmt.Sprintf("%d_%d", c.Time.UnixNano(), c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodes a cursor from the query string, an empty string means "first page"
+func parseCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parts := strings.SplitN(string(raw), "_", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	id, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &Cursor{Time: time.Unix(0, nanos), ID: id}, nil
+}
+
+// returns the SQL condition + args for "rows after the cursor" on the given columns
+func (c *Cursor) where(timeColumn, idColumn string) (string, []interface{}) {
+	if c == nil {
+		return "1 = 1", nil
+	}
+	return fmt.Sprintf("(%s < ? OR (%s = ? AND %s < ?))", timeColumn, timeColumn, idColumn),
+		[]interface{}{c.Time, c.Time, c.ID}
+}
+
+// page sizes of the galleries (community, my wallpapers, review queue)
+const (
+	galleryPageSize    = 24
+	maxGalleryPageSize = 100
+)
+
+// pageWallpapers runs query (which must end with a WHERE clause) on the page after cursor,
+// newest first on (w.uploaded_at, w.id). It returns the rows and the cursor of the next page,
+// empty on the last one.
+func pageWallpapers(query string, args []interface{}, cursor *Cursor, limit int, scan func(*sql.Rows) (Wallpaper, error)) ([]Wallpaper, string, error) {
+	after, afterArgs := cursor.where("w.uploaded_at", "w.id")
+	args = append(append(args, afterArgs...), limit+1)
+
+	rows, err := db.Query(query+" AND "+after+" ORDER BY w.uploaded_at DESC, w.id DESC LIMIT ?", args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var wallpapers []Wallpaper
+	next := ""
+	for rows.Next() {
+		w, err := scan(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		// one extra row was fetched to know if there's a next page
+		if len(wallpapers) == limit {
+			last := wallpapers[len(wallpapers)-1]
+			next = Cursor{Time: last.UploadedAt, ID: last.ID}.String()
+			break
+		}
+		wallpapers = append(wallpapers, w)
+	}
+	return wallpapers, next, rows.Err()
+}
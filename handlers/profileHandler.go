@@ -13,6 +13,19 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	badges, err := badgesByUser(user.UserID)
+	if err != nil {
+		log.Println("❌ Failed to load badges:", err)
+	}
+	user.Badges = badges[user.UserID]
+
+	storage, err := storageUsage(user.UserID)
+	if err != nil {
+		log.Println("❌ Failed to load the storage usage:", err)
+	} else {
+		user.Storage = &storage
+	}
+
 	// Render profile page with struct
 	if err := templates.ExecuteTemplate(w, "profile.html", user); err != nil {
 		log.Println("❌ Profile template error:", err)
@@ -0,0 +1,252 @@
+// / this file contains the storage quotas: what each user stores (the trash included, it is on
+// / the disk until purged), the limits of their role, and the admins' per-user overrides
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var errQuotaExceeded = errors.New("storage quota exceeded")
+
+// StorageQuota is a limit on the wallpapers of a user, 0 means unlimited
+type StorageQuota struct {
+	MaxWallpapers int   `json:"max_wallpapers"`
+	MaxBytes      int64 `json:"max_bytes"`
+}
+
+// the limits of each role, 500 wallpapers and 2 GB for the users and unlimited for the admins
+// unless set at startup (see SetDefaultQuotas)
+var (
+	userQuota  = StorageQuota{MaxWallpapers: 500, MaxBytes: 2 << 30}
+	adminQuota = StorageQuota{}
+)
+
+// DefaultQuotas returns the limits of the users and of the admins
+func DefaultQuotas() (user, admin StorageQuota) {
+	return userQuota, adminQuota
+}
+
+// SetDefaultQuotas sets the limits of the users and of the admins
+func SetDefaultQuotas(user, admin StorageQuota) {
+	userQuota, adminQuota = user, admin
+}
+
+// StorageUsage is what a user stores against their quota
+type StorageUsage struct {
+	UserID     int
+	Username   string
+	IsAdmin    bool
+	Wallpapers int
+	Bytes      int64
+	Quota      StorageQuota
+	Override   bool // the quota was set by an admin for this user
+
+	// the override as typed in the admin form, blank when the role's limit applies
+	LimitWallpapers string
+	LimitSize       string
+}
+
+// quotaFor returns the quota of a user: their override, field by field, or their role's
+func quotaFor(userID int, isAdmin bool) (StorageQuota, bool, error) {
+	quota := userQuota
+	if isAdmin {
+		quota = adminQuota
+	}
+	var maxWallpapers sql.NullInt64
+	var maxBytes sql.NullInt64
+	err := db.QueryRow("SELECT max_wallpapers, max_bytes FROM storage_limits WHERE user_id = ?", userID).
+		Scan(&maxWallpapers, &maxBytes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return quota, false, nil
+	}
+	if err != nil {
+		return quota, false, err
+	}
+	if maxWallpapers.Valid {
+		quota.MaxWallpapers = int(maxWallpapers.Int64)
+	}
+	if maxBytes.Valid {
+		quota.MaxBytes = maxBytes.Int64
+	}
+	return quota, true, nil
+}
+
+func storageUsage(userID int) (StorageUsage, error) {
+	u := StorageUsage{UserID: userID}
+	err := db.QueryRow(`
+		SELECT u.username, u.isadmin, COUNT(w.id), COALESCE(SUM(w.size_bytes), 0)
+		FROM users u
+		LEFT JOIN wallpapers w ON w.user_id = u.id
+		WHERE u.id = ?
+		GROUP BY u.id, u.username, u.isadmin
+	`, userID).Scan(&u.Username, &u.IsAdmin, &u.Wallpapers, &u.Bytes)
+	if err != nil {
+		return u, err
+	}
+	u.Quota, u.Override, err = quotaFor(userID, u.IsAdmin)
+	return u, err
+}
+
+// storageReport returns the usage of every user, the largest first
+func storageReport() ([]StorageUsage, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.isadmin, COUNT(w.id), COALESCE(SUM(w.size_bytes), 0),
+			l.max_wallpapers, l.max_bytes, l.user_id IS NOT NULL
+		FROM users u
+		LEFT JOIN wallpapers w ON w.user_id = u.id
+		LEFT JOIN storage_limits l ON l.user_id = u.id
+		GROUP BY u.id, u.username, u.isadmin, l.max_wallpapers, l.max_bytes, l.user_id
+		ORDER BY COALESCE(SUM(w.size_bytes), 0) DESC, u.username
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var report []StorageUsage
+	for rows.Next() {
+		var u StorageUsage
+		var maxWallpapers, maxBytes sql.NullInt64
+		if err := rows.Scan(&u.UserID, &u.Username, &u.IsAdmin, &u.Wallpapers, &u.Bytes,
+			&maxWallpapers, &maxBytes, &u.Override); err != nil {
+			return nil, err
+		}
+		u.Quota = userQuota
+		if u.IsAdmin {
+			u.Quota = adminQuota
+		}
+		if maxWallpapers.Valid {
+			u.Quota.MaxWallpapers = int(maxWallpapers.Int64)
+			u.LimitWallpapers = strconv.Itoa(u.Quota.MaxWallpapers)
+		}
+		if maxBytes.Valid {
+			u.Quota.MaxBytes = maxBytes.Int64
+			u.LimitSize = exactSize(maxBytes.Int64)
+		}
+		report = append(report, u)
+	}
+	return report, rows.Err()
+}
+
+// checkQuota fails when userID can't store one more wallpaper of size bytes. Two uploads
+// running at the same time may both pass and go over by one file, that's accepted.
+func checkQuota(userID int, size int64) error {
+	u, err := storageUsage(userID)
+	if err != nil {
+		return err
+	}
+	q := u.Quota
+	if q.MaxWallpapers > 0 && u.Wallpapers+1 > q.MaxWallpapers {
+		return fmt.Errorf("%w: %d of %d wallpapers stored (the trash counts until it is emptied)",
+			errQuotaExceeded, u.Wallpapers, q.MaxWallpapers)
+	}
+	if q.MaxBytes > 0 && u.Bytes+size > q.MaxBytes {
+		return fmt.Errorf("%w: %s of %s used, this file needs %s",
+			errQuotaExceeded, FormatBytes(u.Bytes), FormatBytes(q.MaxBytes), FormatBytes(size))
+	}
+	return nil
+}
+
+// setStorageLimit overrides the quota of a user, nil fields keep the role's limit.
+// With both nil the override is removed.
+func setStorageLimit(userID int, maxWallpapers *int, maxBytes *int64, adminID int) error {
+	if maxWallpapers == nil && maxBytes == nil {
+		_, err := db.Exec("DELETE FROM storage_limits WHERE user_id = ?", userID)
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO storage_limits (user_id, max_wallpapers, max_bytes, updated_by)
+		VALUES (?, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE max_wallpapers = VALUES(max_wallpapers), max_bytes = VALUES(max_bytes),
+			updated_by = VALUES(updated_by), updated_at = NOW()
+	`, userID, maxWallpapers, maxBytes, adminID)
+	return err
+}
+
+// the percentage of the quota used, the higher of the count and the bytes, capped at 100
+func (u StorageUsage) Percent() int {
+	percent := 0
+	if u.Quota.MaxWallpapers > 0 {
+		percent = u.Wallpapers * 100 / u.Quota.MaxWallpapers
+	}
+	if u.Quota.MaxBytes > 0 {
+		percent = max(percent, int(u.Bytes*100/u.Quota.MaxBytes))
+	}
+	return min(percent, 100)
+}
+
+func (u StorageUsage) Unlimited() bool {
+	return u.Quota.MaxWallpapers == 0 && u.Quota.MaxBytes == 0
+}
+
+func (u StorageUsage) BytesText() string { return FormatBytes(u.Bytes) }
+
+func (q StorageQuota) BytesText() string {
+	if q.MaxBytes == 0 {
+		return "unlimited"
+	}
+	return FormatBytes(q.MaxBytes)
+}
+
+func (q StorageQuota) WallpapersText() string {
+	if q.MaxWallpapers == 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(q.MaxWallpapers)
+}
+
+var byteUnits = []string{"B", "KB", "MB", "GB", "TB"}
+
+// FormatBytes writes a size for humans: 1.5 GB
+func FormatBytes(n int64) string {
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(byteUnits)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return strings.TrimSuffix(fmt.Sprintf("%.1f", size), ".0") + " " + byteUnits[unit]
+}
+
+// exactSize writes a size ParseBytes reads back to the same number of bytes
+func exactSize(n int64) string {
+	switch {
+	case n > 0 && n%(1<<30) == 0:
+		return strconv.FormatInt(n>>30, 10) + " GB"
+	case n > 0 && n%(1<<20) == 0:
+		return strconv.FormatInt(n>>20, 10) + " MB"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// ParseBytes reads a size: 2147483648, 500MB, 2 GB, 1.5gb. 0 is unlimited.
+func ParseBytes(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for i := len(byteUnits) - 1; i > 0; i-- {
+		if strings.HasSuffix(s, byteUnits[i]) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, byteUnits[i]))
+			multiplier = 1 << (10 * i)
+			break
+		}
+	}
+	s = strings.TrimSpace(strings.TrimSuffix(s, "B"))
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	// past math.MaxInt64 the conversion overflows, and a negative limit would read as unlimited
+	// (float64(math.MaxInt64) rounds up to 2^63, hence the >=)
+	size := value * float64(multiplier)
+	if size >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+	return int64(size), nil
+}
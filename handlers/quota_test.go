@@ -0,0 +1,38 @@
+package handlers
+
+import "testing"
+
+func TestParseBytes(t *testing.T) {
+	valid := []struct {
+		in   string
+		want int64
+	}{
+		{"0", 0},
+		{"2147483648", 2147483648},
+		{"512 B", 512},
+		{"512b", 512},
+		{"4KB", 4 << 10},
+		{"500MB", 500 << 20},
+		{"2 GB", 2 << 30},
+		{"1.5gb", 3 << 29},
+		{" 3 TB ", 3 << 40},
+		{"8191 TB", 8191 << 40},
+	}
+	for _, tt := range valid {
+		got, err := ParseBytes(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseBytes(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"", "MB", "abc", "12 XB", "1,5 GB",
+		"-1", "-2 GB",
+		"NaN", "nan MB", "Inf", "+Inf GB", "-Inf",
+		"9223372036854775807", "8388608 TB", "1e30",
+	} {
+		if got, err := ParseBytes(in); err == nil {
+			t.Errorf("ParseBytes(%q) = %d, want an error", in, got)
+		}
+	}
+}
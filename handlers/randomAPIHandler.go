@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxRandomExclude  = 100 // exclude_recent
+	maxRandomClientID = 64
+	maxRandomClients  = 10000
+	randomClientTTL   = 24 * time.Hour // a client not seen for that long starts over
+)
+
+// the filters of /api/v1/random
+type randomParams struct {
+	Uploader      string
+	Orientation   string
+	MinWidth      int
+	MinHeight     int
+	Seed          string // same seed and filters, same wallpaper
+	ExcludeRecent int    // skip the last N wallpapers served to the client
+	Client        string
+	Redirect      bool
+}
+
+func parseRandomParams(r *http.Request) (randomParams, error) {
+	q := r.URL.Query()
+	p := randomParams{
+		Uploader:    strings.TrimSpace(q.Get("uploader")),
+		Orientation: q.Get("orientation"),
+		Seed:        q.Get("seed"),
+		Client:      q.Get("client"),
+		Redirect:    q.Get("redirect") == "true" || q.Get("redirect") == "1",
+	}
+	if p.Orientation != "" && !slices.Contains(Orientations, p.Orientation) {
+		return p, errors.New("orientation must be landscape, portrait or square")
+	}
+	for name, dst := range map[string]*int{"min_width": &p.MinWidth, "min_height": &p.MinHeight, "exclude_recent": &p.ExcludeRecent} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return p, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+	if p.ExcludeRecent > maxRandomExclude {
+		return p, fmt.Errorf("exclude_recent can't be more than %d", maxRandomExclude)
+	}
+	if len(p.Client) > maxRandomClientID {
+		return p, fmt.Errorf("client is too long (max %d characters)", maxRandomClientID)
+	}
+	return p, nil
+}
+
+// RandomAPIHandler picks a public wallpaper at random, for the desktop rotation scripts
+// GET /api/v1/random?uploader=...&orientation=landscape&min_width=1920&min_height=1080
+//
+//	&seed=2024-06-01      deterministic: the same seed and filters give the same wallpaper
+//	&exclude_recent=10    not one of the last 10 served to this client (if any other matches)
+//	&client=my-laptop     who "this client" is, the user or the IP by default
+//	&redirect=true        302 to the image instead of the JSON
+func RandomAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apiError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		return
+	}
+	p, err := parseRandomParams(r)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidField, err.Error())
+		return
+	}
+
+	client := randomClientKey(r, p.Client)
+	wp, err := pickRandomWallpaper(p, recentlyServed.last(client, p.ExcludeRecent))
+	if errors.Is(err, sql.ErrNoRows) {
+		apiError(w, http.StatusNotFound, CodeNotFound, "No public wallpaper matches these filters")
+		return
+	}
+	if err != nil {
+		log.Println("Failed to pick a random wallpaper:", err)
+		apiError(w, http.StatusInternalServerError, CodeInternal, "Failed to pick a wallpaper")
+		return
+	}
+	recentlyServed.add(client, wp.ID)
+
+	w.Header().Set("Cache-Control", "no-store")
+	if p.Redirect {
+		w.Header().Set("Location", "/uploads/"+url.PathEscape(wp.Filename))
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+	writeFields(w, http.StatusOK, viewOf(wp, nil), fields)
+}
+
+// pickRandomWallpaper draws one of the public wallpapers matching p, skipping the excluded ids
+// unless nothing else matches. With a seed, the draw is the same as long as the matches are.
+func pickRandomWallpaper(p randomParams, exclude []int) (Wallpaper, error) {
+	cond, args := listedToSQL(0)
+	where := []string{cond}
+	if p.Uploader != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, p.Uploader)
+	}
+	if p.MinWidth > 0 {
+		where = append(where, "w.width >= ?")
+		args = append(args, p.MinWidth)
+	}
+	if p.MinHeight > 0 {
+		where = append(where, "w.height >= ?")
+		args = append(args, p.MinHeight)
+	}
+	switch p.Orientation {
+	case "landscape":
+		where = append(where, "w.width > w.height")
+	case "portrait":
+		where = append(where, "w.width < w.height")
+	case "square":
+		where = append(where, "w.width = w.height AND w.width > 0")
+	}
+
+	base := `FROM wallpapers w JOIN users u ON u.id = w.user_id WHERE ` + strings.Join(where, " AND ")
+	query, queryArgs := base, args
+	if len(exclude) > 0 {
+		query += " AND w.id NOT IN (?" + strings.Repeat(", ?", len(exclude)-1) + ")"
+		for _, id := range exclude {
+			queryArgs = append(queryArgs, id)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) "+query, queryArgs...).Scan(&count); err != nil {
+		return Wallpaper{}, err
+	}
+	if count == 0 && len(exclude) > 0 {
+		// everything matching was served recently, start the rotation over
+		query, queryArgs = base, args
+		if err := db.QueryRow("SELECT COUNT(*) "+query, queryArgs...).Scan(&count); err != nil {
+			return Wallpaper{}, err
+		}
+	}
+	if count == 0 {
+		return Wallpaper{}, sql.ErrNoRows
+	}
+
+	offset := rand.IntN(count)
+	if p.Seed != "" {
+		h := fnv.New64a()
+		h.Write([]byte(p.Seed))
+		offset = int(h.Sum64() % uint64(count))
+	}
+	wp, err := scanWallpaper(db.QueryRow(`SELECT `+wallpaperColumnsSQL+` `+query+` ORDER BY w.id LIMIT 1 OFFSET ?`,
+		append(queryArgs, offset)...))
+	if err != nil {
+		return wp, err
+	}
+	tags, err := tagsByWallpaper(wp.ID)
+	if err != nil {
+		return wp, err
+	}
+	wp.Tags = tags[wp.ID]
+	return wp, nil
+}
+
+// who the recently served ids are remembered for: the client parameter, the user, or the IP
+func randomClientKey(r *http.Request, client string) string {
+	if client != "" {
+		return "client:" + client
+	}
+	if user := getAPIUser(r); user != nil {
+		return "user:" + strconv.Itoa(user.UserID)
+	}
+	return "ip:" + clientIP(r)
+}
+
+// recentlyServed remembers the last wallpapers served to each client, in memory:
+// a restart only means a wallpaper may come back sooner
+var recentlyServed = &servedIDs{clients: make(map[string]*servedClient)}
+
+type servedIDs struct {
+	mu      sync.Mutex
+	clients map[string]*servedClient
+}
+
+type servedClient struct {
+	ids  []int // oldest first, at most maxRandomExclude
+	seen time.Time
+}
+
+// returns the last n ids served to client
+func (s *servedIDs) last(client string, n int) []int {
+	if n == 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.clients[client]
+	if c == nil {
+		return nil
+	}
+	ids := c.ids
+	if len(ids) > n {
+		ids = ids[len(ids)-n:]
+	}
+	return slices.Clone(ids)
+}
+
+func (s *servedIDs) add(client string, id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	c := s.clients[client]
+	if c == nil {
+		if len(s.clients) >= maxRandomClients {
+			s.prune(now)
+			if len(s.clients) >= maxRandomClients {
+				return
+			}
+		}
+		c = &servedClient{}
+		s.clients[client] = c
+	}
+	c.seen = now
+	c.ids = append(c.ids, id)
+	if len(c.ids) > maxRandomExclude {
+		c.ids = c.ids[len(c.ids)-maxRandomExclude:]
+	}
+}
+
+// forgets the clients idle for longer than randomClientTTL, s.mu must be held
+func (s *servedIDs) prune(now time.Time) {
+	for key, c := range s.clients {
+		if now.Sub(c.seen) > randomClientTTL {
+			delete(s.clients, key)
+		}
+	}
+}
@@ -39,7 +39,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		_, err = db.Exec(`
+		result, err := db.Exec(`
 			INSERT INTO users (username, email, name, surname, password_hash)
 			VALUES (?, ?, ?, ?, ?)`,
 			username, email, name, surname, hashedPassword,
@@ -51,6 +51,10 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 		printAllUsers()
 
+		if id, err := result.LastInsertId(); err == nil {
+			emitWebhook(EventUserRegistered, 0, UserEventData{ID: int(id), Username: username})
+		}
+
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
@@ -0,0 +1,226 @@
+// / this file contains the scheduled publishing: publish_at / unpublish_at and the job applying them
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// format of the datetime-local inputs, the times are UTC like everywhere else on the site
+const scheduleInputFormat = "2006-01-02T15:04"
+
+var (
+	errScheduleInPast  = errors.New("the dates must be in the future")
+	errScheduleOrder   = errors.New("unpublish-at must be after publish-at")
+	errScheduleWhileUp = errors.New("the wallpaper is already public, only unpublish-at can be changed")
+	errScheduleEarlier = errors.New("the wallpaper is scheduled, only an admin can clear publish-at or move it earlier")
+)
+
+// StartScheduler applies the due publish_at / unpublish_at every interval, until the process exits.
+// Several instances can run it: transitions lock the row and check the state first,
+// so a wallpaper is only flipped once.
+func StartScheduler(interval time.Duration) {
+	go func() {
+		for {
+			runScheduler(time.Now())
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// runScheduler publishes the scheduled wallpapers whose publish_at is reached,
+// and unpublishes the public ones whose unpublish_at is reached (and clears it, see transitionWallpaper)
+func runScheduler(now time.Time) {
+	due := []struct {
+		query string
+		to    string
+	}{
+		{"SELECT id FROM wallpapers WHERE status = 'scheduled' AND deleted_at IS NULL AND (publish_at IS NULL OR publish_at <= ?)", StatusApproved},
+		{"SELECT id FROM wallpapers WHERE status = 'approved' AND deleted_at IS NULL AND unpublish_at <= ?", StatusUnpublished},
+	}
+
+	for _, d := range due {
+		ids, err := queryIDs(d.query, now)
+		if err != nil {
+			log.Println("Scheduler query failed:", err)
+			continue
+		}
+		for _, id := range ids {
+			if _, _, err := transitionWallpaper(id, schedulerActor, d.to, "", nil); err != nil {
+				log.Printf("Scheduler failed to move wallpaper %d to %s: %v", id, d.to, err)
+			}
+		}
+	}
+}
+
+func queryIDs(query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// parses a datetime-local input, empty means "not set"
+func parseScheduleTime(value string) (*time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation(scheduleInputFormat, value, time.UTC)
+	if err != nil {
+		return nil, errors.New("invalid date, expected YYYY-MM-DDTHH:MM")
+	}
+	return &t, nil
+}
+
+// setSchedule validates and saves the publish/unpublish times of a wallpaper.
+// publish_at can't move once the wallpaper is public.
+func setSchedule(wallpaperID int, status string, publishAt, unpublishAt *time.Time) error {
+	now := time.Now()
+	if publishAt != nil && status != StatusApproved && !publishAt.After(now) {
+		return errScheduleInPast
+	}
+	if unpublishAt != nil && !unpublishAt.After(now) {
+		return errScheduleInPast
+	}
+	if publishAt != nil && unpublishAt != nil && !unpublishAt.After(*publishAt) {
+		return errScheduleOrder
+	}
+
+	if status == StatusApproved {
+		_, err := db.Exec("UPDATE wallpapers SET unpublish_at = ? WHERE id = ?", unpublishAt, wallpaperID)
+		return err
+	}
+	_, err := db.Exec("UPDATE wallpapers SET publish_at = ?, unpublish_at = ? WHERE id = ?", publishAt, unpublishAt, wallpaperID)
+	return err
+}
+
+// ScheduleHandler sets when a wallpaper goes public once approved, and when it leaves (owner or admin)
+// form: wallpaper_id, publish_at, unpublish_at (YYYY-MM-DDTHH:MM UTC, empty to clear)
+func ScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	var status string
+	var currentPublishAt sql.NullTime
+	err = db.QueryRow("SELECT user_id, status, publish_at FROM wallpapers WHERE id = ? AND deleted_at IS NULL", wallpaperID).
+		Scan(&ownerID, &status, &currentPublishAt)
+	if err != nil {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	// the owner's own schedule, or an admin's on someone else's wallpaper, which is audited
+	asAdmin := ownerID != user.UserID
+	if asAdmin && !user.IsAdmin {
+		log.Printf("⚠️ Unauthorized schedule attempt: user %d on wallpaper owned by %d", user.UserID, ownerID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	publishAt, err := parseScheduleTime(r.FormValue("publish_at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	unpublishAt, err := parseScheduleTime(r.FormValue("unpublish_at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status == StatusApproved && publishAt != nil {
+		http.Error(w, errScheduleWhileUp.Error(), http.StatusConflict)
+		return
+	}
+	// the moderator approved it for that time: the owner can push it back but not clear it or go
+	// earlier, a scheduled wallpaper without publish_at goes public on the next tick. The form
+	// sends minutes, so an unchanged publish_at is compared at the minute.
+	if status == StatusScheduled && !user.IsAdmin && currentPublishAt.Valid &&
+		(publishAt == nil || publishAt.Before(currentPublishAt.Time.Truncate(time.Minute))) {
+		http.Error(w, errScheduleEarlier.Error(), http.StatusConflict)
+		return
+	}
+
+	if err := setSchedule(wallpaperID, status, publishAt, unpublishAt); err != nil {
+		if errors.Is(err, errScheduleInPast) || errors.Is(err, errScheduleOrder) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Println("Failed to save the schedule:", err)
+		http.Error(w, "Failed to save the schedule", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🗓️ Wallpaper %d scheduled (%v -> %v) by user %d", wallpaperID, publishAt, unpublishAt, user.UserID)
+	if asAdmin {
+		audit(r, user, AuditSchedule, AuditTargetWallpaper, wallpaperID, nil,
+			map[string]*time.Time{"publish_at": publishAt, "unpublish_at": unpublishAt})
+	}
+	http.Redirect(w, r, redirectBack(r, "/wallpapers"), http.StatusSeeOther)
+}
+
+// the schedule as datetime-local values, for the form inputs
+func (w Wallpaper) PublishAtInput() string   { return scheduleInput(w.PublishAt) }
+func (w Wallpaper) UnpublishAtInput() string { return scheduleInput(w.UnpublishAt) }
+
+func scheduleInput(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(scheduleInputFormat)
+}
+
+// scheduledWallpapers returns the user's upcoming releases: scheduled ones and public ones
+// with an unpublish_at, soonest first
+func scheduledWallpapers(userID int) ([]Wallpaper, error) {
+	rows, err := db.Query(`
+		SELECT id, filename, original_name, status, publish_at, unpublish_at
+		FROM wallpapers
+		WHERE user_id = ? AND deleted_at IS NULL AND (status = 'scheduled' OR (status = 'approved' AND unpublish_at IS NOT NULL))
+		ORDER BY COALESCE(IF(status = 'scheduled', publish_at, NULL), unpublish_at), id
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallpapers []Wallpaper
+	for rows.Next() {
+		var w Wallpaper
+		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.Status, &w.PublishAt, &w.UnpublishAt); err != nil {
+			return nil, err
+		}
+		wallpapers = append(wallpapers, w)
+	}
+	return wallpapers, rows.Err()
+}
@@ -0,0 +1,279 @@
+// / this file contains the wallpaper search: full-text on names/descriptions, tags and uploaders + filters
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type SearchParams struct {
+	Query       string    `json:"q,omitempty"`
+	Tag         string    `json:"tag,omitempty"`
+	Uploader    string    `json:"uploader,omitempty"`
+	MinWidth    int       `json:"min_width,omitempty"`
+	MinHeight   int       `json:"min_height,omitempty"`
+	Orientation string    `json:"orientation,omitempty"` // landscape, portrait or square
+	Color       string    `json:"color,omitempty"`       // one of ColorNames
+	From        time.Time `json:"from,omitzero"`
+	To          time.Time `json:"to,omitzero"`
+	Sort        string    `json:"sort"`
+	Page        int       `json:"page"`
+	Limit       int       `json:"limit"`
+}
+
+// sort options, relevance only makes sense with a query
+const (
+	SortRelevance  = "relevance"
+	SortNewest     = "newest"
+	SortOldest     = "oldest"
+	SortPopular    = "popular"
+	SortName       = "name"
+	SortResolution = "resolution"
+)
+
+var SortOptions = []string{SortRelevance, SortNewest, SortOldest, SortPopular, SortName, SortResolution}
+
+var Orientations = []string{"landscape", "portrait", "square"}
+
+const (
+	searchPageSize = 24
+	maxSearchTerms = 10
+	searchDate     = "2006-01-02"
+)
+
+// parseSearchParams reads the search form / query string
+func parseSearchParams(r *http.Request) (SearchParams, error) {
+	q := r.URL.Query()
+	p := SearchParams{
+		Query:       strings.TrimSpace(q.Get("q")),
+		Uploader:    strings.TrimSpace(q.Get("uploader")),
+		Orientation: q.Get("orientation"),
+		Color:       q.Get("color"),
+		Sort:        q.Get("sort"),
+		Page:        queryInt(r, "page", 1, 1, 1<<20),
+		Limit:       queryInt(r, "limit", searchPageSize, 1, 100),
+	}
+
+	tag, err := normalizeTag(q.Get("tag"))
+	if err != nil {
+		return p, err
+	}
+	p.Tag = tag
+
+	for name, dst := range map[string]*int{"min_width": &p.MinWidth, "min_height": &p.MinHeight} {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return p, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+
+	if p.Orientation != "" && !slices.Contains(Orientations, p.Orientation) {
+		return p, fmt.Errorf("orientation must be landscape, portrait or square")
+	}
+	if p.Color != "" && !slices.Contains(ColorNames, p.Color) {
+		return p, fmt.Errorf("unknown color %q", p.Color)
+	}
+
+	for name, dst := range map[string]*time.Time{"from": &p.From, "to": &p.To} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(searchDate, v)
+			if err != nil {
+				return p, fmt.Errorf("%s must be a YYYY-MM-DD date", name)
+			}
+			*dst = t
+		}
+	}
+
+	if p.Sort == "" {
+		p.Sort = SortNewest
+		if p.Query != "" {
+			p.Sort = SortRelevance
+		}
+	}
+	if !slices.Contains(SortOptions, p.Sort) {
+		return p, fmt.Errorf("unknown sort %q", p.Sort)
+	}
+	if p.Sort == SortRelevance && p.Query == "" {
+		p.Sort = SortNewest
+	}
+	return p, nil
+}
+
+// splits the query in words, only letters and digits are kept so nothing
+// gets interpreted by the boolean full-text syntax
+func searchTerms(query string) []string {
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) > maxSearchTerms {
+		words = words[:maxSearchTerms]
+	}
+	return words
+}
+
+// searchWallpapers returns a page of the wallpapers viewerID can see matching p, and whether there's more
+func searchWallpapers(p SearchParams, viewerID int) ([]Wallpaper, bool, error) {
+	cond, args := listedToSQL(viewerID)
+	where := []string{cond}
+	score := "0"
+	var scoreArgs []interface{}
+
+	if terms := searchTerms(p.Query); len(terms) > 0 {
+		// boolean mode "word*" per term, any of them may match
+		ftQuery := strings.Join(terms, "* ") + "*"
+		likeArgs := make([]interface{}, len(terms))
+		tagLikes := make([]string, len(terms))
+		userLikes := make([]string, len(terms))
+		for i, term := range terms {
+			likeArgs[i] = likeEscaper.Replace(term) + "%"
+			tagLikes[i] = "t.name LIKE ?"
+			userLikes[i] = "u.username LIKE ?"
+		}
+		tagMatch := `(SELECT COUNT(*) FROM wallpaper_tags wt JOIN tags t ON t.id = wt.tag_id
+			WHERE wt.wallpaper_id = w.id AND (` + strings.Join(tagLikes, " OR ") + `))`
+		userMatch := "(" + strings.Join(userLikes, " OR ") + ")"
+		textMatch := "MATCH(w.original_name, w.description) AGAINST (? IN BOOLEAN MODE)"
+
+		// tags and uploader weigh more than a word somewhere in a description
+		score = textMatch + " + 2 * " + tagMatch + " + 3 * " + userMatch
+		scoreArgs = append(scoreArgs, ftQuery)
+		scoreArgs = append(scoreArgs, likeArgs...)
+		scoreArgs = append(scoreArgs, likeArgs...)
+
+		where = append(where, "("+textMatch+" OR "+tagMatch+" > 0 OR "+userMatch+")")
+		args = append(args, ftQuery)
+		args = append(args, likeArgs...)
+		args = append(args, likeArgs...)
+	}
+
+	if p.Tag != "" {
+		where = append(where, `EXISTS (SELECT 1 FROM wallpaper_tags wt
+			JOIN tags t ON t.id = wt.tag_id
+			JOIN tags s ON s.name = ? AND t.id = COALESCE(s.alias_of, s.id)
+			WHERE wt.wallpaper_id = w.id)`)
+		args = append(args, p.Tag)
+	}
+	if p.Uploader != "" {
+		where = append(where, "u.username = ?")
+		args = append(args, p.Uploader)
+	}
+	if p.MinWidth > 0 {
+		where = append(where, "w.width >= ?")
+		args = append(args, p.MinWidth)
+	}
+	if p.MinHeight > 0 {
+		where = append(where, "w.height >= ?")
+		args = append(args, p.MinHeight)
+	}
+	switch p.Orientation {
+	case "landscape":
+		where = append(where, "w.width > w.height")
+	case "portrait":
+		where = append(where, "w.width < w.height")
+	case "square":
+		where = append(where, "w.width = w.height AND w.width > 0")
+	}
+	if p.Color != "" {
+		where = append(where, "w.color_name = ?")
+		args = append(args, p.Color)
+	}
+	if !p.From.IsZero() {
+		where = append(where, "w.uploaded_at >= ?")
+		args = append(args, p.From)
+	}
+	if !p.To.IsZero() {
+		where = append(where, "w.uploaded_at < ?")
+		args = append(args, p.To.AddDate(0, 0, 1)) // the "to" day is included
+	}
+
+	order := map[string]string{
+		SortRelevance:  "score DESC, w.uploaded_at DESC",
+		SortNewest:     "w.uploaded_at DESC",
+		SortOldest:     "w.uploaded_at ASC",
+		SortPopular:    "(SELECT COUNT(*) FROM favorites f WHERE f.wallpaper_id = w.id) DESC, w.uploaded_at DESC",
+		SortName:       "w.original_name ASC",
+		SortResolution: "w.width * w.height DESC, w.uploaded_at DESC",
+	}[p.Sort]
+
+	query := `
+		SELECT w.id, w.filename, w.original_name, COALESCE(w.description, ''), w.uploaded_at,
+			w.width, w.height, COALESCE(w.dominant_color, ''), w.status, u.username, ` + score + ` AS score
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		WHERE ` + strings.Join(where, " AND ") + `
+		ORDER BY ` + order + `, w.id DESC
+		LIMIT ? OFFSET ?`
+	// one extra row to know if there's a next page
+	allArgs := append(scoreArgs, args...)
+	allArgs = append(allArgs, p.Limit+1, (p.Page-1)*p.Limit)
+
+	rows, err := db.Query(query, allArgs...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	wallpapers := []Wallpaper{}
+	for rows.Next() {
+		var w Wallpaper
+		var score float64
+		err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.Description, &w.UploadedAt,
+			&w.Width, &w.Height, &w.DominantColor, &w.Status, &w.Owner, &score)
+		if err != nil {
+			return nil, false, err
+		}
+		wallpapers = append(wallpapers, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	hasMore := len(wallpapers) > p.Limit
+	if hasMore {
+		wallpapers = wallpapers[:p.Limit]
+	}
+	attachTags(wallpapers)
+	return wallpapers, hasMore, nil
+}
+
+// query string of p for another page, used by the pagination links
+func (p SearchParams) PageURL(page int) string {
+	values := url.Values{}
+	set := func(key, value string) {
+		if value != "" && value != "0" {
+			values.Set(key, value)
+		}
+	}
+	set("q", p.Query)
+	set("tag", p.Tag)
+	set("uploader", p.Uploader)
+	set("min_width", strconv.Itoa(p.MinWidth))
+	set("min_height", strconv.Itoa(p.MinHeight))
+	set("orientation", p.Orientation)
+	set("color", p.Color)
+	set("from", p.FromDate())
+	set("to", p.ToDate())
+	set("sort", p.Sort)
+	set("page", strconv.Itoa(page))
+	return "/search?" + values.Encode()
+}
+
+// dates as YYYY-MM-DD for the form inputs, empty when not set
+func (p SearchParams) FromDate() string { return formatSearchDate(p.From) }
+func (p SearchParams) ToDate() string   { return formatSearchDate(p.To) }
+
+func formatSearchDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(searchDate)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+type SearchPageData struct {
+	Username     string
+	IsAdmin      bool
+	LoggedIn     bool
+	Params       SearchParams
+	Results      []Wallpaper
+	HasMore      bool
+	Error        string
+	Colors       []string
+	Orientations []string
+	SortOptions  []string
+}
+
+type SearchResponse struct {
+	Params  SearchParams `json:"params"`
+	Results []Wallpaper  `json:"results"`
+	Page    int          `json:"page"`
+	HasMore bool         `json:"has_more"`
+}
+
+// SearchHandler renders the search form and its results
+// URL format: /search?q=...&tag=...&uploader=...&min_width=...&orientation=...&color=...&from=...&to=...&sort=...&page=...
+func SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := SearchPageData{
+		Colors:       ColorNames,
+		Orientations: Orientations,
+		SortOptions:  SortOptions,
+	}
+	viewerID := 0
+	if user := getCurrentUser(r); user != nil {
+		viewerID = user.UserID
+		data.Username = user.Username
+		data.IsAdmin = user.IsAdmin
+		data.LoggedIn = true
+	}
+
+	params, err := parseSearchParams(r)
+	data.Params = params
+	if err != nil {
+		data.Error = err.Error()
+	} else {
+		data.Results, data.HasMore, err = searchWallpapers(params, viewerID)
+		if err != nil {
+			log.Println("Search failed:", err)
+			http.Error(w, "Search failed", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	if err := templates.ExecuteTemplate(w, "search.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// SearchAPIHandler is the JSON version of SearchHandler, same parameters (+ limit)
+func SearchAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	viewerID := 0
+	if user := getAPIUser(r); user != nil {
+		viewerID = user.UserID
+	}
+
+	params, err := parseSearchParams(r)
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	results, hasMore, err := searchWallpapers(params, viewerID)
+	if err != nil {
+		log.Println("Search failed:", err)
+		jsonError(w, http.StatusInternalServerError, "Search failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, SearchResponse{
+		Params:  params,
+		Results: results,
+		Page:    params.Page,
+		HasMore: hasMore,
+	})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// UploadsHandler serves /uploads/{filename} only to users allowed to see that wallpaper
+func UploadsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	filename := strings.TrimPrefix(r.URL.Path, "/uploads/")
+	if filename == "" || filename != filepath.Base(filename) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var wallpaperID int
+	err := db.QueryRow("SELECT id FROM wallpapers WHERE filename = ?", filename).Scan(&wallpaperID)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// wpctl downloads the files with its token
+	visible, err := canViewWallpaperAs(getAPIUser(r), wallpaperID)
+	if err != nil {
+		log.Println("ACL check failed:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	// 404 and not 403, to not leak that the file exists
+	if !visible {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeFile(w, r, filepath.Join("web/uploads", filename))
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ShareHandler sets who can see a private wallpaper: nobody, all friends, or selected friends.
+// This doesn't go through the admin review, public visibility still does.
+func ShareHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := getUserIDFromSession(r)
+	if err != nil {
+		log.Println("Session error:", err)
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	mode := r.FormValue("share_mode")
+	if mode != ShareNone && mode != ShareFriends && mode != ShareSelected {
+		http.Error(w, "Invalid share mode", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	err = db.QueryRow("SELECT user_id FROM wallpapers WHERE id = ?", wallpaperID).Scan(&ownerID)
+	if err != nil {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	if ownerID != userID {
+		log.Printf("⚠️ Unauthorized share attempt: user %d tried to share wallpaper owned by %d", userID, ownerID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	// only accepted friends can be selected
+	var friendIDs []int
+	if mode == ShareSelected {
+		for _, raw := range r.Form["friend_ids"] {
+			friendID, err := strconv.Atoi(raw)
+			if err != nil || !areFriends(userID, friendID) {
+				continue
+			}
+			friendIDs = append(friendIDs, friendID)
+		}
+	}
+
+	before, err := sharesByWallpaper(userID)
+	if err != nil {
+		log.Println("Failed to query shares:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Println("Failed to start transaction:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE wallpapers SET share_mode = ? WHERE id = ?", mode, wallpaperID); err != nil {
+		log.Println("Failed to update share mode:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM wallpaper_shares WHERE wallpaper_id = ?", wallpaperID); err != nil {
+		log.Println("Failed to clear shares:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	for _, friendID := range friendIDs {
+		if _, err := tx.Exec("INSERT INTO wallpaper_shares (wallpaper_id, user_id) VALUES (?, ?)", wallpaperID, friendID); err != nil {
+			log.Println("Failed to share wallpaper:", err)
+			http.Error(w, "Database error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Failed to commit shares:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+
+	// only tell the friends that were just added
+	username := getUsername(userID)
+	for _, friendID := range friendIDs {
+		if !before[wallpaperID][friendID] {
+			notify(friendID, userID, NotifShared, wallpaperID, username+" shared a wallpaper with you")
+		}
+	}
+
+	log.Printf("Wallpaper %d shared (%s) by user %d", wallpaperID, mode, userID)
+	http.Redirect(w, r, "/wallpapers", http.StatusSeeOther)
+}
@@ -3,10 +3,12 @@ package handlers
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"time"
 )
 
@@ -30,30 +32,53 @@ type UserProfile struct {
 	Surname  string
 	IsAdmin  bool
 	UserID   int
+	Badges   []Badge
+	Storage  *StorageUsage // on the profile page
 }
 
 type AdminPanelData struct {
 	CurrentUser *UserProfile
 	AllUsers    []UserProfile
 	Wallpapers  []Wallpaper
+	NextCursor  string // next page of the review queue
+	Badges      []Badge
 }
 
 type Wallpaper struct {
-	ID           int
-	UserID       int
-	Filename     string
-	OriginalName string
-	FilePath     string
-	UploadedAt   time.Time
-	IsPublic     bool
-	ToReview     bool
+	ID              int          `json:"id"`
+	UserID          int          `json:"user_id,omitempty"`
+	Filename        string       `json:"filename"`
+	OriginalName    string       `json:"original_name"`
+	Description     string       `json:"description,omitempty"`
+	FilePath        string       `json:"-"`
+	UploadedAt      time.Time    `json:"uploaded_at"`
+	Width           int          `json:"width,omitempty"`
+	Height          int          `json:"height,omitempty"`
+	DominantColor   string       `json:"dominant_color,omitempty"` // #rrggbb
+	SHA256          string       `json:"sha256,omitempty"`         // of the file, to check the downloads
+	Status          string       `json:"status,omitempty"`         // moderation state, see moderation.go
+	RejectionReason string       `json:"rejection_reason,omitempty"`
+	PublishAt       *time.Time   `json:"publish_at,omitempty"`   // goes public then, once approved
+	UnpublishAt     *time.Time   `json:"unpublish_at,omitempty"` // leaves the community then
+	ArchivedAt      *time.Time   `json:"archived_at,omitempty"`  // hidden from the listings since, see archive.go
+	DeletedAt       *time.Time   `json:"deleted_at,omitempty"`   // in the trash since, see trash.go
+	ShareMode       string       `json:"share_mode,omitempty"`
+	SharedWith      map[int]bool `json:"-"` // friend ids, when ShareMode is "selected"
+	Owner           string       `json:"owner,omitempty"`
+	Tags            []string     `json:"tags,omitempty"`
 }
 
 type WallpapersPageData struct {
-	Wallpapers  []Wallpaper
-	CurrentUser *UserProfile
-	Username    string
-	IsAdmin     bool
+	Wallpapers       []Wallpaper
+	SharedWallpapers []Wallpaper
+	Scheduled        []Wallpaper // upcoming releases, on /wallpapers
+	Archived         bool        // the page is the archive (/archive) and not the main grid
+	Friends          []UserProfile
+	Collections      []Collection // the user's collections, for the "add to collection" forms
+	CurrentUser      *UserProfile
+	Username         string
+	IsAdmin          bool
+	NextCursor       string // next page of Wallpapers, empty on the last one
 }
 
 type PageData struct {
@@ -72,7 +97,8 @@ func getPageData(r *http.Request) PageData {
 	return data
 }
 
-// returns user ID from session WITH expiry check
+// returns user ID from session WITH expiry check. The personal tokens are not read here,
+// only by the API handlers that call getAPIUser (see tokens.go).
 func getUserIDFromSession(r *http.Request) (int, error) {
 	cookie, err := r.Cookie("session_id")
 	if err != nil {
@@ -102,9 +128,13 @@ func getCurrentUser(r *http.Request) *UserProfile {
 	if err != nil {
 		return nil
 	}
+	return loadUser(userID)
+}
 
+// returns the user with that ID or nil
+func loadUser(userID int) *UserProfile {
 	var user UserProfile
-	err = db.QueryRow("SELECT id, username, email, name, surname, isadmin FROM users WHERE id = ?", userID).
+	err := db.QueryRow("SELECT id, username, email, name, surname, isadmin FROM users WHERE id = ?", userID).
 		Scan(&user.UserID, &user.Username, &user.Email, &user.Name, &user.Surname, &user.IsAdmin)
 	if err != nil {
 		return nil
@@ -113,6 +143,58 @@ func getCurrentUser(r *http.Request) *UserProfile {
 	return &user
 }
 
+// returns the logged-in admin, or writes the redirect/403 and returns nil
+func requireAdmin(w http.ResponseWriter, r *http.Request) *UserProfile {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return nil
+	}
+	if !user.IsAdmin {
+		log.Printf("⚠️ Non-admin user %s tried to access %s", user.Username, r.URL.Path)
+		http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
+		return nil
+	}
+	return user
+}
+
+// returns the username of userID, used in notification messages
+func getUsername(userID int) string {
+	var username string
+	if err := db.QueryRow("SELECT username FROM users WHERE id = ?", userID).Scan(&username); err != nil {
+		return "Someone"
+	}
+	return username
+}
+
+// returns the local page the request came from, or fallback
+func redirectBack(r *http.Request, fallback string) string {
+	ref, err := url.Parse(r.Referer())
+	if err != nil || ref.Path == "" || ref.Host != r.Host {
+		return fallback
+	}
+	if ref.RawQuery != "" {
+		return ref.Path + "?" + ref.RawQuery
+	}
+	return ref.Path
+}
+
+// turns sql.ErrNoRows into nil, for queries where "no row" is a valid answer
+func ignoreNoRows(err error) error {
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	return err
+}
+
+// stores "" as NULL
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
 // prints all users to console
 func printAllUsers() {
 	rows, err := db.Query("SELECT id, username, email, name, surname, created_at FROM users")
@@ -135,3 +217,22 @@ func printAllUsers() {
 			id, username, email, name, surname, createdAt.Format("2006-01-02 15:04:05"))
 	}
 }
+
+// ErrorResponse is the body written by jsonError
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// writes {"error": message} with the given status code
+func jsonError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, ErrorResponse{Error: message})
+}
+
+// writes v as JSON with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("JSON encode error:", err)
+	}
+}
@@ -0,0 +1,154 @@
+// / this file contains the friendship helpers and the sharing ACL every wallpaper read path goes through
+package handlers
+
+import (
+	"net/http"
+)
+
+// share modes of a private wallpaper
+const (
+	ShareNone     = "none"
+	ShareFriends  = "friends"
+	ShareSelected = "selected"
+)
+
+// friendship statuses
+const (
+	FriendPending  = "pending"
+	FriendAccepted = "accepted"
+	FriendDeclined = "declined"
+	FriendBlocked  = "blocked"
+)
+
+// SQL condition (wallpapers aliased as w) for "viewer is an accepted friend of the owner"
+const friendOfOwnerSQL = `EXISTS (
+	SELECT 1 FROM friendships f
+	WHERE f.status = 'accepted'
+	AND ((f.requester_id = w.user_id AND f.addressee_id = ?) OR (f.requester_id = ? AND f.addressee_id = w.user_id))
+)`
+
+// returns the SQL condition (wallpapers aliased as w) + args for "viewerID can see this wallpaper".
+// viewerID 0 means logged out: only public wallpapers. Wallpapers in the trash are never listed.
+func visibleToSQL(viewerID int) (string, []interface{}) {
+	if viewerID == 0 {
+		return "w.deleted_at IS NULL AND w.status = 'approved'", nil
+	}
+	cond := `w.deleted_at IS NULL AND (w.status = 'approved'
+		OR w.user_id = ?
+		OR (w.share_mode = 'friends' AND ` + friendOfOwnerSQL + `)
+		OR (w.share_mode = 'selected' AND ` + friendOfOwnerSQL + `
+			AND EXISTS (SELECT 1 FROM wallpaper_shares s WHERE s.wallpaper_id = w.id AND s.user_id = ?)))`
+	return cond, []interface{}{viewerID, viewerID, viewerID, viewerID, viewerID, viewerID}
+}
+
+// returns the SQL condition + args for the wallpapers listed to viewerID (galleries, search, tags, ...):
+// the visible ones, minus the archived ones which only show in their owner's archive
+func listedToSQL(viewerID int) (string, []interface{}) {
+	cond, args := visibleToSQL(viewerID)
+	return cond + " AND w.archived_at IS NULL", args
+}
+
+// returns the SQL condition + args for wallpapers shared with viewerID by someone else (not public ones)
+func sharedWithSQL(viewerID int) (string, []interface{}) {
+	cond, args := listedToSQL(viewerID)
+	return cond + " AND w.status <> 'approved' AND w.user_id <> ?", append(args, viewerID)
+}
+
+// canViewWallpaper checks the sharing ACL for one wallpaper for the logged-in user
+func canViewWallpaper(r *http.Request, wallpaperID int) (bool, error) {
+	return canViewWallpaperAs(getCurrentUser(r), wallpaperID)
+}
+
+// canViewWallpaperAs checks the sharing ACL for one wallpaper, nil is a visitor. Admins see
+// everything and owners still see theirs once in the trash.
+func canViewWallpaperAs(user *UserProfile, wallpaperID int) (bool, error) {
+	viewerID := 0
+	if user != nil {
+		if user.IsAdmin {
+			var exists bool
+			err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM wallpapers WHERE id = ?)", wallpaperID).Scan(&exists)
+			return exists, err
+		}
+		viewerID = user.UserID
+	}
+
+	cond, args := visibleToSQL(viewerID)
+	var visible bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM wallpapers w WHERE w.id = ? AND (w.user_id = ? OR "+cond+"))",
+		append([]interface{}{wallpaperID, viewerID}, args...)...).Scan(&visible)
+	return visible, err
+}
+
+// returns the friendship row between two users in either direction
+func friendshipBetween(a, b int) (id, requesterID int, status string, err error) {
+	err = db.QueryRow(`
+		SELECT id, requester_id, status FROM friendships
+		WHERE (requester_id = ? AND addressee_id = ?) OR (requester_id = ? AND addressee_id = ?)
+		ORDER BY status = 'blocked' DESC
+		LIMIT 1
+	`, a, b, b, a).Scan(&id, &requesterID, &status)
+	return
+}
+
+func areFriends(a, b int) bool {
+	_, _, status, err := friendshipBetween(a, b)
+	return err == nil && status == FriendAccepted
+}
+
+// true if either user blocked the other
+func isBlocked(a, b int) bool {
+	_, _, status, err := friendshipBetween(a, b)
+	return err == nil && status == FriendBlocked
+}
+
+// returns the accepted friends of userID
+func listFriends(userID int) ([]UserProfile, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username
+		FROM friendships f
+		JOIN users u ON u.id = IF(f.requester_id = ?, f.addressee_id, f.requester_id)
+		WHERE f.status = 'accepted' AND (f.requester_id = ? OR f.addressee_id = ?)
+		ORDER BY u.username
+	`, userID, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var friends []UserProfile
+	for rows.Next() {
+		var u UserProfile
+		if err := rows.Scan(&u.UserID, &u.Username); err != nil {
+			return nil, err
+		}
+		friends = append(friends, u)
+	}
+	return friends, rows.Err()
+}
+
+// returns wallpaper id -> set of friends it is shared with, for the owner's wallpapers
+func sharesByWallpaper(ownerID int) (map[int]map[int]bool, error) {
+	rows, err := db.Query(`
+		SELECT s.wallpaper_id, s.user_id
+		FROM wallpaper_shares s
+		JOIN wallpapers w ON w.id = s.wallpaper_id
+		WHERE w.user_id = ?
+	`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shares := make(map[int]map[int]bool)
+	for rows.Next() {
+		var wallpaperID, userID int
+		if err := rows.Scan(&wallpaperID, &userID); err != nil {
+			return nil, err
+		}
+		if shares[wallpaperID] == nil {
+			shares[wallpaperID] = make(map[int]bool)
+		}
+		shares[wallpaperID][userID] = true
+	}
+	return shares, rows.Err()
+}
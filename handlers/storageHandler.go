@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type StoragePageData struct {
+	Username   string
+	IsAdmin    bool
+	Users      []StorageUsage
+	UserQuota  StorageQuota
+	AdminQuota StorageQuota
+	TotalBytes int64
+}
+
+func (d StoragePageData) TotalText() string { return FormatBytes(d.TotalBytes) }
+
+// AdminStorageHandler lists what every user stores against their quota (admin)
+func AdminStorageHandler(w http.ResponseWriter, r *http.Request) {
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
+	users, err := storageReport()
+	if err != nil {
+		log.Println("Failed to build the storage report:", err)
+		http.Error(w, "Failed to load the storage report", http.StatusInternalServerError)
+		return
+	}
+
+	data := StoragePageData{
+		Username:   admin.Username,
+		IsAdmin:    admin.IsAdmin,
+		Users:      users,
+		UserQuota:  userQuota,
+		AdminQuota: adminQuota,
+	}
+	for _, u := range users {
+		data.TotalBytes += u.Bytes
+	}
+	if err := templates.ExecuteTemplate(w, "admin-storage.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// StorageLimitHandler sets the quota of one user (admin). A blank field keeps the limit of
+// their role, 0 is unlimited.
+func StorageLimitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
+	userID, err := strconv.Atoi(r.FormValue("user_id"))
+	if err != nil {
+		http.Error(w, "User ID missing", http.StatusBadRequest)
+		return
+	}
+
+	var maxWallpapers *int
+	if v := strings.TrimSpace(r.FormValue("max_wallpapers")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "The number of wallpapers must be a positive number", http.StatusBadRequest)
+			return
+		}
+		maxWallpapers = &n
+	}
+	var maxBytes *int64
+	if v := strings.TrimSpace(r.FormValue("max_size")); v != "" {
+		n, err := ParseBytes(v)
+		if err != nil {
+			http.Error(w, "The size must be a number of bytes or e.g. 500 MB, 5 GB", http.StatusBadRequest)
+			return
+		}
+		maxBytes = &n
+	}
+
+	before, err := storageUsage(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Database error:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	if err := setStorageLimit(userID, maxWallpapers, maxBytes, admin.UserID); err != nil {
+		log.Println("Database error:", err)
+		http.Error(w, "Database error", http.StatusInternalServerError)
+		return
+	}
+	after, _, err := quotaFor(userID, before.IsAdmin)
+	if err != nil {
+		log.Println("Database error:", err)
+	}
+
+	log.Printf("Storage quota of user %d set to %s wallpapers, %s by admin %s",
+		userID, after.WallpapersText(), after.BytesText(), admin.Username)
+	audit(r, admin, AuditStorageLimit, AuditTargetUser, userID, before.Quota, after)
+	http.Redirect(w, r, "/admin/storage", http.StatusSeeOther)
+}
@@ -0,0 +1,345 @@
+// / this file contains the Atom and JSON Feed outputs of the public galleries (see syndicationHandler.go)
+package handlers
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// feed formats, the extension of the feed URLs
+const (
+	FeedAtom = "atom"
+	FeedJSON = "json"
+)
+
+const (
+	feedSize   = 50
+	feedMaxAge = 5 * time.Minute
+)
+
+// a feed of public wallpapers: the community, an uploader, a tag or a collection
+type feedSource struct {
+	Title       string
+	Description string
+	Page        string // path of the HTML page the feed follows
+	Path        string // path of the feed, without the extension
+	Author      string // the uploader or the curator, if there's one
+	Updated     time.Time
+	Created     time.Time // of the user, tag or collection, the date of the feed while it is empty
+
+	join      string        // extra JOIN on wallpapers w
+	cond      string        // extra condition
+	args      []interface{} // of the join, then of the condition
+	timeOrder string        // the date of an entry, newest first
+}
+
+// one entry: a wallpaper and the date it entered the feed
+type feedEntry struct {
+	Wallpaper
+	Date time.Time
+}
+
+// a file of a wallpaper linked from the entries, the original is the only variant stored
+type feedEnclosure struct {
+	URL   string
+	Type  string
+	Size  int64
+	Title string
+}
+
+// feedEntries returns the newest public wallpapers of the source
+func feedEntries(src feedSource) ([]feedEntry, error) {
+	listed, listedArgs := listedToSQL(0)
+	order := src.timeOrder
+	if order == "" {
+		order = "COALESCE(w.published_at, w.uploaded_at)"
+	}
+	cond := listed
+	if src.cond != "" {
+		cond = src.cond + " AND " + listed
+	}
+	args := append(append(append([]interface{}{}, src.args...), listedArgs...), feedSize)
+
+	rows, err := db.Query(`
+		SELECT w.id, w.user_id, u.username, w.filename, w.original_name, COALESCE(w.description, ''),
+			w.width, w.height, `+order+`
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		`+src.join+`
+		WHERE `+cond+`
+		ORDER BY `+order+` DESC, w.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []feedEntry
+	for rows.Next() {
+		var e feedEntry
+		if err := rows.Scan(&e.ID, &e.UserID, &e.Owner, &e.Filename, &e.OriginalName, &e.Description,
+			&e.Width, &e.Height, &e.Date); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	wallpapers := make([]Wallpaper, len(entries))
+	for i := range entries {
+		wallpapers[i] = entries[i].Wallpaper
+	}
+	attachTags(wallpapers)
+	for i := range entries {
+		entries[i].Tags = wallpapers[i].Tags
+	}
+	return entries, nil
+}
+
+// the date of the newest entry, or of the source when it is empty
+func feedUpdated(src feedSource, entries []feedEntry) time.Time {
+	updated := src.Updated
+	if src.Created.After(updated) {
+		updated = src.Created
+	}
+	for _, e := range entries {
+		if e.Date.After(updated) {
+			updated = e.Date
+		}
+	}
+	return updated.UTC().Truncate(time.Second)
+}
+
+// the public address of the site, e.g. https://wallpapers.example.com (see SetSiteURL)
+var siteBaseURL string
+
+// SetSiteURL sets the address the absolute links of the feeds are built on
+func SetSiteURL(base string) {
+	siteBaseURL = strings.TrimSuffix(base, "/")
+}
+
+// siteURL is the base of the absolute links of the feeds: the configured address, or the scheme
+// and host the request came in on when there is none. The Host header is the client's, so a page
+// built on it must not be shared between clients (configured is false).
+func siteURL(r *http.Request) (base string, configured bool) {
+	if siteBaseURL != "" {
+		return siteBaseURL, true
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host, false
+}
+
+func feedEnclosures(base string, wp Wallpaper) []feedEnclosure {
+	original := feedEnclosure{
+		URL:   base + "/uploads/" + url.PathEscape(wp.Filename),
+		Type:  mime.TypeByExtension(strings.ToLower(filepath.Ext(wp.Filename))),
+		Title: "original",
+	}
+	if wp.Width > 0 && wp.Height > 0 {
+		original.Title = fmt.Sprintf("original %d×%d", wp.Width, wp.Height)
+	}
+	if info, err := os.Stat(filepath.Join("web/uploads", wp.Filename)); err == nil {
+		original.Size = info.Size()
+	}
+	return []feedEnclosure{original}
+}
+
+// the HTML body of an entry: the picture and its description
+func feedContent(base string, wp Wallpaper) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<p><img src="%s" alt="%s"></p>`,
+		html.EscapeString(base+"/uploads/"+url.PathEscape(wp.Filename)), html.EscapeString(wp.OriginalName))
+	if wp.Description != "" {
+		fmt.Fprintf(&b, "<p>%s</p>", html.EscapeString(wp.Description))
+	}
+	fmt.Fprintf(&b, `<p>by <a href="%s">%s</a></p>`,
+		html.EscapeString(base+"/u/"+url.PathEscape(wp.Owner)), html.EscapeString(wp.Owner))
+	return b.String()
+}
+
+// the permanent id of an entry, the API URL of the wallpaper
+func feedEntryID(base string, wp Wallpaper) string {
+	return base + "/api/v1/wallpapers/" + strconv.Itoa(wp.ID)
+}
+
+// ───── Atom (RFC 4287) ─────
+
+type atomFeed struct {
+	XMLName   xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Subtitle  string      `xml:"subtitle,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Links     []atomLink  `xml:"link"`
+	Generator string      `xml:"generator"`
+	Entries   []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Author     atomPerson     `xml:"author"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary,omitempty"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+	URI  string `xml:"uri,omitempty"`
+}
+
+type atomLink struct {
+	Rel    string `xml:"rel,attr,omitempty"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+	Title  string `xml:"title,attr,omitempty"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+func renderAtom(base string, src feedSource, entries []feedEntry) ([]byte, error) {
+	feed := atomFeed{
+		ID:       base + src.Path + ".atom",
+		Title:    src.Title,
+		Subtitle: src.Description,
+		Updated:  feedUpdated(src, entries).Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: base + src.Path + ".atom", Type: "application/atom+xml"},
+			{Rel: "alternate", Href: base + src.Page, Type: "text/html"},
+			{Rel: "alternate", Href: base + src.Path + ".json", Type: "application/feed+json"},
+		},
+		Generator: "WPManager",
+		Entries:   []atomEntry{},
+	}
+	if src.Author != "" {
+		feed.Author = &atomPerson{Name: src.Author, URI: base + "/u/" + url.PathEscape(src.Author)}
+	}
+
+	for _, e := range entries {
+		date := e.Date.UTC().Format(time.RFC3339)
+		entry := atomEntry{
+			ID:        feedEntryID(base, e.Wallpaper),
+			Title:     e.OriginalName,
+			Published: date,
+			Updated:   date,
+			Author:    atomPerson{Name: e.Owner, URI: base + "/u/" + url.PathEscape(e.Owner)},
+			Summary:   e.Description,
+			Content:   atomContent{Type: "html", Body: feedContent(base, e.Wallpaper)},
+		}
+		for i, enc := range feedEnclosures(base, e.Wallpaper) {
+			if i == 0 {
+				entry.Links = append(entry.Links, atomLink{Rel: "alternate", Href: enc.URL, Type: enc.Type})
+			}
+			entry.Links = append(entry.Links, atomLink{Rel: "enclosure", Href: enc.URL, Type: enc.Type, Length: enc.Size, Title: enc.Title})
+		}
+		for _, tag := range e.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	body, err := xml.MarshalIndent(feed, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), body...), nil
+}
+
+// ───── JSON Feed 1.1 (https://jsonfeed.org/version/1.1) ─────
+
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	Description string           `json:"description,omitempty"`
+	Authors     []jsonFeedAuthor `json:"authors,omitempty"`
+	Items       []jsonFeedItem   `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url"`
+	Title         string               `json:"title"`
+	ContentHTML   string               `json:"content_html"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image"`
+	DatePublished time.Time            `json:"date_published"`
+	Authors       []jsonFeedAuthor     `json:"authors"`
+	Tags          []string             `json:"tags,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type jsonFeedAttachment struct {
+	URL         string `json:"url"`
+	MimeType    string `json:"mime_type"`
+	Title       string `json:"title,omitempty"`
+	SizeInBytes int64  `json:"size_in_bytes,omitempty"`
+}
+
+func renderJSONFeed(base string, src feedSource, entries []feedEntry) ([]byte, error) {
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       src.Title,
+		HomePageURL: base + src.Page,
+		FeedURL:     base + src.Path + ".json",
+		Description: src.Description,
+		Items:       []jsonFeedItem{},
+	}
+	if src.Author != "" {
+		feed.Authors = []jsonFeedAuthor{{Name: src.Author, URL: base + "/u/" + url.PathEscape(src.Author)}}
+	}
+
+	for _, e := range entries {
+		item := jsonFeedItem{
+			ID:            feedEntryID(base, e.Wallpaper),
+			Title:         e.OriginalName,
+			ContentHTML:   feedContent(base, e.Wallpaper),
+			Summary:       e.Description,
+			DatePublished: e.Date.UTC(),
+			Authors:       []jsonFeedAuthor{{Name: e.Owner, URL: base + "/u/" + url.PathEscape(e.Owner)}},
+			Tags:          e.Tags,
+		}
+		for i, enc := range feedEnclosures(base, e.Wallpaper) {
+			if i == 0 {
+				item.URL, item.Image = enc.URL, enc.URL
+			}
+			item.Attachments = append(item.Attachments, jsonFeedAttachment{URL: enc.URL, MimeType: enc.Type, Title: enc.Title, SizeInBytes: enc.Size})
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return json.MarshalIndent(feed, "", "  ")
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FeedsHandler serves the Atom and JSON feeds of the public wallpapers. They never depend
+// on the session, so they can be cached by anyone once SITE_URL is set; readers polling them
+// get a 304 through the ETag / Last-Modified.
+// URL format: /feeds/community.atom, /feeds/u/{username}.json, /feeds/tags/{tag}.atom,
+// /feeds/collections/{id}.json
+func FeedsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/feeds/")
+	format := ""
+	for _, f := range []string{FeedAtom, FeedJSON} {
+		if strings.HasSuffix(path, "."+f) {
+			format, path = f, strings.TrimSuffix(path, "."+f)
+		}
+	}
+	if format == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	src, err := feedSourceOf(path)
+	var alias aliasRedirect
+	switch {
+	case errors.As(err, &alias):
+		http.Redirect(w, r, string(alias)+"."+format, http.StatusMovedPermanently)
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		http.NotFound(w, r)
+		return
+	case err != nil:
+		log.Println("Failed to load the feed:", err)
+		http.Error(w, "Failed to load the feed", http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := feedEntries(src)
+	if err != nil {
+		log.Println("Failed to query the feed entries:", err)
+		http.Error(w, "Failed to load the feed", http.StatusInternalServerError)
+		return
+	}
+
+	base, configured := siteURL(r)
+	var body []byte
+	contentType := "application/atom+xml; charset=utf-8"
+	if format == FeedJSON {
+		body, err = renderJSONFeed(base, src, entries)
+		contentType = "application/feed+json; charset=utf-8"
+	} else {
+		body, err = renderAtom(base, src, entries)
+	}
+	if err != nil {
+		log.Println("Failed to render the feed:", err)
+		http.Error(w, "Failed to render the feed", http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	if configured {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(feedMaxAge.Seconds())))
+	} else {
+		// the links come from the Host header: no shared cache may serve them to someone else
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(feedMaxAge.Seconds())))
+		w.Header().Set("Vary", "Host")
+	}
+	// ServeContent answers the If-None-Match / If-Modified-Since with a 304
+	http.ServeContent(w, r, "", feedUpdated(src, entries), bytes.NewReader(body))
+}
+
+// returned by feedSourceOf for a tag alias, the path of the canonical feed
+type aliasRedirect string
+
+func (a aliasRedirect) Error() string { return "tag alias of " + string(a) }
+
+// feedSourceOf resolves the path of a feed (without /feeds/ and the extension)
+func feedSourceOf(path string) (feedSource, error) {
+	kind, name, _ := strings.Cut(path, "/")
+	switch {
+	case kind == "community" && name == "":
+		// the site is as old as its first account
+		var created time.Time
+		if err := db.QueryRow("SELECT COALESCE(MIN(created_at), NOW()) FROM users").Scan(&created); err != nil {
+			return feedSource{}, err
+		}
+		return feedSource{
+			Title:       "WPManager community",
+			Description: "The newest public wallpapers",
+			Page:        "/community",
+			Path:        "/feeds/community",
+			Created:     created,
+		}, nil
+
+	case kind == "u" && name != "":
+		var userID int
+		var username string
+		var created time.Time
+		err := db.QueryRow("SELECT id, username, created_at FROM users WHERE username = ?", name).Scan(&userID, &username, &created)
+		if err != nil {
+			return feedSource{}, err
+		}
+		return feedSource{
+			Title:       username + " on WPManager",
+			Description: "The public wallpapers of " + username,
+			Page:        "/u/" + url.PathEscape(username),
+			Path:        "/feeds/u/" + url.PathEscape(username),
+			Author:      username,
+			Created:     created,
+			cond:        "w.user_id = ?",
+			args:        []interface{}{userID},
+		}, nil
+
+	case kind == "tags" && name != "":
+		normalized, err := normalizeTag(name)
+		if err != nil || normalized == "" {
+			return feedSource{}, sql.ErrNoRows
+		}
+		tagID, canonical, err := resolveTag(db, normalized)
+		if err != nil {
+			return feedSource{}, err
+		}
+		if canonical != name {
+			return feedSource{}, aliasRedirect("/feeds/tags/" + url.PathEscape(canonical))
+		}
+		var created time.Time
+		if err := db.QueryRow("SELECT created_at FROM tags WHERE id = ?", tagID).Scan(&created); err != nil {
+			return feedSource{}, err
+		}
+		return feedSource{
+			Title:       "#" + canonical + " on WPManager",
+			Description: "The public wallpapers tagged " + canonical,
+			Page:        "/tags/" + url.PathEscape(canonical),
+			Path:        "/feeds/tags/" + url.PathEscape(canonical),
+			Created:     created,
+			join:        "JOIN wallpaper_tags wt ON wt.wallpaper_id = w.id AND wt.tag_id = ?",
+			args:        []interface{}{tagID},
+		}, nil
+
+	case kind == "collections" && name != "":
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			return feedSource{}, sql.ErrNoRows
+		}
+		c, err := getCollection(id, 0)
+		if err != nil {
+			return feedSource{}, err
+		}
+		// the feeds are anonymous, private collections have none
+		if !canViewCollection(c, nil) {
+			return feedSource{}, sql.ErrNoRows
+		}
+		return feedSource{
+			Title:       c.Name + " - a WPManager collection",
+			Description: c.Description,
+			Page:        "/collections/" + strconv.Itoa(c.ID),
+			Path:        "/feeds/collections/" + strconv.Itoa(c.ID),
+			Author:      c.Owner,
+			Updated:     c.UpdatedAt,
+			Created:     c.CreatedAt,
+			join:        "JOIN collection_items ci ON ci.wallpaper_id = w.id AND ci.collection_id = ?",
+			args:        []interface{}{c.ID},
+			timeOrder:   "ci.added_at",
+		}, nil
+	}
+	return feedSource{}, sql.ErrNoRows
+}
@@ -0,0 +1,253 @@
+// / this file contains the tag normalization, aliases and the wallpaper <-> tag links
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Tag struct {
+	Name    string `json:"name"`
+	Count   int    `json:"count"`              // public wallpapers with this tag
+	AliasOf string `json:"alias_of,omitempty"` // canonical tag when this one is an alias
+}
+
+const (
+	maxTagLength        = 50
+	maxTagsPerWallpaper = 20
+)
+
+var errTooManyTags = fmt.Errorf("Too many tags (max %d)", maxTagsPerWallpaper)
+
+// normalizeTag lowercases and turns anything that isn't a letter or digit into a dash:
+// " #Dark  Fantasy " -> "dark-fantasy". Accents are kept, "anime" and "animé" are
+// linked by a moderator with an alias instead.
+func normalizeTag(raw string) (string, error) {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(raw) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			dash = true
+			continue
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteRune(r)
+	}
+
+	tag := b.String()
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return "", fmt.Errorf("Tag %q too long (max %d characters)", tag, maxTagLength)
+	}
+	return tag, nil
+}
+
+// parses a comma separated list of tags, duplicates and empty entries are dropped
+func parseTags(input string) ([]string, error) {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, raw := range strings.Split(input, ",") {
+		tag, err := normalizeTag(raw)
+		if err != nil {
+			return nil, err
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTagsPerWallpaper {
+		return nil, errTooManyTags
+	}
+	return tags, nil
+}
+
+// returns the id and name of the canonical tag for name, following the alias
+func resolveTag(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, name string) (int, string, error) {
+	var id int
+	var canonical string
+	err := q.QueryRow(`
+		SELECT COALESCE(a.id, t.id), COALESCE(a.name, t.name)
+		FROM tags t
+		LEFT JOIN tags a ON a.id = t.alias_of
+		WHERE t.name = ?
+	`, name).Scan(&id, &canonical)
+	return id, canonical, err
+}
+
+// replaces the tags of a wallpaper, unknown tags are created and aliases resolved
+func setWallpaperTags(wallpaperID int, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM wallpaper_tags WHERE wallpaper_id = ?", wallpaperID); err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		if err := linkTag(tx, wallpaperID, tag); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// adds tags to a wallpaper, keeping the ones it already has
+func addWallpaperTags(wallpaperID int, tags []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, tag := range tags {
+		if err := linkTag(tx, wallpaperID, tag); err != nil {
+			return err
+		}
+	}
+
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM wallpaper_tags WHERE wallpaper_id = ?", wallpaperID).Scan(&count); err != nil {
+		return err
+	}
+	if count > maxTagsPerWallpaper {
+		return errTooManyTags
+	}
+	return tx.Commit()
+}
+
+// creates the tag if needed and links its canonical tag to the wallpaper
+func linkTag(tx *sql.Tx, wallpaperID int, tag string) error {
+	if _, err := tx.Exec("INSERT IGNORE INTO tags (name) VALUES (?)", tag); err != nil {
+		return err
+	}
+	tagID, _, err := resolveTag(tx, tag)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT IGNORE INTO wallpaper_tags (wallpaper_id, tag_id) VALUES (?, ?)", wallpaperID, tagID)
+	return err
+}
+
+// returns wallpaper id -> tag names (sorted), for the given wallpapers
+func tagsByWallpaper(wallpaperIDs ...int) (map[int][]string, error) {
+	tags := make(map[int][]string)
+	if len(wallpaperIDs) == 0 {
+		return tags, nil
+	}
+
+	args := make([]interface{}, len(wallpaperIDs))
+	for i, id := range wallpaperIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT wt.wallpaper_id, t.name
+		FROM wallpaper_tags wt
+		JOIN tags t ON t.id = wt.tag_id
+		WHERE wt.wallpaper_id IN (?`+strings.Repeat(", ?", len(wallpaperIDs)-1)+`)
+		ORDER BY t.name
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wallpaperID int
+		var name string
+		if err := rows.Scan(&wallpaperID, &name); err != nil {
+			return nil, err
+		}
+		tags[wallpaperID] = append(tags[wallpaperID], name)
+	}
+	return tags, rows.Err()
+}
+
+// fills the Tags field of the wallpapers, errors only get logged so a page still renders
+func attachTags(wallpapers []Wallpaper) {
+	ids := make([]int, len(wallpapers))
+	for i, w := range wallpapers {
+		ids[i] = w.ID
+	}
+	tags, err := tagsByWallpaper(ids...)
+	if err != nil {
+		log.Println("Failed to load tags:", err)
+		return
+	}
+	for i := range wallpapers {
+		wallpapers[i].Tags = tags[wallpapers[i].ID]
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// returns the tags (aliases included) starting with prefix, most used first
+func listTags(prefix string, limit int) ([]Tag, error) {
+	rows, err := db.Query(`
+		SELECT t.name, COALESCE(a.name, ''), COUNT(w.id)
+		FROM tags t
+		LEFT JOIN tags a ON a.id = t.alias_of
+		LEFT JOIN wallpaper_tags wt ON wt.tag_id = COALESCE(t.alias_of, t.id)
+		LEFT JOIN wallpapers w ON w.id = wt.wallpaper_id AND w.status = 'approved' AND w.deleted_at IS NULL AND w.archived_at IS NULL
+		WHERE t.name LIKE ?
+		GROUP BY t.id, t.name, a.name
+		ORDER BY COUNT(w.id) DESC, t.name
+		LIMIT ?
+	`, likeEscaper.Replace(prefix)+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []Tag{}
+	for rows.Next() {
+		var t Tag
+		if err := rows.Scan(&t.Name, &t.AliasOf, &t.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
+
+// mergeTags moves every wallpaper of fromID to intoID and turns fromID into an alias of intoID
+func mergeTags(fromID, intoID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT IGNORE INTO wallpaper_tags (wallpaper_id, tag_id)
+		SELECT wallpaper_id, ? FROM wallpaper_tags WHERE tag_id = ?
+	`, intoID, fromID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM wallpaper_tags WHERE tag_id = ?", fromID); err != nil {
+		return err
+	}
+
+	// aliases of the merged tag now point to the new canonical one
+	if _, err := tx.Exec("UPDATE tags SET alias_of = ? WHERE alias_of = ?", intoID, fromID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE tags SET alias_of = ? WHERE id = ?", intoID, fromID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+type TagsPageData struct {
+	Username string
+	IsAdmin  bool
+	LoggedIn bool
+	Tags     []Tag
+	Aliases  []Tag
+	Error    string
+}
+
+type TagPageData struct {
+	Username   string
+	IsAdmin    bool
+	LoggedIn   bool
+	Tag        string
+	Count      int
+	Wallpapers []Wallpaper
+	NextCursor string
+}
+
+const tagPageSize = 24
+
+// EditTagsHandler replaces the tags of a wallpaper, for its owner and the admins
+func EditTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	err = db.QueryRow("SELECT user_id FROM wallpapers WHERE id = ?", wallpaperID).Scan(&ownerID)
+	if err != nil {
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	}
+	if ownerID != user.UserID && !user.IsAdmin {
+		log.Printf("⚠️ Unauthorized tag edit: user %d tried to tag wallpaper owned by %d", user.UserID, ownerID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	tags, err := parseTags(r.FormValue("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// an admin editing someone else's wallpaper goes to the audit log
+	var before map[int][]string
+	if ownerID != user.UserID {
+		if before, err = tagsByWallpaper(wallpaperID); err != nil {
+			log.Println("Failed to load tags:", err)
+		}
+	}
+
+	if err := setWallpaperTags(wallpaperID, tags); err != nil {
+		log.Println("Failed to save tags:", err)
+		http.Error(w, "Failed to save tags", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🏷️ Wallpaper %d tagged %v by user %d", wallpaperID, tags, user.UserID)
+	if ownerID != user.UserID {
+		audit(r, user, AuditEditTags, AuditTargetWallpaper, wallpaperID,
+			map[string][]string{"tags": before[wallpaperID]}, map[string][]string{"tags": tags})
+	}
+	http.Redirect(w, r, redirectBack(r, "/wallpapers"), http.StatusSeeOther)
+}
+
+// TagsHandler lists every tag with its count, admins also get the merge/alias tools
+func TagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := TagsPageData{Error: r.URL.Query().Get("error")}
+	if user := getCurrentUser(r); user != nil {
+		data.Username = user.Username
+		data.IsAdmin = user.IsAdmin
+		data.LoggedIn = true
+	}
+
+	tags, err := listTags("", 1000)
+	if err != nil {
+		log.Println("Failed to query tags:", err)
+		http.Error(w, "Failed to load tags", http.StatusInternalServerError)
+		return
+	}
+	for _, t := range tags {
+		if t.AliasOf != "" {
+			data.Aliases = append(data.Aliases, t)
+		} else if t.Count > 0 || data.IsAdmin {
+			data.Tags = append(data.Tags, t)
+		}
+	}
+
+	if err := templates.ExecuteTemplate(w, "tags.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// TagPageHandler lists the wallpapers with a tag that the viewer can see, aliases redirect
+// URL format: /tags/{tag}?cursor=...
+func TagPageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name, err := normalizeTag(strings.TrimPrefix(r.URL.Path, "/tags/"))
+	if err != nil || name == "" {
+		http.NotFound(w, r)
+		return
+	}
+	tagID, canonical, err := resolveTag(db, name)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Println("Failed to resolve tag:", err)
+		}
+		http.NotFound(w, r)
+		return
+	}
+	if canonical != strings.TrimPrefix(r.URL.Path, "/tags/") {
+		http.Redirect(w, r, "/tags/"+url.PathEscape(canonical), http.StatusMovedPermanently)
+		return
+	}
+
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := TagPageData{Tag: canonical}
+	viewerID := 0
+	if user := getCurrentUser(r); user != nil {
+		viewerID = user.UserID
+		data.Username = user.Username
+		data.IsAdmin = user.IsAdmin
+		data.LoggedIn = true
+	}
+
+	cond, args := listedToSQL(viewerID)
+	after, afterArgs := cursor.where("w.uploaded_at", "w.id")
+	args = append([]interface{}{tagID}, args...)
+	args = append(args, afterArgs...)
+	rows, err := db.Query(`
+		SELECT w.id, w.filename, w.original_name, w.uploaded_at, u.username
+		FROM wallpapers w
+		JOIN wallpaper_tags wt ON wt.wallpaper_id = w.id AND wt.tag_id = ?
+		JOIN users u ON u.id = w.user_id
+		WHERE `+cond+` AND `+after+`
+		ORDER BY w.uploaded_at DESC, w.id DESC
+		LIMIT ?
+	`, append(args, tagPageSize+1)...)
+	if err != nil {
+		log.Println("Failed to query tagged wallpapers:", err)
+		http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var wp Wallpaper
+		if err := rows.Scan(&wp.ID, &wp.Filename, &wp.OriginalName, &wp.UploadedAt, &wp.Owner); err != nil {
+			log.Println("Row scan error:", err)
+			continue
+		}
+		// one extra row was fetched to know if there's a next page
+		if len(data.Wallpapers) == tagPageSize {
+			last := data.Wallpapers[len(data.Wallpapers)-1]
+			data.NextCursor = Cursor{Time: last.UploadedAt, ID: last.ID}.String()
+			break
+		}
+		data.Wallpapers = append(data.Wallpapers, wp)
+	}
+	attachTags(data.Wallpapers)
+
+	err = db.QueryRow(`
+		SELECT COUNT(*) FROM wallpaper_tags wt
+		JOIN wallpapers w ON w.id = wt.wallpaper_id
+		WHERE wt.tag_id = ? AND w.status = 'approved' AND w.deleted_at IS NULL AND w.archived_at IS NULL
+	`, tagID).Scan(&data.Count)
+	if err != nil {
+		log.Println("Failed to count tag:", err)
+	}
+
+	if err := templates.ExecuteTemplate(w, "tag.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
+
+// TagsAPIHandler is the autocomplete endpoint
+// URL format: /api/tags?q=prefix&limit=10
+func TagsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		jsonError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	prefix, err := normalizeTag(r.URL.Query().Get("q"))
+	if err != nil {
+		jsonError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tags, err := listTags(prefix, queryInt(r, "limit", 10, 1, 50))
+	if err != nil {
+		log.Println("Failed to query tags:", err)
+		jsonError(w, http.StatusInternalServerError, "Failed to load tags")
+		return
+	}
+	writeJSON(w, http.StatusOK, tags)
+}
+
+// MergeTagsHandler merges the tag "from" into "into", "from" stays as an alias.
+// "from" doesn't have to exist yet, which is how a new alias is created.
+func MergeTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
+	from, errFrom := normalizeTag(r.FormValue("from"))
+	into, errInto := normalizeTag(r.FormValue("into"))
+	if errFrom != nil || errInto != nil || from == "" || into == "" {
+		tagsError(w, r, "Both tags are required")
+		return
+	}
+
+	intoID, canonical, err := resolveTag(db, into)
+	if err != nil {
+		tagsError(w, r, "Unknown tag "+into)
+		return
+	}
+
+	if _, err := db.Exec("INSERT IGNORE INTO tags (name) VALUES (?)", from); err != nil {
+		log.Println("Failed to create tag:", err)
+		http.Error(w, "Failed to merge tags", http.StatusInternalServerError)
+		return
+	}
+	var fromID int
+	if err := db.QueryRow("SELECT id FROM tags WHERE name = ?", from).Scan(&fromID); err != nil {
+		log.Println("Failed to load tag:", err)
+		http.Error(w, "Failed to merge tags", http.StatusInternalServerError)
+		return
+	}
+	if fromID == intoID {
+		tagsError(w, r, "Can't merge a tag into itself")
+		return
+	}
+
+	if err := mergeTags(fromID, intoID); err != nil {
+		log.Println("Failed to merge tags:", err)
+		http.Error(w, "Failed to merge tags", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🏷️ Tag %s merged into %s by admin %s", from, canonical, admin.Username)
+	audit(r, admin, AuditMergeTags, AuditTargetTag, from, map[string]string{"tag": from}, map[string]string{"alias_of": canonical})
+	http.Redirect(w, r, "/tags", http.StatusSeeOther)
+}
+
+// DeleteTagHandler removes a tag (or an alias) and its links
+func DeleteTagHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+
+	name, err := normalizeTag(r.FormValue("name"))
+	if err != nil || name == "" {
+		tagsError(w, r, "Tag name missing")
+		return
+	}
+
+	// links and aliases go with the ON DELETE CASCADE
+	if _, err := db.Exec("DELETE FROM tags WHERE name = ?", name); err != nil {
+		log.Println("Failed to delete tag:", err)
+		http.Error(w, "Failed to delete tag", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🗑️ Tag %s deleted by admin %s", name, admin.Username)
+	audit(r, admin, AuditDeleteTag, AuditTargetTag, name, map[string]string{"tag": name}, nil)
+	http.Redirect(w, r, "/tags", http.StatusSeeOther)
+}
+
+// back to the tags page with a message
+func tagsError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/tags?error="+url.QueryEscape(message), http.StatusSeeOther)
+}
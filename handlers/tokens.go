@@ -0,0 +1,134 @@
+// / this file contains the personal API tokens, used by scripts and wpctl instead of the session cookie
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	tokenPrefix      = "wpt_"
+	maxTokensPerUser = 20
+	maxTokenName     = 100
+)
+
+var (
+	errTokenName     = fmt.Errorf("the token needs a name (max %d characters)", maxTokenName)
+	errTooManyTokens = fmt.Errorf("you can't have more than %d tokens", maxTokensPerUser)
+)
+
+// one row of api_tokens, only the hash of the token is stored
+type APIToken struct {
+	ID         int
+	Name       string
+	Hint       string // the first characters, to tell the tokens apart
+	CreatedAt  time.Time
+	LastUsedAt *time.Time
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// createToken saves a new token for userID and returns it, it can't be read back afterwards
+func createToken(userID int, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > maxTokenName {
+		return "", errTokenName
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM api_tokens WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return "", err
+	}
+	if count >= maxTokensPerUser {
+		return "", errTooManyTokens
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := tokenPrefix + hex.EncodeToString(b)
+	_, err := db.Exec(`
+		INSERT INTO api_tokens (user_id, name, token_hash, hint)
+		VALUES (?, ?, ?, ?)
+	`, userID, name, hashToken(token), token[:len(tokenPrefix)+6])
+	return token, err
+}
+
+func userTokens(userID int) ([]APIToken, error) {
+	rows, err := db.Query(`
+		SELECT id, name, hint, created_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Hint, &t.CreatedAt, &t.LastUsedAt); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// bearerToken returns the token of an "Authorization: Bearer wpt_..." header, or ""
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// getAPIUser returns the user of the personal token of the Authorization header, or the
+// logged-in one without it. Only the JSON handlers wpctl needs call it, everything else
+// (the forms, /tokens, the admin pages) stays on the session so a leaked token can't mint
+// new tokens, and a token never carries the admin role.
+func getAPIUser(r *http.Request) *UserProfile {
+	token := bearerToken(r)
+	if token == "" {
+		return getCurrentUser(r)
+	}
+	userID, err := userIDFromToken(token)
+	if err != nil {
+		return nil
+	}
+	user := loadUser(userID)
+	if user != nil {
+		user.IsAdmin = false
+	}
+	return user
+}
+
+// userIDFromToken resolves a personal token. last_used_at moves at most once a minute.
+func userIDFromToken(token string) (int, error) {
+	if !strings.HasPrefix(token, tokenPrefix) {
+		return 0, errors.New("not a personal token")
+	}
+	hash := hashToken(token)
+	var userID int
+	if err := db.QueryRow("SELECT user_id FROM api_tokens WHERE token_hash = ?", hash).Scan(&userID); err != nil {
+		return 0, fmt.Errorf("token not found: %w", err)
+	}
+	db.Exec(`
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE token_hash = ? AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL 1 MINUTE)
+	`, hash)
+	return userID, nil
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type TokensPageData struct {
+	Username string
+	IsAdmin  bool
+	Tokens   []APIToken
+	NewToken string // shown once, right after it was created
+	Error    string
+}
+
+// TokensHandler lists the user's personal tokens (GET) or creates one (POST, form: name)
+func TokensHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := TokensPageData{Username: user.Username, IsAdmin: user.IsAdmin}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		token, err := createToken(user.UserID, r.FormValue("name"))
+		switch {
+		case err == nil:
+			log.Printf("🔑 New API token for %s", user.Username)
+			data.NewToken, status = token, http.StatusCreated
+		case errors.Is(err, errTokenName), errors.Is(err, errTooManyTokens):
+			data.Error, status = err.Error(), http.StatusBadRequest
+		default:
+			log.Println("Failed to create the token:", err)
+			http.Error(w, "Failed to create the token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	tokens, err := userTokens(user.UserID)
+	if err != nil {
+		log.Println("Failed to query the tokens:", err)
+		http.Error(w, "Failed to load the tokens", http.StatusInternalServerError)
+		return
+	}
+	data.Tokens = tokens
+
+	// the new token is on this page only
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "tokens.html", data); err != nil {
+		log.Println("Template error:", err)
+	}
+}
+
+// RevokeTokenHandler deletes one of the user's tokens, form: token_id
+func RevokeTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.FormValue("token_id"))
+	if err != nil {
+		http.Error(w, "Token ID missing", http.StatusBadRequest)
+		return
+	}
+	result, err := db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, user.UserID)
+	if err != nil {
+		log.Println("Failed to revoke the token:", err)
+		http.Error(w, "Failed to revoke the token", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		http.Error(w, "Token not found", http.StatusNotFound)
+		return
+	}
+	http.Redirect(w, r, "/tokens", http.StatusSeeOther)
+}
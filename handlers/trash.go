@@ -0,0 +1,149 @@
+// / this file contains the soft delete: the trash, restoring and the purge job
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// how long a deleted wallpaper stays restorable before the purge job removes it for good
+const trashRetention = 30 * 24 * time.Hour
+
+var (
+	errNotInTrash   = errors.New("the wallpaper is not in the trash")
+	errTrashExpired = errors.New("the wallpaper was deleted too long ago to be restored")
+)
+
+// softDeleteWallpaper moves a wallpaper to the trash, it disappears from every listing
+func softDeleteWallpaper(wallpaperID, byUserID int) error {
+	result, err := db.Exec(`
+		UPDATE wallpapers SET deleted_at = ?, deleted_by = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, time.Now(), byUserID, wallpaperID)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// restoreWallpaper takes a wallpaper out of the trash. Owners can within the retention window,
+// admins can restore anything that wasn't purged yet.
+func restoreWallpaper(wallpaperID int, actor *UserProfile) (ownerID int, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var deletedAt sql.NullTime
+	err = tx.QueryRow("SELECT user_id, deleted_at FROM wallpapers WHERE id = ? FOR UPDATE", wallpaperID).
+		Scan(&ownerID, &deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	if !deletedAt.Valid {
+		return ownerID, errNotInTrash
+	}
+	if !actor.IsAdmin {
+		if actor.UserID != ownerID {
+			return ownerID, errTransitionDenied
+		}
+		if time.Since(deletedAt.Time) > trashRetention {
+			return ownerID, errTrashExpired
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE wallpapers SET deleted_at = NULL, deleted_by = NULL WHERE id = ?", wallpaperID); err != nil {
+		return ownerID, err
+	}
+	return ownerID, tx.Commit()
+}
+
+// deleteWallpaper removes a wallpaper row (comments, tags, ... cascade) and its file
+func deleteWallpaper(wallpaperID int) error {
+	var filePath string
+	if err := db.QueryRow("SELECT file_path FROM wallpapers WHERE id = ?", wallpaperID).Scan(&filePath); err != nil {
+		return err
+	}
+	if _, err := db.Exec("DELETE FROM wallpapers WHERE id = ?", wallpaperID); err != nil {
+		return err
+	}
+	if err := os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+		log.Printf("Failed to remove %s: %v", filePath, err)
+	}
+	return nil
+}
+
+// trashedWallpapers lists the trash of userID, or of everyone with userID 0, latest deleted first
+func trashedWallpapers(userID int) ([]Wallpaper, error) {
+	query := `
+		SELECT w.id, w.user_id, u.username, w.filename, w.original_name, w.uploaded_at, w.status, w.deleted_at
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.deleted_at IS NOT NULL`
+	var args []interface{}
+	if userID != 0 {
+		query += " AND w.user_id = ?"
+		args = append(args, userID)
+	}
+	rows, err := db.Query(query+" ORDER BY w.deleted_at DESC, w.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wallpapers []Wallpaper
+	for rows.Next() {
+		var w Wallpaper
+		if err := rows.Scan(&w.ID, &w.UserID, &w.Owner, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.Status, &w.DeletedAt); err != nil {
+			return nil, err
+		}
+		wallpapers = append(wallpapers, w)
+	}
+	return wallpapers, rows.Err()
+}
+
+// when the purge job removes a trashed wallpaper
+func (w Wallpaper) PurgeAt() time.Time {
+	if w.DeletedAt == nil {
+		return time.Time{}
+	}
+	return w.DeletedAt.Add(trashRetention)
+}
+
+// StartTrashPurger removes the expired trash every interval, until the process exits
+func StartTrashPurger(interval time.Duration) {
+	go func() {
+		for {
+			if n, err := purgeTrash(time.Now()); err != nil {
+				log.Println("Trash purge failed:", err)
+			} else if n > 0 {
+				log.Printf("🗑️ Purged %d wallpapers from the trash", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// purgeTrash deletes the rows and files of the wallpapers trashed before the retention window
+func purgeTrash(now time.Time) (int, error) {
+	ids, err := queryIDs("SELECT id FROM wallpapers WHERE deleted_at < ?", now.Add(-trashRetention))
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, id := range ids {
+		if err := deleteWallpaper(id); err != nil {
+			log.Printf("Failed to purge wallpaper %d: %v", id, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+type TrashPageData struct {
+	Username      string
+	IsAdmin       bool
+	AllUsers      bool // the admin view, with everyone's trash
+	Wallpapers    []Wallpaper
+	RetentionDays int
+}
+
+// TrashHandler lists the wallpapers the user deleted, restorable until their purge date
+func TrashHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	renderTrash(w, user, false)
+}
+
+// AdminTrashHandler lists everyone's trash (admin)
+func AdminTrashHandler(w http.ResponseWriter, r *http.Request) {
+	admin := requireAdmin(w, r)
+	if admin == nil {
+		return
+	}
+	renderTrash(w, admin, true)
+}
+
+func renderTrash(w http.ResponseWriter, user *UserProfile, allUsers bool) {
+	userID := user.UserID
+	if allUsers {
+		userID = 0
+	}
+	wallpapers, err := trashedWallpapers(userID)
+	if err != nil {
+		log.Println("Failed to query the trash:", err)
+		http.Error(w, "Failed to load the trash", http.StatusInternalServerError)
+		return
+	}
+
+	data := TrashPageData{
+		Username:      user.Username,
+		IsAdmin:       user.IsAdmin,
+		AllUsers:      allUsers,
+		Wallpapers:    wallpapers,
+		RetentionDays: int(trashRetention.Hours() / 24),
+	}
+	if err := templates.ExecuteTemplate(w, "trash.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// RestoreHandler takes a wallpaper out of the trash, it comes back in the state it was deleted in
+func RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := restoreWallpaper(wallpaperID, user)
+	switch {
+	case err == nil:
+	case errors.Is(err, sql.ErrNoRows):
+		http.Error(w, "Wallpaper not found", http.StatusNotFound)
+		return
+	case errors.Is(err, errTransitionDenied):
+		log.Printf("⚠️ Unauthorized restore attempt: user %d on wallpaper %d", user.UserID, wallpaperID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	case errors.Is(err, errNotInTrash), errors.Is(err, errTrashExpired):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		log.Println("Failed to restore wallpaper:", err)
+		http.Error(w, "Failed to restore wallpaper", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("♻️ Wallpaper %d restored by user %d", wallpaperID, user.UserID)
+	if ownerID != user.UserID {
+		audit(r, user, AuditRestoreWallpaper, AuditTargetWallpaper, wallpaperID, map[string]int{"owner_id": ownerID}, nil)
+	}
+	http.Redirect(w, r, redirectBack(r, "/trash"), http.StatusSeeOther)
+}
+
+// PurgeHandler deletes a trashed wallpaper for good without waiting for the purge job (owner or admin)
+func PurgeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	wallpaperID, err := strconv.Atoi(r.FormValue("wallpaper_id"))
+	if err != nil {
+		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
+		return
+	}
+
+	var ownerID int
+	var originalName string
+	err = db.QueryRow("SELECT user_id, original_name FROM wallpapers WHERE id = ? AND deleted_at IS NOT NULL", wallpaperID).
+		Scan(&ownerID, &originalName)
+	if err != nil {
+		http.Error(w, "Wallpaper not found in the trash", http.StatusNotFound)
+		return
+	}
+	if ownerID != user.UserID && !user.IsAdmin {
+		log.Printf("⚠️ Unauthorized purge attempt: user %d on wallpaper owned by %d", user.UserID, ownerID)
+		http.Error(w, "Unauthorized", http.StatusForbidden)
+		return
+	}
+
+	if err := deleteWallpaper(wallpaperID); err != nil {
+		log.Println("Failed to purge wallpaper:", err)
+		http.Error(w, "Failed to delete wallpaper", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("🔥 Wallpaper %d deleted for good by user %d", wallpaperID, user.UserID)
+	if ownerID != user.UserID {
+		audit(r, user, AuditPurgeWallpaper, AuditTargetWallpaper, wallpaperID,
+			map[string]interface{}{"owner_id": ownerID, "original_name": originalName}, nil)
+	}
+	http.Redirect(w, r, redirectBack(r, "/trash"), http.StatusSeeOther)
+}
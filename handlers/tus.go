@@ -0,0 +1,332 @@
+// / this file contains the resumable uploads (tus 1.0, https://tus.io/protocols/resumable-upload):
+// / the bytes go to web/tus/{id} chunk by chunk, and the finished file goes through storeWallpaper
+package handlers
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TusVersion = "1.0.0"
+
+	tusDir             = "web/tus"
+	maxTusUploadSize   = 200 << 20 // Tus-Max-Size
+	maxTusUploadsOpen  = 10        // unfinished uploads per user
+	tusUploadLifetime  = 24 * time.Hour
+	maxTusMetadataSize = 8 << 10
+)
+
+var (
+	errTusGone           = errors.New("the upload has expired")
+	errTusOffset         = errors.New("Upload-Offset doesn't match the offset of the upload")
+	errTusLocked         = errors.New("the upload is being written by another request")
+	errTusTooManyUploads = fmt.Errorf("you can't have more than %d unfinished uploads", maxTusUploadsOpen)
+)
+
+// one row of tus_uploads
+type tusUpload struct {
+	ID          string
+	UserID      int
+	Length      int64
+	Offset      int64
+	Filename    string
+	Description string
+	Tags        []string
+	WallpaperID int // once finished and stored
+	ExpiresAt   time.Time
+}
+
+func (u tusUpload) path() string { return filepath.Join(tusDir, u.ID) }
+
+// parseTusMetadata decodes Upload-Metadata: "key base64,key base64,key"
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	if len(header) > maxTusMetadataSize {
+		return nil, errors.New("Upload-Metadata is too long")
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, errors.New("invalid Upload-Metadata")
+		}
+		value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %s", key)
+		}
+		meta[key] = string(value)
+	}
+	return meta, nil
+}
+
+// newTusUpload checks what storeWallpaper will check, so that a bad upload fails before
+// its bytes are sent. Its errors are the client's.
+func newTusUpload(userID int, length int64, meta map[string]string) (tusUpload, error) {
+	u := tusUpload{
+		UserID:      userID,
+		Length:      length,
+		Filename:    meta["filename"],
+		Description: strings.TrimSpace(meta["description"]),
+		ExpiresAt:   time.Now().Add(tusUploadLifetime).Truncate(time.Second),
+	}
+	if u.Filename == "" {
+		return u, errors.New("Upload-Metadata needs the filename")
+	}
+	if !IsWallpaperFile(u.Filename) {
+		return u, errInvalidFileType
+	}
+	if len(u.Filename) > 255 {
+		return u, errFilenameTooLong
+	}
+	if len(u.Description) > maxDescriptionLength {
+		return u, errDescriptionTooLong
+	}
+	tags, err := parseTags(meta["tags"])
+	if err != nil {
+		return u, err
+	}
+	u.Tags = tags
+	return u, nil
+}
+
+// reservedTusBytes is what the open uploads of a user will take once finished
+func reservedTusBytes(userID int) (int64, error) {
+	var reserved int64
+	err := db.QueryRow("SELECT COALESCE(SUM(length), 0) FROM tus_uploads WHERE user_id = ? AND wallpaper_id IS NULL", userID).Scan(&reserved)
+	return reserved, err
+}
+
+// saveTusUpload creates the empty file and the row of a new upload
+func saveTusUpload(u *tusUpload) error {
+	var open int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tus_uploads WHERE user_id = ? AND wallpaper_id IS NULL", u.UserID).Scan(&open); err != nil {
+		return err
+	}
+	if open >= maxTusUploadsOpen {
+		return errTusTooManyUploads
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	u.ID = hex.EncodeToString(b)
+
+	if err := os.MkdirAll(tusDir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(u.path(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+
+	_, err = db.Exec(`
+		INSERT INTO tus_uploads (id, user_id, length, upload_offset, filename, description, tags, expires_at)
+		VALUES (?, ?, ?, 0, ?, ?, ?, ?)
+	`, u.ID, u.UserID, u.Length, u.Filename, u.Description, strings.Join(u.Tags, ","), u.ExpiresAt)
+	if err != nil {
+		os.Remove(u.path())
+	}
+	return err
+}
+
+// getTusUpload loads an upload of the user, sql.ErrNoRows for the others' ones
+func getTusUpload(userID int, id string) (tusUpload, error) {
+	u := tusUpload{ID: id}
+	var tags string
+	var wallpaperID sql.NullInt64
+	err := db.QueryRow(`
+		SELECT user_id, length, upload_offset, filename, description, tags, wallpaper_id, expires_at
+		FROM tus_uploads
+		WHERE id = ? AND user_id = ?
+	`, id, userID).Scan(&u.UserID, &u.Length, &u.Offset, &u.Filename, &u.Description, &tags, &wallpaperID, &u.ExpiresAt)
+	if err != nil {
+		return u, err
+	}
+	if tags != "" {
+		u.Tags = strings.Split(tags, ",")
+	}
+	u.WallpaperID = int(wallpaperID.Int64)
+	if time.Now().After(u.ExpiresAt) {
+		return u, errTusGone
+	}
+	return u, nil
+}
+
+// tusLocks makes the PATCH requests of one upload run one at a time
+var tusLocks = struct {
+	sync.Mutex
+	ids map[string]bool
+}{ids: map[string]bool{}}
+
+func lockTusUpload(id string) bool {
+	tusLocks.Lock()
+	defer tusLocks.Unlock()
+	if tusLocks.ids[id] {
+		return false
+	}
+	tusLocks.ids[id] = true
+	return true
+}
+
+func unlockTusUpload(id string) {
+	tusLocks.Lock()
+	defer tusLocks.Unlock()
+	delete(tusLocks.ids, id)
+}
+
+// writeTusChunk appends body at offset. The bytes received before a broken connection are
+// kept, the client resumes after them. When the last byte is in, the file is stored as a
+// wallpaper (see finishTusUpload).
+func writeTusChunk(u *tusUpload, offset int64, body io.Reader) error {
+	if !lockTusUpload(u.ID) {
+		return errTusLocked
+	}
+	defer unlockTusUpload(u.ID)
+
+	// re-read under the lock, another request may have moved it
+	fresh, err := getTusUpload(u.UserID, u.ID)
+	if err != nil {
+		return err
+	}
+	*u = fresh
+	if offset != u.Offset {
+		return errTusOffset
+	}
+
+	var copyErr error
+	if u.Offset < u.Length {
+		f, err := os.OpenFile(u.path(), os.O_WRONLY, 0644)
+		if err != nil {
+			return err
+		}
+		// what a crash wrote past the saved offset is dropped
+		if err := f.Truncate(u.Offset); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.Seek(u.Offset, io.SeekStart); err != nil {
+			f.Close()
+			return err
+		}
+		n, err := io.Copy(f, io.LimitReader(body, u.Length-u.Offset))
+		copyErr = err
+		if err := f.Close(); err != nil && copyErr == nil {
+			copyErr = err
+			n = 0
+		}
+
+		u.Offset += n
+		u.ExpiresAt = time.Now().Add(tusUploadLifetime).Truncate(time.Second)
+		if _, err := db.Exec("UPDATE tus_uploads SET upload_offset = ?, expires_at = ? WHERE id = ?",
+			u.Offset, u.ExpiresAt, u.ID); err != nil {
+			return err
+		}
+	}
+	if copyErr != nil {
+		return copyErr
+	}
+
+	if u.Offset == u.Length && u.WallpaperID == 0 {
+		return finishTusUpload(u)
+	}
+	return nil
+}
+
+// finishTusUpload hands the complete file to storeWallpaper. The row stays until it expires,
+// with the wallpaper id, so a client asking for the progress again learns where it went.
+// When the store fails with an internal error the file is kept: a PATCH with no body retries.
+func finishTusUpload(u *tusUpload) error {
+	f, err := os.Open(u.path())
+	if err != nil {
+		return err
+	}
+	id, err := storeWallpaper(u.UserID, u.Filename, f, u.Description, u.Tags)
+	f.Close()
+	if err != nil {
+		if isUploadError(err) {
+			deleteTusUpload(*u)
+		}
+		return err
+	}
+
+	u.WallpaperID = id
+	os.Remove(u.path())
+	if _, err := db.Exec("UPDATE tus_uploads SET wallpaper_id = ? WHERE id = ?", id, u.ID); err != nil {
+		log.Println("Failed to mark the upload as finished:", err)
+	}
+	log.Printf("📦 Resumable upload %s finished as wallpaper %d", u.ID, id)
+	return nil
+}
+
+func deleteTusUpload(u tusUpload) error {
+	if err := os.Remove(u.path()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	_, err := db.Exec("DELETE FROM tus_uploads WHERE id = ?", u.ID)
+	return err
+}
+
+// StartTusExpirer removes the abandoned uploads every interval, until the process exits
+func StartTusExpirer(interval time.Duration) {
+	go func() {
+		for {
+			if n, err := expireTusUploads(time.Now()); err != nil {
+				log.Println("Upload expiration failed:", err)
+			} else if n > 0 {
+				log.Printf("🗑️ Removed %d expired uploads", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+func expireTusUploads(now time.Time) (int, error) {
+	rows, err := db.Query("SELECT id FROM tus_uploads WHERE expires_at < ?", now)
+	if err != nil {
+		return 0, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, id := range ids {
+		if !lockTusUpload(id) {
+			continue // being written, so not abandoned
+		}
+		err := deleteTusUpload(tusUpload{ID: id})
+		unlockTusUpload(id)
+		if err != nil {
+			log.Printf("Failed to remove upload %s: %v", id, err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
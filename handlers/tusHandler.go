@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const mediaOffsetStream = "application/offset+octet-stream"
+
+// TusUploadsHandler serves the resumable uploads, tus 1.0 with the creation, expiration and
+// termination extensions (see tus.go):
+//
+//	OPTIONS /api/v1/uploads        what the server supports
+//	POST    /api/v1/uploads        create, Upload-Length and Upload-Metadata: filename, tags, description
+//	HEAD    /api/v1/uploads/{id}   Upload-Offset, where to resume
+//	PATCH   /api/v1/uploads/{id}   append the body at Upload-Offset
+//	DELETE  /api/v1/uploads/{id}   abandon the upload
+//
+// Once the last byte is in the file becomes a wallpaper, its id is in X-Wallpaper-Id.
+func TusUploadsHandler(w http.ResponseWriter, r *http.Request) {
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/uploads"), "/")
+
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Tus-Version", TusVersion)
+		w.Header().Set("Tus-Extension", "creation,expiration,termination")
+		w.Header().Set("Tus-Max-Size", strconv.Itoa(maxTusUploadSize))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	w.Header().Set("Tus-Resumable", TusVersion)
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		w.Header().Set("Tus-Version", TusVersion)
+		apiError(w, http.StatusPreconditionFailed, CodeInvalidRequest, "Tus-Resumable must be "+TusVersion)
+		return
+	}
+
+	user := getAPIUser(r)
+	if user == nil {
+		apiError(w, http.StatusUnauthorized, CodeUnauthorized, "Please log in")
+		return
+	}
+
+	switch {
+	case id == "" && r.Method == http.MethodPost:
+		createTusUploadAPI(w, r, user)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodHead:
+		headTusUpload(w, user, id)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodPatch:
+		patchTusUpload(w, r, user, id)
+	case id != "" && !strings.Contains(id, "/") && r.Method == http.MethodDelete:
+		terminateTusUpload(w, user, id)
+	case strings.Contains(id, "/"):
+		apiError(w, http.StatusNotFound, CodeNotFound, "Not found")
+	default:
+		apiError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func createTusUploadAPI(w http.ResponseWriter, r *http.Request, user *UserProfile) {
+	if r.Header.Get("Upload-Defer-Length") != "" {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "Upload-Defer-Length is not supported, send Upload-Length")
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "Upload-Length must be a positive number of bytes")
+		return
+	}
+	if length > maxTusUploadSize {
+		apiError(w, http.StatusRequestEntityTooLarge, CodeInvalidRequest, "The file is larger than Tus-Max-Size")
+		return
+	}
+	meta, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	u, err := newTusUpload(user.UserID, length, meta)
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	// the open uploads hold their length, or several could be started against the same free space.
+	// Checked again when the file is stored, the user may upload something else meanwhile
+	reserved, err := reservedTusBytes(user.UserID)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	if err := checkQuota(user.UserID, reserved+length); err != nil {
+		if reserved > 0 {
+			err = fmt.Errorf("%w, %s of it reserved by your unfinished uploads", err, FormatBytes(reserved))
+		}
+		writeTusError(w, err)
+		return
+	}
+	if err := saveTusUpload(&u); err != nil {
+		writeTusError(w, err)
+		return
+	}
+
+	log.Printf("📦 Resumable upload %s started by user %d (%d bytes)", u.ID, user.UserID, length)
+	w.Header().Set("Location", "/api/v1/uploads/"+u.ID)
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// the headers describing where an upload is
+func writeTusProgress(w http.ResponseWriter, u tusUpload) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Expires", u.ExpiresAt.UTC().Format(http.TimeFormat))
+	if u.WallpaperID != 0 {
+		w.Header().Set("X-Wallpaper-Id", strconv.Itoa(u.WallpaperID))
+	}
+}
+
+func headTusUpload(w http.ResponseWriter, user *UserProfile, id string) {
+	u, err := getTusUpload(user.UserID, id)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	writeTusProgress(w, u)
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func patchTusUpload(w http.ResponseWriter, r *http.Request, user *UserProfile, id string) {
+	if r.Header.Get("Content-Type") != mediaOffsetStream {
+		apiError(w, http.StatusUnsupportedMediaType, CodeInvalidRequest, "Content-Type must be "+mediaOffsetStream)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "Upload-Offset must be a number of bytes")
+		return
+	}
+
+	u, err := getTusUpload(user.UserID, id)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	err = writeTusChunk(&u, offset, r.Body)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	writeTusProgress(w, u)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func terminateTusUpload(w http.ResponseWriter, user *UserProfile, id string) {
+	u, err := getTusUpload(user.UserID, id)
+	if err != nil && !errors.Is(err, errTusGone) {
+		writeTusError(w, err)
+		return
+	}
+	if !lockTusUpload(u.ID) {
+		writeTusError(w, errTusLocked)
+		return
+	}
+	err = deleteTusUpload(u)
+	unlockTusUpload(u.ID)
+	if err != nil {
+		writeTusError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// maps the errors of tus.go to an API error, internal ones are only logged
+func writeTusError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		apiError(w, http.StatusNotFound, CodeNotFound, "Upload not found")
+	case errors.Is(err, errTusGone):
+		apiError(w, http.StatusGone, CodeNotFound, err.Error())
+	case errors.Is(err, errTusOffset):
+		apiError(w, http.StatusConflict, CodeConflict, err.Error())
+	case errors.Is(err, errTusLocked):
+		apiError(w, http.StatusLocked, CodeConflict, err.Error())
+	case errors.Is(err, errTusTooManyUploads), errors.Is(err, errQuotaExceeded):
+		apiError(w, http.StatusForbidden, CodeForbidden, err.Error())
+	case isUploadError(err):
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	default:
+		log.Println("Resumable upload error:", err)
+		apiError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+	}
+}
@@ -1,87 +1,10 @@
 package handlers
 
 import (
-	"database/sql"
-	"log"
 	"net/http"
 )
 
+// UnpublishHandler takes an approved wallpaper out of the community (owner or admin)
 func UnpublishHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
-	log.Println("TogglePublishHandler called")
-
-	// Parse form data
-	if err := r.ParseForm(); err != nil {
-		http.Error(w, "Invalid form", http.StatusBadRequest)
-		return
-	}
-
-	wallpaperID := r.FormValue("wallpaper_id")
-	if wallpaperID == "" {
-		http.Error(w, "Wallpaper ID missing", http.StatusBadRequest)
-		return
-	}
-
-	// Get userid
-	userID, err := getUserIDFromSession(r)
-	if err != nil {
-		log.Println("Session error:", err)
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	// check if wallpaper is owned by user + get current ispublic status
-	var ownerID int
-	var isPublic bool
-	err = db.QueryRow("SELECT user_id, COALESCE(ispublic, 0) FROM wallpapers WHERE id = ?", wallpaperID).
-		Scan(&ownerID, &isPublic)
-	if err != nil {
-		log.Println("Wallpaper not found:", err)
-		http.Error(w, "Wallpaper not found", http.StatusNotFound)
-		return
-	}
-
-	user := getCurrentUser(r)
-	isAdmin := user != nil && user.IsAdmin
-
-	if !isAdmin && ownerID != userID {
-		log.Printf("⚠️ Unauthorized toggle attempt: user %d tried to toggle wallpaper owned by %d", userID, ownerID)
-		http.Error(w, "Unauthorized", http.StatusForbidden)
-		return
-	}
-
-	// Toggle the ispublic status
-	var result sql.Result
-	if isPublic {
-		// if public > make it private
-		result, err = db.Exec("UPDATE wallpapers SET ispublic = 0 WHERE id = ?", wallpaperID)
-		if err != nil {
-			log.Println("Failed to unpublish wallpaper:", err)
-			http.Error(w, "Failed to unpublish wallpaper", http.StatusInternalServerError)
-			return
-		}
-
-		log.Printf("Wallpaper %s unpublished by user %d", wallpaperID, userID)
-	} else {
-		// if private > make it public
-		result, err = db.Exec("UPDATE wallpapers SET ispublic = 1, toreview = 0 WHERE id = ?", wallpaperID)
-		if err != nil {
-			log.Println("Failed to publish wallpaper:", err)
-			http.Error(w, "Failed to publish wallpaper", http.StatusInternalServerError)
-			return
-		}
-		log.Printf("Wallpaper %s published by user %d", wallpaperID, userID)
-	}
-
-	rows, err := result.RowsAffected()
-	if err != nil || rows == 0 {
-		http.Error(w, "Wallpaper not found", http.StatusNotFound)
-		return
-	}
-
-	http.Redirect(w, r, "/wallpapers", http.StatusSeeOther)
+	moderate(w, r, func(string) string { return StatusUnpublished }, nil, "/wallpapers")
 }
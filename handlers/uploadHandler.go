@@ -1,16 +1,127 @@
 package handlers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
+var (
+	errInvalidFileType    = errors.New("invalid file type, only images allowed")
+	errFilenameTooLong    = errors.New("filename too long")
+	errDescriptionTooLong = fmt.Errorf("description too long (max %d characters)", maxDescriptionLength)
+	allowedWallpaperExts  = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
+)
+
+// IsWallpaperFile tells if name has one of the extensions accepted for the uploads
+func IsWallpaperFile(name string) bool {
+	return allowedWallpaperExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// storeWallpaper validates an upload, saves the file under web/uploads and the row with its tags,
+// and returns the new wallpaper id. Every upload path (form, API, ...) goes through it.
+func storeWallpaper(userID int, originalName string, src io.Reader, description string, tags []string) (int, error) {
+	ext := strings.ToLower(filepath.Ext(originalName))
+	if !IsWallpaperFile(originalName) {
+		return 0, errInvalidFileType
+	}
+	if len(originalName) > 255 {
+		return 0, errFilenameTooLong
+	}
+	description = strings.TrimSpace(description)
+	if len(description) > maxDescriptionLength {
+		return 0, errDescriptionTooLong
+	}
+	if err := checkQuota(userID, 0); err != nil {
+		return 0, err
+	}
+
+	// Create uploads folder if it doesn't exist
+	os.MkdirAll("web/uploads", 0755)
+
+	// Generate random filename
+	filename := fmt.Sprintf("%d_%s%s", userID, uuid.New().String(), ext)
+	filePath := filepath.Join("web/uploads", filename)
+
+	// Save file
+	dst, err := os.Create(filePath)
+	if err != nil {
+		return 0, err
+	}
+	sum := sha256.New()
+	size, err := io.Copy(io.MultiWriter(dst, sum), src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// the size is only known now, the check before the copy was on the count
+		err = checkQuota(userID, size)
+	}
+	if err != nil {
+		os.Remove(filePath)
+		return 0, err
+	}
+
+	// resolution + dominant color for the search filters, not fatal (webp can't be decoded)
+	// unless the image is too large to be decoded at all
+	info, err := analyzeImage(filePath)
+	if errors.Is(err, errImageTooLarge) {
+		os.Remove(filePath)
+		return 0, err
+	}
+	if err != nil {
+		log.Printf("Could not analyze %s: %v", filename, err)
+	}
+
+	// Save to database
+	result, err := db.Exec(`
+		INSERT INTO wallpapers (user_id, filename, original_name, description, file_path, width, height, dominant_color, color_name, sha256, size_bytes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, filename, originalName, nullIfEmpty(description), filePath,
+		info.Width, info.Height, nullIfEmpty(info.DominantColor), nullIfEmpty(info.ColorName), hex.EncodeToString(sum.Sum(nil)), size)
+	if err != nil {
+		os.Remove(filePath)
+		return 0, err
+	}
+	wallpaperID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	if len(tags) > 0 {
+		if err := setWallpaperTags(int(wallpaperID), tags); err != nil {
+			log.Println("Failed to save tags:", err)
+		}
+	}
+
+	log.Printf("✅ Wallpaper uploaded: %s by user %d", originalName, userID)
+	evaluateBadges(BadgeEventUpload, userID)
+	return int(wallpaperID), nil
+}
+
+// the upload errors the user can fix, as opposed to the internal ones
+func isUploadError(err error) bool {
+	return errors.Is(err, errInvalidFileType) || errors.Is(err, errFilenameTooLong) || errors.Is(err, errDescriptionTooLong) ||
+		errors.Is(err, errQuotaExceeded) || errors.Is(err, errImageTooLarge)
+}
+
+// the page of a batch upload: what was stored and what failed, file by file
+type UploadReportPageData struct {
+	Username string
+	IsAdmin  bool
+	UploadReport
+}
+
+// UploadHandler stores the wallpapers of the upload form: one file, several files or ZIP archives
 func UploadHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
@@ -24,60 +135,84 @@ func UploadHandler(w http.ResponseWriter, r *http.Request) {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
-
-	// Get file from form
-	file, header, err := r.FormFile("wallpaper")
-	if err != nil {
-		http.Error(w, "Failed to read file", http.StatusBadRequest)
+	// a full account is refused before its files are received
+	if err := checkQuota(userID, 0); err != nil {
+		if errors.Is(err, errQuotaExceeded) {
+			http.Error(w, err.Error()+". Delete some wallpapers and empty the trash to upload more.", http.StatusForbidden)
+			return
+		}
+		log.Println("Failed to check the storage quota:", err)
+		http.Error(w, "Failed to save wallpaper", http.StatusInternalServerError)
 		return
 	}
-	defer file.Close()
 
-	// check file extension
-	ext := filepath.Ext(header.Filename)
-	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true}
-	if !allowedExts[ext] {
-		http.Error(w, "Invalid file type. Only images allowed", http.StatusBadRequest)
+	// several files and ZIP archives per request, see batchUpload.go
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchRequestSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, "Failed to read the files (max 500 MB per upload)", http.StatusBadRequest)
 		return
 	}
-
-	// check filename length
-	if len(header.Filename) > 255 {
-		http.Error(w, "Filename too long", http.StatusBadRequest)
+	defer r.MultipartForm.RemoveAll()
+	files := r.MultipartForm.File["wallpaper"]
+	if len(files) == 0 {
+		http.Error(w, "Failed to read file", http.StatusBadRequest)
 		return
 	}
 
-	// Create uploads folder if it doesn't exist
-	os.MkdirAll("web/uploads", 0755)
-
-	// Generate random filename
-	filename := fmt.Sprintf("%d_%s%s", userID, uuid.New().String(), ext)
-	filePath := filepath.Join("web/uploads", filename)
-
-	// Save file
-	dst, err := os.Create(filePath)
+	tags, err := parseTags(r.FormValue("tags"))
 	if err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection := strings.TrimSpace(r.FormValue("collection"))
+	if len(collection) > 100 {
+		http.Error(w, "Collection name must be 1-100 characters", http.StatusBadRequest)
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		http.Error(w, "Failed to save file", http.StatusInternalServerError)
+	// one plain file: as before, straight back to the gallery
+	if len(files) == 1 && !isZipFile(files[0].Filename) && collection == "" {
+		file, err := files[0].Open()
+		if err != nil {
+			http.Error(w, "Failed to read file", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		if _, err := storeWallpaper(userID, files[0].Filename, file, r.FormValue("description"), tags); err != nil {
+			if errors.Is(err, errQuotaExceeded) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if isUploadError(err) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			log.Println("Failed to save wallpaper:", err)
+			http.Error(w, "Failed to save wallpaper", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/wallpapers", http.StatusSeeOther)
 		return
 	}
 
-	// Save to database
-	_, err = db.Exec(`
-		INSERT INTO wallpapers (user_id, filename, original_name, file_path)
-		VALUES (?, ?, ?, ?)
-	`, userID, filename, header.Filename, filePath)
+	report, err := storeBatch(userID, files, r.FormValue("description"), tags, collection)
 	if err != nil {
-		log.Println("Failed to save wallpaper to DB:", err)
-		http.Error(w, "Failed to save wallpaper", http.StatusInternalServerError)
+		log.Println("Failed to create the collection of the batch:", err)
+		http.Error(w, "The files were uploaded, but the collection could not be created", http.StatusInternalServerError)
 		return
 	}
+	log.Printf("✅ Batch upload by user %d: %d uploaded, %d failed", userID, report.Uploaded, report.Failed)
 
-	log.Printf("✅ Wallpaper uploaded: %s by user %d", header.Filename, userID)
-	http.Redirect(w, r, "/wallpapers", http.StatusSeeOther)
+	data := UploadReportPageData{UploadReport: report}
+	if user := getCurrentUser(r); user != nil {
+		data.Username, data.IsAdmin = user.Username, user.IsAdmin
+	}
+	status := http.StatusOK
+	if report.Uploaded == 0 {
+		status = http.StatusBadRequest
+	}
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "upload-report.html", data); err != nil {
+		log.Println("Template error:", err)
+	}
 }
@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strings"
+)
+
+type PublicProfileData struct {
+	Username    string // logged-in user, for the nav
+	IsAdmin     bool
+	LoggedIn    bool
+	Profile     string // profile owner
+	Badges      []Badge
+	Wallpapers  []Wallpaper
+	Collections []Collection
+	Followers   int
+	Following   int
+	IsSelf      bool
+	IsFollowing bool
+	IsFriend    bool
+}
+
+// UserProfileHandler renders the public page of an uploader
+// URL format: /u/{username}
+func UserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	username := strings.TrimPrefix(r.URL.Path, "/u/")
+	if username == "" || strings.Contains(username, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var profileID int
+	err := db.QueryRow("SELECT id, username FROM users WHERE username = ?", username).Scan(&profileID, &username)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := PublicProfileData{Profile: username}
+	viewerID := 0
+	if user := getCurrentUser(r); user != nil {
+		viewerID = user.UserID
+		data.Username = user.Username
+		data.IsAdmin = user.IsAdmin
+		data.LoggedIn = true
+		data.IsSelf = user.UserID == profileID
+
+		// blocked users don't get to see each other's page
+		if isBlocked(user.UserID, profileID) {
+			http.NotFound(w, r)
+			return
+		}
+
+		var following bool
+		err = db.QueryRow("SELECT EXISTS(SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?)", user.UserID, profileID).
+			Scan(&following)
+		if err != nil {
+			log.Println("Failed to query follows:", err)
+		}
+		data.IsFollowing = following
+		data.IsFriend = areFriends(user.UserID, profileID)
+	}
+
+	err = db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM follows WHERE followee_id = ?),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = ?)
+	`, profileID, profileID).Scan(&data.Followers, &data.Following)
+	if err != nil {
+		log.Println("Failed to count follows:", err)
+	}
+
+	badges, err := badgesByUser(profileID)
+	if err != nil {
+		log.Println("Failed to load badges:", err)
+	}
+	data.Badges = badges[profileID]
+
+	rows, err := db.Query(`
+		SELECT id, filename, original_name, uploaded_at, status
+		FROM wallpapers
+		WHERE user_id = ? AND status = 'approved' AND deleted_at IS NULL AND archived_at IS NULL
+		ORDER BY COALESCE(published_at, uploaded_at) DESC, id DESC
+	`, profileID)
+	if err != nil {
+		log.Println("Failed to query wallpapers:", err)
+		http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var w Wallpaper
+		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.Status); err != nil {
+			log.Println("Row scan error:", err)
+			continue
+		}
+		data.Wallpapers = append(data.Wallpapers, w)
+	}
+
+	attachTags(data.Wallpapers)
+
+	data.Collections, err = queryCollections(viewerID, "c.user_id = ? AND c.visibility = ?", profileID, CollectionPublic)
+	if err != nil {
+		log.Println("Failed to query collections:", err)
+	}
+
+	if err := templates.ExecuteTemplate(w, "user.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,497 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// error codes of the /api/v1 envelopes, next to the human readable message
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeInvalidField     = "invalid_field"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeInternal         = "internal_error"
+)
+
+// list scopes of GET /api/v1/wallpapers
+const (
+	ScopeMine    = "mine"    // the user's wallpapers, without the archived ones
+	ScopeArchive = "archive" // the user's archived wallpapers
+	ScopePublic  = "public"  // the community gallery, no login needed
+)
+
+// APIError is the body of every /api/v1 error. It keeps the "error" key of jsonError
+// so the older clients read it the same way.
+type APIError struct {
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// WallpaperList is a page of GET /api/v1/wallpapers
+type WallpaperList struct {
+	Data       []Wallpaper `json:"data"`
+	NextCursor string      `json:"next_cursor,omitempty"` // pass it as ?cursor= for the next page, empty on the last one
+}
+
+// WallpaperUpdate is the body of PATCH /api/v1/wallpapers/{id}, missing fields are left as they are
+type WallpaperUpdate struct {
+	OriginalName *string   `json:"original_name,omitempty"`
+	Description  *string   `json:"description,omitempty"`
+	Tags         *[]string `json:"tags,omitempty"` // replaces all the tags
+}
+
+// the fields ?fields= can select, the JSON names of Wallpaper
+var wallpaperFields = jsonFieldNames(reflect.TypeOf(Wallpaper{}))
+
+func apiError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, APIError{Error: message, Code: code})
+}
+
+// WallpapersAPIHandler serves the versioned wallpapers API, with the same rules as the HTML forms:
+//
+//	GET    /api/v1/wallpapers                          list ?scope=mine|archive|public&status=&cursor=&limit=
+//	POST   /api/v1/wallpapers                          upload, multipart: wallpaper, tags, description
+//	GET    /api/v1/wallpapers/{id}                     one wallpaper
+//	PATCH  /api/v1/wallpapers/{id}                     update {original_name, description, tags}
+//	DELETE /api/v1/wallpapers/{id}                     move to the trash
+//	POST   /api/v1/wallpapers/{id}/publish-request     submit for review
+//
+// Every GET takes ?fields=id,filename,... to only return some fields.
+func WallpapersAPIHandler(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/wallpapers"), "/")
+	user := getAPIUser(r)
+
+	fields, err := parseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidField, err.Error())
+		return
+	}
+
+	if path == "" {
+		switch r.Method {
+		case http.MethodGet:
+			listWallpapersAPI(w, r, user, fields)
+		case http.MethodPost:
+			if user == nil {
+				apiError(w, http.StatusUnauthorized, CodeUnauthorized, "Please log in")
+				return
+			}
+			uploadWallpaperAPI(w, r, user)
+		default:
+			apiError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+		}
+		return
+	}
+
+	parts := strings.Split(path, "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || len(parts) > 2 {
+		apiError(w, http.StatusNotFound, CodeNotFound, "Not found")
+		return
+	}
+
+	// a wallpaper the user can't see doesn't exist, whatever the method
+	visible, err := canViewWallpaperAs(user, id)
+	if err != nil {
+		log.Println("ACL check failed:", err)
+		apiError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+		return
+	}
+	if !visible {
+		apiError(w, http.StatusNotFound, CodeNotFound, "Wallpaper not found")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		getWallpaperAPI(w, user, id, fields)
+	case user == nil:
+		apiError(w, http.StatusUnauthorized, CodeUnauthorized, "Please log in")
+	case len(parts) == 1 && r.Method == http.MethodPatch:
+		updateWallpaperAPI(w, r, user, id)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		deleteWallpaperAPI(w, r, user, id)
+	case len(parts) == 2 && parts[1] == "publish-request" && r.Method == http.MethodPost:
+		publishRequestAPI(w, r, user, id)
+	case len(parts) == 1 || parts[1] == "publish-request":
+		apiError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed")
+	default:
+		apiError(w, http.StatusNotFound, CodeNotFound, "Not found")
+	}
+}
+
+// the columns read by scanWallpaper, wallpapers aliased as w and users as u
+const wallpaperColumnsSQL = `w.id, w.user_id, u.username, w.filename, w.original_name, COALESCE(w.description, ''),
+	w.uploaded_at, w.width, w.height, COALESCE(w.dominant_color, ''), COALESCE(w.sha256, ''), w.status, COALESCE(w.rejection_reason, ''),
+	w.publish_at, w.unpublish_at, w.archived_at, w.deleted_at, w.share_mode`
+
+func scanWallpaper(row interface{ Scan(...interface{}) error }) (Wallpaper, error) {
+	var w Wallpaper
+	err := row.Scan(&w.ID, &w.UserID, &w.Owner, &w.Filename, &w.OriginalName, &w.Description,
+		&w.UploadedAt, &w.Width, &w.Height, &w.DominantColor, &w.SHA256, &w.Status, &w.RejectionReason,
+		&w.PublishAt, &w.UnpublishAt, &w.ArchivedAt, &w.DeletedAt, &w.ShareMode)
+	return w, err
+}
+
+// getWallpaper loads one wallpaper with its tags, whatever its state (no ACL)
+func getWallpaper(id int) (Wallpaper, error) {
+	wp, err := scanWallpaper(db.QueryRow(`
+		SELECT `+wallpaperColumnsSQL+`
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		WHERE w.id = ?`, id))
+	if err != nil {
+		return wp, err
+	}
+	tags, err := tagsByWallpaper(id)
+	if err != nil {
+		return wp, err
+	}
+	wp.Tags = tags[id]
+	return wp, nil
+}
+
+func listWallpapersAPI(w http.ResponseWriter, r *http.Request, user *UserProfile, fields []string) {
+	q := r.URL.Query()
+	cursor, err := parseCursor(q.Get("cursor"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+	limit := queryInt(r, "limit", galleryPageSize, 1, maxGalleryPageSize)
+
+	scope := q.Get("scope")
+	if scope == "" {
+		scope = ScopeMine
+		if user == nil {
+			scope = ScopePublic
+		}
+	}
+
+	var cond string
+	var args []interface{}
+	switch scope {
+	case ScopePublic:
+		cond = "w.status = 'approved' AND w.deleted_at IS NULL AND w.archived_at IS NULL"
+	case ScopeMine, ScopeArchive:
+		if user == nil {
+			apiError(w, http.StatusUnauthorized, CodeUnauthorized, "Please log in")
+			return
+		}
+		cond = "w.user_id = ? AND w.deleted_at IS NULL AND w.archived_at IS NULL"
+		if scope == ScopeArchive {
+			cond = "w.user_id = ? AND w.deleted_at IS NULL AND w.archived_at IS NOT NULL"
+		}
+		args = append(args, user.UserID)
+		if status := q.Get("status"); status != "" {
+			if _, ok := transitions[status]; !ok {
+				apiError(w, http.StatusBadRequest, CodeInvalidRequest, "Unknown status "+status)
+				return
+			}
+			cond += " AND w.status = ?"
+			args = append(args, status)
+		}
+	default:
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "scope must be mine, archive or public")
+		return
+	}
+
+	wallpapers, next, err := pageWallpapers(`
+		SELECT `+wallpaperColumnsSQL+`
+		FROM wallpapers w
+		JOIN users u ON u.id = w.user_id
+		WHERE `+cond, args, cursor, limit, func(rows *sql.Rows) (Wallpaper, error) {
+		return scanWallpaper(rows)
+	})
+	if err != nil {
+		log.Println("Failed to query wallpapers:", err)
+		apiError(w, http.StatusInternalServerError, CodeInternal, "Failed to load wallpapers")
+		return
+	}
+	attachTags(wallpapers)
+	for i := range wallpapers {
+		wallpapers[i] = viewOf(wallpapers[i], user)
+	}
+	if wallpapers == nil {
+		wallpapers = []Wallpaper{}
+	}
+	writeFields(w, http.StatusOK, WallpaperList{Data: wallpapers, NextCursor: next}, fields)
+}
+
+func getWallpaperAPI(w http.ResponseWriter, user *UserProfile, id int, fields []string) {
+	wp, err := getWallpaper(id)
+	if err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+	writeFields(w, http.StatusOK, viewOf(wp, user), fields)
+}
+
+// viewOf hides the moderation and sharing details from everyone but the owner and the admins
+func viewOf(wp Wallpaper, viewer *UserProfile) Wallpaper {
+	if viewer != nil && (viewer.UserID == wp.UserID || viewer.IsAdmin) {
+		return wp
+	}
+	wp.RejectionReason, wp.ShareMode = "", ""
+	wp.PublishAt, wp.UnpublishAt, wp.ArchivedAt, wp.DeletedAt = nil, nil, nil, nil
+	return wp
+}
+
+func uploadWallpaperAPI(w http.ResponseWriter, r *http.Request, user *UserProfile) {
+	// a full account is refused before its file is received, as in UploadHandler
+	if err := checkQuota(user.UserID, 0); err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchRequestSize)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			apiError(w, http.StatusRequestEntityTooLarge, CodeInvalidRequest,
+				fmt.Sprintf("The request is too large (max %d MB)", maxBatchRequestSize>>20))
+			return
+		}
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "A multipart \"wallpaper\" file is required")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("wallpaper")
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "A multipart \"wallpaper\" file is required")
+		return
+	}
+	defer file.Close()
+
+	tags, err := parseTags(r.FormValue("tags"))
+	if err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+		return
+	}
+
+	id, err := storeWallpaper(user.UserID, header.Filename, file, r.FormValue("description"), tags)
+	if err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+	wp, err := getWallpaper(id)
+	if err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/wallpapers/"+strconv.Itoa(id))
+	writeJSON(w, http.StatusCreated, wp)
+}
+
+// name and description are the owner's, tags can also be edited by the admins (audited)
+func updateWallpaperAPI(w http.ResponseWriter, r *http.Request, user *UserProfile, id int) {
+	var req WallpaperUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+
+	wp, err := getWallpaper(id)
+	if err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+	if wp.DeletedAt != nil {
+		apiError(w, http.StatusConflict, CodeConflict, "The wallpaper is in the trash")
+		return
+	}
+	isOwner := wp.UserID == user.UserID
+	if !isOwner && (req.OriginalName != nil || req.Description != nil || !user.IsAdmin) {
+		log.Printf("⚠️ Unauthorized API update: user %d on wallpaper owned by %d", user.UserID, wp.UserID)
+		apiError(w, http.StatusForbidden, CodeForbidden, "Only the owner can edit this wallpaper")
+		return
+	}
+
+	if req.OriginalName != nil {
+		name := strings.TrimSpace(*req.OriginalName)
+		if name == "" || len(name) > 255 {
+			apiError(w, http.StatusBadRequest, CodeInvalidRequest, "original_name must be 1 to 255 characters")
+			return
+		}
+		req.OriginalName = &name
+	}
+	if req.Description != nil {
+		description := strings.TrimSpace(*req.Description)
+		if len(description) > maxDescriptionLength {
+			apiError(w, http.StatusBadRequest, CodeInvalidRequest, errDescriptionTooLong.Error())
+			return
+		}
+		req.Description = &description
+	}
+	var tags []string
+	if req.Tags != nil {
+		if tags, err = parseTags(strings.Join(*req.Tags, ",")); err != nil {
+			apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+			return
+		}
+	}
+
+	if req.OriginalName != nil {
+		if _, err := db.Exec("UPDATE wallpapers SET original_name = ? WHERE id = ?", *req.OriginalName, id); err != nil {
+			writeWallpaperError(w, err)
+			return
+		}
+	}
+	if req.Description != nil {
+		if _, err := db.Exec("UPDATE wallpapers SET description = ? WHERE id = ?", nullIfEmpty(*req.Description), id); err != nil {
+			writeWallpaperError(w, err)
+			return
+		}
+	}
+	if req.Tags != nil {
+		if err := setWallpaperTags(id, tags); err != nil {
+			writeWallpaperError(w, err)
+			return
+		}
+		if !isOwner {
+			audit(r, user, AuditEditTags, AuditTargetWallpaper, id,
+				map[string][]string{"tags": wp.Tags}, map[string][]string{"tags": tags})
+		}
+	}
+
+	log.Printf("✅ Wallpaper %d updated through the API by user %d", id, user.UserID)
+	getWallpaperAPI(w, user, id, nil)
+}
+
+func deleteWallpaperAPI(w http.ResponseWriter, r *http.Request, user *UserProfile, id int) {
+	wp, err := getWallpaper(id)
+	if err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+	if wp.UserID != user.UserID && !user.IsAdmin {
+		log.Printf("⚠️ Unauthorized API delete: user %d on wallpaper owned by %d", user.UserID, wp.UserID)
+		apiError(w, http.StatusForbidden, CodeForbidden, "Only the owner can delete this wallpaper")
+		return
+	}
+
+	if err := softDeleteWallpaper(id, user.UserID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			apiError(w, http.StatusConflict, CodeConflict, "The wallpaper is already in the trash")
+			return
+		}
+		writeWallpaperError(w, err)
+		return
+	}
+
+	log.Printf("🗑️ Wallpaper %d moved to the trash through the API by user %d", id, user.UserID)
+	if wp.UserID != user.UserID {
+		audit(r, user, AuditDeleteWallpaper, AuditTargetWallpaper, id,
+			map[string]interface{}{"owner_id": wp.UserID, "original_name": wp.OriginalName, "status": wp.Status}, nil)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func publishRequestAPI(w http.ResponseWriter, r *http.Request, user *UserProfile, id int) {
+	_, err := moderateWallpaper(r, user, id, func(string) string { return StatusPending }, "", nil)
+	if err != nil {
+		writeWallpaperError(w, err)
+		return
+	}
+	getWallpaperAPI(w, user, id, nil)
+}
+
+// maps the errors of the wallpaper functions to an API error, internal ones are only logged
+func writeWallpaperError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		apiError(w, http.StatusNotFound, CodeNotFound, "Wallpaper not found")
+	case errors.Is(err, errTransitionDenied), errors.Is(err, errQuotaExceeded):
+		apiError(w, http.StatusForbidden, CodeForbidden, err.Error())
+	case errors.Is(err, errInvalidTransition):
+		apiError(w, http.StatusConflict, CodeConflict, err.Error())
+	case errors.Is(err, errReasonRequired), errors.Is(err, errReasonTooLong), errors.Is(err, errTooManyTags), isUploadError(err):
+		apiError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	default:
+		log.Println("Wallpaper API error:", err)
+		apiError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+	}
+}
+
+// parses ?fields=a,b against the Wallpaper fields, empty means all of them
+func parseFields(value string) ([]string, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var fields []string
+	for _, f := range strings.Split(value, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if !wallpaperFields[f] {
+			return nil, errors.New("unknown field " + f)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// writes v (a Wallpaper or a WallpaperList) as JSON with only the given wallpaper fields
+func writeFields(w http.ResponseWriter, status int, v interface{}, fields []string) {
+	if len(fields) == 0 {
+		writeJSON(w, status, v)
+		return
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		log.Println("JSON encode error:", err)
+		apiError(w, http.StatusInternalServerError, CodeInternal, "Internal server error")
+		return
+	}
+	pick := func(obj map[string]json.RawMessage) map[string]json.RawMessage {
+		picked := make(map[string]json.RawMessage, len(fields))
+		for _, f := range fields {
+			if value, ok := obj[f]; ok {
+				picked[f] = value
+			}
+		}
+		return picked
+	}
+
+	if list, ok := v.(WallpaperList); ok {
+		var page struct {
+			Data []map[string]json.RawMessage `json:"data"`
+		}
+		json.Unmarshal(raw, &page)
+		data := make([]map[string]json.RawMessage, len(page.Data))
+		for i, obj := range page.Data {
+			data[i] = pick(obj)
+		}
+		writeJSON(w, status, map[string]interface{}{"data": data, "next_cursor": list.NextCursor})
+		return
+	}
+	var obj map[string]json.RawMessage
+	json.Unmarshal(raw, &obj)
+	writeJSON(w, status, pick(obj))
+}
+
+// the JSON names of the exported fields of a struct type
+func jsonFieldNames(t reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		names[name] = true
+	}
+	return names
+}
@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"database/sql"
 	"log"
 	"net/http"
 )
 
+// WallpapersHandler shows the user's own wallpapers, a page at a time
+// URL format: /wallpapers?cursor=...
 func WallpapersHandler(w http.ResponseWriter, r *http.Request) {
 	user := getCurrentUser(r)
 	if user == nil {
@@ -12,44 +15,82 @@ func WallpapersHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Use helper to get userID with expiry check
-	userID, err := getUserIDFromSession(r)
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
 	if err != nil {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Get user's wallpapers
-	rows, err := db.Query(`
-		SELECT id, filename, original_name, uploaded_at, ispublic, toreview
-		FROM wallpapers 
-		WHERE user_id = ? 
-		ORDER BY uploaded_at DESC`, userID)
+	data, err := myWallpapersPage(user, cursor, galleryPageSize, false)
 	if err != nil {
 		log.Println("Failed to query wallpapers:", err)
 		http.Error(w, "Failed to load wallpapers", http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var wallpapers []Wallpaper
-	for rows.Next() {
-		var w Wallpaper
-		if err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.UploadedAt, &w.IsPublic, &w.ToReview); err != nil {
-			log.Println("Row scan error:", err)
-			continue
-		}
-		wallpapers = append(wallpapers, w)
+	if err := templates.ExecuteTemplate(w, "wallpapers.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
 	}
+}
 
+// myWallpapersPage loads a page of the user's wallpapers (the archived ones or the others)
+// + friends, shares and collections for the card forms
+func myWallpapersPage(user *UserProfile, cursor *Cursor, limit int, archived bool) (WallpapersPageData, error) {
 	data := WallpapersPageData{
-		Wallpapers:  wallpapers,
 		Username:    user.Username,
 		IsAdmin:     user.IsAdmin,
 		CurrentUser: user,
+		Archived:    archived,
 	}
-	if err := templates.ExecuteTemplate(w, "wallpapers.html", data); err != nil {
-		log.Println("Template error:", err)
-		http.Error(w, "Template error", http.StatusInternalServerError)
+
+	archivedCond := "w.archived_at IS NULL"
+	if archived {
+		archivedCond = "w.archived_at IS NOT NULL"
+	}
+
+	wallpapers, next, err := pageWallpapers(`
+		SELECT w.id, w.filename, w.original_name, COALESCE(w.description, ''), w.uploaded_at, w.width, w.height,
+			w.status, COALESCE(w.rejection_reason, ''), w.publish_at, w.unpublish_at, w.share_mode, w.archived_at
+		FROM wallpapers w
+		WHERE w.user_id = ? AND w.deleted_at IS NULL AND `+archivedCond, []interface{}{user.UserID}, cursor, limit, func(rows *sql.Rows) (Wallpaper, error) {
+		var w Wallpaper
+		err := rows.Scan(&w.ID, &w.Filename, &w.OriginalName, &w.Description, &w.UploadedAt, &w.Width, &w.Height,
+			&w.Status, &w.RejectionReason, &w.PublishAt, &w.UnpublishAt, &w.ShareMode, &w.ArchivedAt)
+		return w, err
+	})
+	if err != nil {
+		return data, err
+	}
+
+	// friends + current shares for the share forms
+	data.Friends, err = listFriends(user.UserID)
+	if err != nil {
+		return data, err
+	}
+	shares, err := sharesByWallpaper(user.UserID)
+	if err != nil {
+		return data, err
+	}
+	for i := range wallpapers {
+		wallpapers[i].SharedWith = shares[wallpapers[i].ID]
 	}
+	attachTags(wallpapers)
+
+	data.Collections, err = queryCollections(user.UserID, "c.user_id = ?", user.UserID)
+	if err != nil {
+		log.Println("Failed to query collections:", err)
+	}
+
+	// upcoming releases, above the first page of the main grid only
+	if cursor == nil && !archived {
+		data.Scheduled, err = scheduledWallpapers(user.UserID)
+		if err != nil {
+			log.Println("Failed to query scheduled wallpapers:", err)
+		}
+	}
+
+	data.Wallpapers = wallpapers
+	data.NextCursor = next
+	return data, nil
 }
@@ -0,0 +1,661 @@
+// / this file contains the outgoing webhooks: subscriptions, the signed deliveries and the queue retrying them
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// webhook events, also the values stored in webhooks.events
+const (
+	EventWallpaperPublished = "wallpaper.published"
+	EventWallpaperRejected  = "wallpaper.rejected"
+	EventCommentCreated     = "comment.created"
+	EventUserRegistered     = "user.registered"
+	EventPing               = "ping" // sent from the webhooks page, to test a receiver
+)
+
+// who receives the events of a webhook (webhooks.scope)
+const (
+	WebhookScopeUser  = "user"  // the events about the owner's wallpapers
+	WebhookScopeAdmin = "admin" // every event of the site, while the owner is an admin
+)
+
+// states of a delivery (webhook_deliveries.state)
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed" // gave up after webhookMaxAttempts
+)
+
+// headers of the deliveries
+const (
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookDeliveryHeader  = "X-Webhook-Delivery"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	maxWebhookURLLength = 500
+	maxWebhooksPerUser  = 10
+	webhookTimeout      = 10 * time.Second
+	webhookLease        = time.Minute // a claimed delivery is retried after that if the worker died
+	webhookBaseDelay    = time.Minute // 1m, 2m, 4m... between the attempts
+	webhookMaxDelay     = 6 * time.Hour
+	webhookMaxAttempts  = 8
+	webhookBatchSize    = 20
+	webhookLogRetention = 30 * 24 * time.Hour
+	webhookPageSize     = 50
+)
+
+// WebhookEvents lists the events with the label shown on the webhooks page
+var WebhookEvents = []WebhookEventType{
+	{Key: EventWallpaperPublished, Label: "A wallpaper goes public"},
+	{Key: EventWallpaperRejected, Label: "A wallpaper is not approved"},
+	{Key: EventCommentCreated, Label: "Someone comments on a wallpaper"},
+	{Key: EventUserRegistered, Label: "A new user registers", AdminOnly: true},
+}
+
+type WebhookEventType struct {
+	Key       string
+	Label     string
+	AdminOnly bool // only sent to the admin webhooks
+}
+
+var (
+	errWebhookURL       = errors.New("the URL must be an http(s) address")
+	errWebhookURLLength = fmt.Errorf("the URL is too long (max %d characters)", maxWebhookURLLength)
+	errWebhookNoEvents  = errors.New("pick at least one event")
+	errWebhookEvent     = errors.New("unknown event")
+	errWebhookAdminOnly = errors.New("this event is only sent to the admin webhooks")
+	errTooManyWebhooks  = fmt.Errorf("you can't have more than %d webhooks", maxWebhooksPerUser)
+	errPrivateAddress   = errors.New("webhooks can't be sent to a private address")
+)
+
+// one row of webhooks
+type Webhook struct {
+	ID        int
+	UserID    int
+	Owner     string
+	URL       string
+	Secret    string // signs the deliveries, see WebhookSignature
+	Events    []string
+	Scope     string
+	Active    bool
+	CreatedAt time.Time
+}
+
+// one row of webhook_deliveries. A redelivery is a new row with the same EventID.
+type WebhookDelivery struct {
+	ID            int
+	WebhookID     int
+	EventID       string
+	Event         string
+	Payload       string
+	State         string
+	Attempts      int
+	NextAttemptAt time.Time
+	LastStatus    int // HTTP status of the last attempt, 0 when it didn't get an answer
+	LastError     string
+	DurationMS    int
+	CreatedAt     time.Time
+	DeliveredAt   *time.Time
+}
+
+// WebhookPayload is the JSON body of every delivery
+type WebhookPayload struct {
+	ID        string      `json:"id"` // same for every delivery of the event, to drop duplicates
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// data of the wallpaper.* events
+type WallpaperEventData struct {
+	Wallpaper Wallpaper `json:"wallpaper"`
+	Actor     string    `json:"actor,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+// data of the user.registered event
+type UserEventData struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// data of the ping event
+type PingEventData struct {
+	WebhookID int    `json:"webhook_id"`
+	Message   string `json:"message"`
+}
+
+// WebhookSignature is the value of the X-Webhook-Signature header: the hex HMAC-SHA256,
+// keyed with the secret of the webhook, of the timestamp header, a dot and the body.
+// Receivers compute it again and compare with hmac.Equal, then drop old timestamps.
+func WebhookSignature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// validates the URL and events of a new webhook
+func checkWebhook(rawURL, scope string, events []string) error {
+	if len(rawURL) > maxWebhookURLLength {
+		return errWebhookURLLength
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errWebhookURL
+	}
+	if len(events) == 0 {
+		return errWebhookNoEvents
+	}
+	for _, e := range events {
+		t, ok := webhookEventType(e)
+		if !ok {
+			return fmt.Errorf("%w %q", errWebhookEvent, e)
+		}
+		if t.AdminOnly && scope != WebhookScopeAdmin {
+			return errWebhookAdminOnly
+		}
+	}
+	return nil
+}
+
+func webhookEventType(key string) (WebhookEventType, bool) {
+	for _, t := range WebhookEvents {
+		if t.Key == key {
+			return t, true
+		}
+	}
+	return WebhookEventType{}, false
+}
+
+// createWebhook saves a new webhook with a fresh secret
+func createWebhook(user *UserProfile, rawURL, scope string, events []string) (int, error) {
+	if scope != WebhookScopeAdmin {
+		scope = WebhookScopeUser
+	}
+	if scope == WebhookScopeAdmin && !user.IsAdmin {
+		return 0, errTransitionDenied
+	}
+	if err := checkWebhook(rawURL, scope, events); err != nil {
+		return 0, err
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhooks WHERE user_id = ?", user.UserID).Scan(&count); err != nil {
+		return 0, err
+	}
+	if count >= maxWebhooksPerUser {
+		return 0, errTooManyWebhooks
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return 0, err
+	}
+	result, err := db.Exec(`
+		INSERT INTO webhooks (user_id, url, secret, events, scope)
+		VALUES (?, ?, ?, ?, ?)
+	`, user.UserID, rawURL, secret, strings.Join(events, ","), scope)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+const webhookColumnsSQL = `h.id, h.user_id, u.username, h.url, h.secret, h.events, h.scope, h.active, h.created_at`
+
+func scanWebhook(row interface{ Scan(...interface{}) error }) (Webhook, error) {
+	var h Webhook
+	var events string
+	err := row.Scan(&h.ID, &h.UserID, &h.Owner, &h.URL, &h.Secret, &events, &h.Scope, &h.Active, &h.CreatedAt)
+	h.Events = strings.Split(events, ",")
+	return h, err
+}
+
+// webhookFor loads a webhook the user may manage: their own user webhooks, and every admin
+// webhook for the admins. Anything else is sql.ErrNoRows.
+func webhookFor(user *UserProfile, id int) (Webhook, error) {
+	h, err := scanWebhook(db.QueryRow(`
+		SELECT `+webhookColumnsSQL+`
+		FROM webhooks h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.id = ?`, id))
+	if err != nil {
+		return h, err
+	}
+	if (h.Scope == WebhookScopeUser && h.UserID != user.UserID) || (h.Scope == WebhookScopeAdmin && !user.IsAdmin) {
+		return h, sql.ErrNoRows
+	}
+	return h, nil
+}
+
+// webhooksOf returns the user webhooks of userID, or every admin webhook when scope is admin
+func webhooksOf(userID int, scope string) ([]Webhook, error) {
+	cond, args := "h.scope = 'user' AND h.user_id = ?", []interface{}{userID}
+	if scope == WebhookScopeAdmin {
+		cond, args = "h.scope = 'admin'", nil
+	}
+	rows, err := db.Query(`
+		SELECT `+webhookColumnsSQL+`
+		FROM webhooks h
+		JOIN users u ON u.id = h.user_id
+		WHERE `+cond+`
+		ORDER BY h.created_at, h.id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []Webhook
+	for rows.Next() {
+		h, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, h)
+	}
+	return hooks, rows.Err()
+}
+
+// emitWebhook queues event for the active webhooks subscribed to it: the user webhooks
+// of ownerID (0 for none) and the admin webhooks. Failures are logged, the action that
+// triggered the event already happened.
+func emitWebhook(event string, ownerID int, data interface{}) {
+	ids, err := queryIDs(`
+		SELECT h.id
+		FROM webhooks h
+		JOIN users u ON u.id = h.user_id
+		WHERE h.active AND FIND_IN_SET(?, h.events)
+			AND ((h.scope = 'user' AND h.user_id = ?) OR (h.scope = 'admin' AND u.isadmin))
+	`, event, ownerID)
+	if err != nil {
+		log.Printf("Failed to find the webhooks of %s: %v", event, err)
+		return
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	payload := WebhookPayload{ID: uuid.New().String(), Event: event, CreatedAt: time.Now().UTC(), Data: data}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to encode the %s webhook payload: %v", event, err)
+		return
+	}
+	for _, id := range ids {
+		if err := queueDelivery(id, payload.ID, event, string(body)); err != nil {
+			log.Printf("Failed to queue %s for webhook %d: %v", event, id, err)
+		}
+	}
+}
+
+// emitWallpaperEvent sends a wallpaper.* event to the owner's webhooks and the admin ones
+func emitWallpaperEvent(event string, wallpaperID int, actor *UserProfile, reason string) {
+	wp, err := getWallpaper(wallpaperID)
+	if err != nil {
+		log.Printf("Failed to load wallpaper %d for %s: %v", wallpaperID, event, err)
+		return
+	}
+	data := WallpaperEventData{Wallpaper: wp, Reason: reason}
+	if actor != nil {
+		data.Actor = actor.Username
+	}
+	emitWebhook(event, wp.UserID, data)
+}
+
+func queueDelivery(webhookID int, eventID, event, payload string) error {
+	_, err := db.Exec(`
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, next_attempt_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, webhookID, eventID, event, payload, time.Now())
+	if err != nil {
+		return err
+	}
+	wakeWebhookWorker()
+	return nil
+}
+
+// redeliver queues the payload of a delivery again, as a new delivery of the same event
+func redeliver(d WebhookDelivery) error {
+	return queueDelivery(d.WebhookID, d.EventID, d.Event, d.Payload)
+}
+
+// pingWebhook queues a ping, whatever events the webhook is subscribed to
+func pingWebhook(h Webhook, by *UserProfile) error {
+	payload := WebhookPayload{
+		ID:        uuid.New().String(),
+		Event:     EventPing,
+		CreatedAt: time.Now().UTC(),
+		Data:      PingEventData{WebhookID: h.ID, Message: "Ping from " + by.Username},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return queueDelivery(h.ID, payload.ID, EventPing, string(body))
+}
+
+// ───── delivery queue ─────
+
+// lets a new delivery go out without waiting for the next tick
+var webhookWake = make(chan struct{}, 1)
+
+func wakeWebhookWorker() {
+	select {
+	case webhookWake <- struct{}{}:
+	default:
+	}
+}
+
+// StartWebhookWorker sends the due deliveries every interval, or as soon as one is queued,
+// until the process exits. Several instances can run it: a delivery is claimed with
+// a conditional update before it is sent.
+func StartWebhookWorker(interval time.Duration) {
+	go func() {
+		lastCleanup := time.Time{}
+		for {
+			now := time.Now()
+			runWebhookDeliveries(now)
+			if now.Sub(lastCleanup) > time.Hour {
+				cleanupWebhookDeliveries(now)
+				lastCleanup = now
+			}
+			select {
+			case <-webhookWake:
+			case <-time.After(interval):
+			}
+		}
+	}()
+}
+
+// runWebhookDeliveries sends the pending deliveries whose next attempt is due,
+// the batch goes out in parallel so one slow receiver doesn't hold the others
+func runWebhookDeliveries(now time.Time) {
+	ids, err := queryIDs(`
+		SELECT id FROM webhook_deliveries
+		WHERE state = 'pending' AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?`, now, webhookBatchSize)
+	if err != nil {
+		log.Println("Webhook queue query failed:", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		claimed, err := claimDelivery(id, now)
+		if err != nil {
+			log.Printf("Failed to claim webhook delivery %d: %v", id, err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			attemptDelivery(id)
+		}(id)
+	}
+	wg.Wait()
+}
+
+// claimDelivery pushes the next attempt past the lease, only one worker gets to do it
+func claimDelivery(id int, now time.Time) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE webhook_deliveries SET next_attempt_at = ?
+		WHERE id = ? AND state = 'pending' AND next_attempt_at <= ?
+	`, now.Add(webhookLease), id, now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+func attemptDelivery(id int) {
+	var d WebhookDelivery
+	var hookURL, secret, scope string
+	var active bool
+	err := db.QueryRow(`
+		SELECT d.id, d.event_id, d.event, d.payload, d.attempts, h.url, h.secret, h.scope, h.active
+		FROM webhook_deliveries d
+		JOIN webhooks h ON h.id = d.webhook_id
+		WHERE d.id = ?`, id).
+		Scan(&d.ID, &d.EventID, &d.Event, &d.Payload, &d.Attempts, &hookURL, &secret, &scope, &active)
+	if err != nil {
+		log.Printf("Failed to load webhook delivery %d: %v", id, err)
+		return
+	}
+
+	if !active {
+		recordAttempt(d, 0, 0, errors.New("the webhook is disabled"), true)
+		return
+	}
+
+	// the admins can point their webhooks at the local network (the bot, the CI),
+	// the users can't
+	client := webhookClient
+	if scope == WebhookScopeUser {
+		client = publicWebhookClient
+	}
+	start := time.Now()
+	status, err := sendWebhook(client, hookURL, secret, d, time.Now())
+	recordAttempt(d, status, time.Since(start), err, false)
+}
+
+// sendWebhook POSTs the payload of d to hookURL, signed with secret. A 2xx answer is a success,
+// anything else an error with the status (0 if there was no answer).
+func sendWebhook(client *http.Client, hookURL, secret string, d WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest(http.MethodPost, hookURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wp-manager-webhooks/1")
+	req.Header.Set(WebhookEventHeader, d.Event)
+	req.Header.Set(WebhookDeliveryHeader, strconv.Itoa(d.ID))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, WebhookSignature(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// a bit of the answer helps to debug a failing receiver
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg := fmt.Sprintf("HTTP %d", resp.StatusCode)
+		if s := strings.TrimSpace(string(snippet)); s != "" {
+			msg += ": " + s
+		}
+		return resp.StatusCode, errors.New(msg)
+	}
+	return resp.StatusCode, nil
+}
+
+// recordAttempt saves the outcome of an attempt: delivered, retried later, or failed
+// once the attempts are used up (or right away when final)
+func recordAttempt(d WebhookDelivery, status int, took time.Duration, sendErr error, final bool) {
+	attempts := d.Attempts + 1
+	var statusCode interface{}
+	if status != 0 {
+		statusCode = status
+	}
+
+	var err error
+	if sendErr == nil {
+		_, err = db.Exec(`
+			UPDATE webhook_deliveries
+			SET state = 'delivered', attempts = ?, last_status = ?, last_error = NULL, duration_ms = ?, delivered_at = NOW()
+			WHERE id = ?
+		`, attempts, statusCode, took.Milliseconds(), d.ID)
+	} else {
+		state, next := DeliveryPending, time.Now().Add(webhookBackoff(attempts))
+		if final || attempts >= webhookMaxAttempts {
+			state = DeliveryFailed
+		}
+		log.Printf("Webhook delivery %d (%s) attempt %d failed: %v", d.ID, d.Event, attempts, sendErr)
+		_, err = db.Exec(`
+			UPDATE webhook_deliveries
+			SET state = ?, attempts = ?, next_attempt_at = ?, last_status = ?, last_error = ?, duration_ms = ?
+			WHERE id = ?
+		`, state, attempts, next, statusCode, truncate(sendErr.Error(), 255), took.Milliseconds(), d.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to record webhook delivery %d: %v", d.ID, err)
+	}
+}
+
+// the wait before the next attempt, after attempts failed ones
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookBaseDelay
+	for i := 1; i < attempts && delay < webhookMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxDelay {
+		delay = webhookMaxDelay
+	}
+	return delay
+}
+
+// drops the finished deliveries older than the retention, the pending ones stay
+func cleanupWebhookDeliveries(now time.Time) {
+	result, err := db.Exec("DELETE FROM webhook_deliveries WHERE state <> 'pending' AND created_at < ?", now.Add(-webhookLogRetention))
+	if err != nil {
+		log.Println("Failed to clean up the webhook deliveries:", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Removed %d old webhook deliveries", n)
+	}
+}
+
+// redirects are not followed: the URL of a webhook is the only place it may post to
+var webhookClient = &http.Client{
+	Timeout:       webhookTimeout,
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// the client of the user webhooks refuses the loopback and private addresses. It checks
+// the address actually dialed, so a public name resolving to 127.0.0.1 doesn't get through.
+var publicWebhookClient = &http.Client{
+	Timeout:       webhookTimeout,
+	CheckRedirect: webhookClient.CheckRedirect,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !publicIP(ip) {
+					return errPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: webhookTimeout,
+	},
+}
+
+func publicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
+
+// ───── delivery log ─────
+
+const deliveryColumnsSQL = `d.id, d.webhook_id, d.event_id, d.event, d.payload, d.state, d.attempts, d.next_attempt_at,
+	COALESCE(d.last_status, 0), COALESCE(d.last_error, ''), COALESCE(d.duration_ms, 0), d.created_at, d.delivered_at`
+
+func scanDelivery(row interface{ Scan(...interface{}) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &d.Payload, &d.State, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatus, &d.LastError, &d.DurationMS, &d.CreatedAt, &d.DeliveredAt)
+	return d, err
+}
+
+func getDelivery(id int) (WebhookDelivery, error) {
+	return scanDelivery(db.QueryRow(`SELECT `+deliveryColumnsSQL+` FROM webhook_deliveries d WHERE d.id = ?`, id))
+}
+
+// webhookDeliveries returns a page of the deliveries of a webhook, newest first
+func webhookDeliveries(webhookID int, cursor *Cursor, limit int) ([]WebhookDelivery, string, error) {
+	after, afterArgs := cursor.where("d.created_at", "d.id")
+	args := append(append([]interface{}{webhookID}, afterArgs...), limit+1)
+	rows, err := db.Query(`
+		SELECT `+deliveryColumnsSQL+`
+		FROM webhook_deliveries d
+		WHERE d.webhook_id = ? AND `+after+`
+		ORDER BY d.created_at DESC, d.id DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	next := ""
+	for rows.Next() {
+		d, err := scanDelivery(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(deliveries) == limit {
+			last := deliveries[len(deliveries)-1]
+			next = Cursor{Time: last.CreatedAt, ID: last.ID}.String()
+			break
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, next, rows.Err()
+}
+
+// the payload indented, for the delivery log
+func (d WebhookDelivery) PrettyPayload() string {
+	var out bytes.Buffer
+	if err := json.Indent(&out, []byte(d.Payload), "", "  "); err != nil {
+		return d.Payload
+	}
+	return out.String()
+}
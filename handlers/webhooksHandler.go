@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type WebhooksPageData struct {
+	Username      string
+	IsAdmin       bool
+	Webhooks      []Webhook // the user's own webhooks
+	AdminWebhooks []Webhook // every admin webhook, for the admins
+	Events        []WebhookEventType
+	Error         string
+}
+
+type WebhookDeliveriesPageData struct {
+	Username   string
+	IsAdmin    bool
+	Webhook    Webhook
+	Deliveries []WebhookDelivery
+	NextCursor string
+}
+
+// WebhooksHandler lists the user's webhooks (GET) or adds one (POST)
+// form: url, event (repeated), scope (user|admin, admin only)
+func WebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := WebhooksPageData{Username: user.Username, IsAdmin: user.IsAdmin, Events: WebhookEvents}
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Failed to parse form", http.StatusBadRequest)
+			return
+		}
+		scope := r.FormValue("scope")
+		id, err := createWebhook(user, strings.TrimSpace(r.FormValue("url")), scope, r.Form["event"])
+		switch {
+		case err == nil:
+			log.Printf("🪝 Webhook %d added by %s (%s)", id, user.Username, scope)
+			if scope == WebhookScopeAdmin {
+				audit(r, user, AuditCreateWebhook, AuditTargetWebhook, id, nil,
+					map[string]interface{}{"url": r.FormValue("url"), "events": r.Form["event"]})
+			}
+			http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+			return
+		case errors.Is(err, errTransitionDenied):
+			http.Error(w, "Admin access required", http.StatusForbidden)
+			return
+		case isWebhookError(err):
+			// the form is shown again with the message
+			data.Error, status = err.Error(), http.StatusBadRequest
+		default:
+			log.Println("Failed to add the webhook:", err)
+			http.Error(w, "Failed to add the webhook", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var err error
+	data.Webhooks, err = webhooksOf(user.UserID, WebhookScopeUser)
+	if err == nil && user.IsAdmin {
+		data.AdminWebhooks, err = webhooksOf(user.UserID, WebhookScopeAdmin)
+	}
+	if err != nil {
+		log.Println("Failed to query the webhooks:", err)
+		http.Error(w, "Failed to load the webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(status)
+	if err := templates.ExecuteTemplate(w, "webhooks.html", data); err != nil {
+		log.Println("Template error:", err)
+	}
+}
+
+func isWebhookError(err error) bool {
+	for _, target := range []error{errWebhookURL, errWebhookURLLength, errWebhookNoEvents, errWebhookEvent, errWebhookAdminOnly, errTooManyWebhooks} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookFromForm loads the webhook of the webhook_id form value for the actions below,
+// it writes the error and returns false when there is none the user may manage
+func webhookFromForm(w http.ResponseWriter, r *http.Request, user *UserProfile) (Webhook, bool) {
+	id, err := strconv.Atoi(r.FormValue("webhook_id"))
+	if err != nil {
+		http.Error(w, "Webhook ID missing", http.StatusBadRequest)
+		return Webhook{}, false
+	}
+	h, err := webhookFor(user, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return h, false
+	}
+	if err != nil {
+		log.Println("Failed to load the webhook:", err)
+		http.Error(w, "Failed to load the webhook", http.StatusInternalServerError)
+		return h, false
+	}
+	return h, true
+}
+
+// postUser checks the method and the session of the form posts, nil when the request was answered
+func postUser(w http.ResponseWriter, r *http.Request) *UserProfile {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return nil
+	}
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	}
+	return user
+}
+
+// DeleteWebhookHandler removes a webhook and its delivery log
+func DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user := postUser(w, r)
+	if user == nil {
+		return
+	}
+	h, ok := webhookFromForm(w, r, user)
+	if !ok {
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM webhooks WHERE id = ?", h.ID); err != nil {
+		log.Println("Failed to delete the webhook:", err)
+		http.Error(w, "Failed to delete the webhook", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🪝 Webhook %d deleted by %s", h.ID, user.Username)
+	if h.Scope == WebhookScopeAdmin {
+		audit(r, user, AuditDeleteWebhook, AuditTargetWebhook, h.ID,
+			map[string]interface{}{"url": h.URL, "events": h.Events, "owner": h.Owner}, nil)
+	}
+	http.Redirect(w, r, "/webhooks", http.StatusSeeOther)
+}
+
+// ToggleWebhookHandler pauses or resumes a webhook, the deliveries due while it is paused fail
+func ToggleWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user := postUser(w, r)
+	if user == nil {
+		return
+	}
+	h, ok := webhookFromForm(w, r, user)
+	if !ok {
+		return
+	}
+
+	if _, err := db.Exec("UPDATE webhooks SET active = ? WHERE id = ?", !h.Active, h.ID); err != nil {
+		log.Println("Failed to update the webhook:", err)
+		http.Error(w, "Failed to update the webhook", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, redirectBack(r, "/webhooks"), http.StatusSeeOther)
+}
+
+// PingWebhookHandler sends a ping event to a webhook, to check the receiver and its signature check
+func PingWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user := postUser(w, r)
+	if user == nil {
+		return
+	}
+	h, ok := webhookFromForm(w, r, user)
+	if !ok {
+		return
+	}
+
+	if err := pingWebhook(h, user); err != nil {
+		log.Println("Failed to queue the ping:", err)
+		http.Error(w, "Failed to send the ping", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, h.DeliveriesURL(""), http.StatusSeeOther)
+}
+
+// WebhookDeliveriesHandler shows the delivery log of a webhook, newest first
+// URL format: /webhooks/deliveries?webhook_id=3&cursor=...
+func WebhookDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	user := getCurrentUser(r)
+	if user == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	h, ok := webhookFromForm(w, r, user)
+	if !ok {
+		return
+	}
+	cursor, err := parseCursor(r.URL.Query().Get("cursor"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data := WebhookDeliveriesPageData{Username: user.Username, IsAdmin: user.IsAdmin, Webhook: h}
+	data.Deliveries, data.NextCursor, err = webhookDeliveries(h.ID, cursor, webhookPageSize)
+	if err != nil {
+		log.Println("Failed to query the webhook deliveries:", err)
+		http.Error(w, "Failed to load the deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	if err := templates.ExecuteTemplate(w, "webhook-deliveries.html", data); err != nil {
+		log.Println("Template error:", err)
+		http.Error(w, "Template error", http.StatusInternalServerError)
+	}
+}
+
+// RedeliverWebhookHandler queues a delivery again, with the same payload and event id
+// form: delivery_id
+func RedeliverWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	user := postUser(w, r)
+	if user == nil {
+		return
+	}
+
+	id, err := strconv.Atoi(r.FormValue("delivery_id"))
+	if err != nil {
+		http.Error(w, "Delivery ID missing", http.StatusBadRequest)
+		return
+	}
+	d, err := getDelivery(id)
+	if err == nil {
+		_, err = webhookFor(user, d.WebhookID)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if err == nil {
+		err = redeliver(d)
+	}
+	if err != nil {
+		log.Println("Failed to redeliver:", err)
+		http.Error(w, "Failed to redeliver", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("🪝 Delivery %d of webhook %d queued again by %s", d.ID, d.WebhookID, user.Username)
+	http.Redirect(w, r, redirectBack(r, "/webhooks"), http.StatusSeeOther)
+}
+
+// the link to the delivery log of the webhook, at the page after cursor
+func (h Webhook) DeliveriesURL(cursor string) string {
+	u := "/webhooks/deliveries?webhook_id=" + strconv.Itoa(h.ID)
+	if cursor != "" {
+		u += "&cursor=" + cursor
+	}
+	return u
+}
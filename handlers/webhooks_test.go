@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSendWebhookSigned(t *testing.T) {
+	const secret = "whsec_test"
+	payload := `{"id":"e1","event":"ping","created_at":"2026-01-01T00:00:00Z","data":{}}`
+	now := time.Unix(1767225600, 0)
+
+	var received bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != payload {
+			t.Errorf("body = %s", body)
+		}
+		if r.Header.Get(WebhookEventHeader) != EventPing || r.Header.Get(WebhookDeliveryHeader) != "7" {
+			t.Errorf("headers = %v", r.Header)
+		}
+		// what a receiver does
+		timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+		if err != nil || timestamp != now.Unix() {
+			t.Errorf("timestamp = %q", r.Header.Get(WebhookTimestampHeader))
+		}
+		want := WebhookSignature(secret, timestamp, body)
+		if !hmac.Equal([]byte(r.Header.Get(WebhookSignatureHeader)), []byte(want)) {
+			t.Errorf("signature = %q, want %q", r.Header.Get(WebhookSignatureHeader), want)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	d := WebhookDelivery{ID: 7, Event: EventPing, Payload: payload}
+	status, err := sendWebhook(webhookClient, receiver.URL, secret, d, now)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("sendWebhook = %d, %v", status, err)
+	}
+	if !received {
+		t.Fatal("the receiver got nothing")
+	}
+
+	// signed with another secret, the receiver's check fails
+	if hmac.Equal([]byte(WebhookSignature("whsec_other", now.Unix(), []byte(payload))),
+		[]byte(WebhookSignature(secret, now.Unix(), []byte(payload)))) {
+		t.Error("the signature doesn't depend on the secret")
+	}
+}
+
+func TestSendWebhookRefused(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad signature", http.StatusUnauthorized)
+	}))
+	defer receiver.Close()
+
+	status, err := sendWebhook(webhookClient, receiver.URL, "whsec_test", WebhookDelivery{ID: 1, Event: EventPing, Payload: "{}"}, time.Now())
+	if status != http.StatusUnauthorized {
+		t.Errorf("status = %d", status)
+	}
+	if err == nil || !strings.Contains(err.Error(), "HTTP 401") || !strings.Contains(err.Error(), "bad signature") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestRecordAttempt(t *testing.T) {
+	useFixtureDB(t)
+
+	recordAttempt(WebhookDelivery{ID: 3, Attempts: 0}, http.StatusOK, time.Second, nil, false)
+	execs := takeFixtureExecs()
+	if len(execs) != 1 || !strings.Contains(execs[0].Query, "'delivered'") {
+		t.Fatalf("delivered: %+v", execs)
+	}
+
+	recordAttempt(WebhookDelivery{ID: 3, Attempts: 0}, http.StatusBadGateway, time.Second, errors.New("HTTP 502"), false)
+	execs = takeFixtureExecs()
+	if len(execs) != 1 || execs[0].Args[0] != DeliveryPending || execs[0].Args[1] != int64(1) {
+		t.Fatalf("retried: %+v", execs)
+	}
+
+	recordAttempt(WebhookDelivery{ID: 3, Attempts: webhookMaxAttempts - 1}, 0, time.Second, errors.New("timeout"), false)
+	execs = takeFixtureExecs()
+	if len(execs) != 1 || execs[0].Args[0] != DeliveryFailed || execs[0].Args[3] != nil {
+		t.Fatalf("failed: %+v", execs)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	want := []time.Duration{
+		time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 32 * time.Minute,
+		64 * time.Minute, 128 * time.Minute, 256 * time.Minute, 6 * time.Hour, 6 * time.Hour,
+	}
+	for i, w := range want {
+		if got := webhookBackoff(i + 1); got != w {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+	if got := webhookBackoff(100); got != webhookMaxDelay {
+		t.Errorf("webhookBackoff(100) = %v", got)
+	}
+}
+
+func TestPublicWebhookClientRefusesLoopback(t *testing.T) {
+	var reached bool
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+	}))
+	defer receiver.Close()
+
+	if !strings.Contains(receiver.URL, "127.0.0.1") {
+		t.Skip("the test server isn't on 127.0.0.1:", receiver.URL)
+	}
+	_, err := sendWebhook(publicWebhookClient, receiver.URL, "whsec_test", WebhookDelivery{ID: 1, Event: EventPing, Payload: "{}"}, time.Now())
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("err = %v, want %v", err, errPrivateAddress)
+	}
+	if reached {
+		t.Error("the request reached the loopback receiver")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +21,11 @@ var db *sql.DB
 var templates *template.Template
 
 func main() {
+	// wp-manager sync DIR: the sync client, it only needs the HTTP API (see sync.go)
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		os.Exit(runSync(os.Args[2:]))
+	}
+
 	var err error
 	var dsn string
 
@@ -49,6 +55,25 @@ func main() {
 
 	log.Println("Connected to db >.<")
 
+	// storage quotas by role, e.g. QUOTA_USER_BYTES=2GB, 0 is unlimited
+	user, admin, err := quotasFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	handlers.SetDefaultQuotas(user, admin)
+
+	// the public address of the site, for the absolute links of the feeds,
+	// e.g. SITE_URL=https://wallpapers.example.com (the request's host otherwise)
+	if siteURL := os.Getenv("SITE_URL"); siteURL != "" {
+		u, err := url.Parse(siteURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Fatalf("SITE_URL: expected http(s)://host, got %q", siteURL)
+		}
+		handlers.SetSiteURL(siteURL)
+	} else {
+		log.Println("SITE_URL is not set, the feeds link to the host of each request and are not cached publicly")
+	}
+
 	if err := initDatabase(); err != nil {
 		log.Fatal(err)
 	}
@@ -59,6 +84,7 @@ func main() {
 			Funcs(template.FuncMap{
 				"add":        func(a, b int) int { return a + b },
 				"pathEscape": url.PathEscape,
+				"join":       strings.Join,
 			}).
 			ParseGlob("web/html/*.html"),
 	)
@@ -67,9 +93,25 @@ func main() {
 	handlers.SetDB(db)
 	handlers.SetTemplates(templates)
 
+	if err := handlers.SyncBadgeCatalogue(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Register routes
 	registerRoutes()
 
+	// publish_at / unpublish_at
+	handlers.StartScheduler(30 * time.Second)
+
+	// removes the wallpapers left in the trash past the retention
+	handlers.StartTrashPurger(time.Hour)
+
+	// removes the resumable uploads abandoned past their expiration
+	handlers.StartTusExpirer(time.Hour)
+
+	// sends the queued webhook deliveries and retries the failed ones
+	handlers.StartWebhookWorker(15 * time.Second)
+
 	// Static files
 	http.Handle("/css/", http.StripPrefix("/css/", http.FileServer(http.Dir("web/css"))))
 	http.Handle("/scripts/", http.StripPrefix("/scripts/", http.FileServer(http.Dir("web/scripts"))))
@@ -83,6 +125,32 @@ func main() {
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
+// quotasFromEnv reads QUOTA_USER_WALLPAPERS, QUOTA_USER_BYTES, QUOTA_ADMIN_WALLPAPERS and
+// QUOTA_ADMIN_BYTES, the unset ones keep their default (see handlers.DefaultQuotas)
+func quotasFromEnv() (user, admin handlers.StorageQuota, err error) {
+	user, admin = handlers.DefaultQuotas()
+	for _, q := range []struct {
+		prefix string
+		quota  *handlers.StorageQuota
+	}{{"QUOTA_USER", &user}, {"QUOTA_ADMIN", &admin}} {
+		if v := os.Getenv(q.prefix + "_WALLPAPERS"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return user, admin, fmt.Errorf("%s_WALLPAPERS: invalid number %q", q.prefix, v)
+			}
+			q.quota.MaxWallpapers = n
+		}
+		if v := os.Getenv(q.prefix + "_BYTES"); v != "" {
+			n, err := handlers.ParseBytes(v)
+			if err != nil {
+				return user, admin, fmt.Errorf("%s_BYTES: %w", q.prefix, err)
+			}
+			q.quota.MaxBytes = n
+		}
+	}
+	return user, admin, nil
+}
+
 // Convert Scalingo DSN
 func parseScalingoDSN(dbURL string) string {
 	dbURL = strings.TrimPrefix(dbURL, "mysql://")
@@ -134,11 +202,38 @@ func initDatabase() error {
 	}
 
 	//// comment all drops if /uploads are not deleted when container boot..
-//drop comments
+//drop notifications
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS notifications;`)
+	log.Println(err)
+	//drop favorites
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS favorites;`)
+	log.Println(err)
+	//drop collections
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS collection_items;`)
+	log.Println(err)
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS collections;`)
+	log.Println(err)
+	//drop wallpaper tags (the tags themselves are kept)
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS wallpaper_tags;`)
+	log.Println(err)
+	//drop wallpaper shares
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS wallpaper_shares;`)
+	log.Println(err)
+	//drop moderation history
+	_, err = db.Exec(`
+		DROP TABLE IF EXISTS wallpaper_transitions;`)
+	log.Println(err)
+	//drop comments
 	_, err = db.Exec(`
 		DROP TABLE IF EXISTS comments;`)
 	log.Println(err)
-//drop wallpapers
+	//drop wallpapers
 	_, err = db.Exec(`
 		DROP TABLE IF EXISTS wallpapers;`)
 	log.Println(err)
@@ -151,27 +246,71 @@ func initDatabase() error {
 			user_id INT NOT NULL,
 			filename VARCHAR(255) NOT NULL,
 			original_name VARCHAR(255) NOT NULL,
+			description TEXT NULL,
 			file_path VARCHAR(500) NOT NULL,
+			width INT NOT NULL DEFAULT 0,
+			height INT NOT NULL DEFAULT 0,
+			dominant_color CHAR(7) NULL,
+			color_name VARCHAR(16) NULL,
+			sha256 CHAR(64) NULL,
+			size_bytes BIGINT NOT NULL DEFAULT 0,
 			uploaded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-			toreview bool NOT NULL DEFAULT false,
-		    ispublic bool NOT NULL DEFAULT false,
-			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+			status ENUM('private', 'pending', 'approved', 'rejected', 'scheduled', 'unpublished') NOT NULL DEFAULT 'private',
+			rejection_reason VARCHAR(500) NULL,
+			share_mode ENUM('none', 'friends', 'selected') NOT NULL DEFAULT 'none',
+			published_at TIMESTAMP NULL,
+			publish_at TIMESTAMP NULL,
+			unpublish_at TIMESTAMP NULL,
+			archived_at TIMESTAMP NULL,
+			deleted_at TIMESTAMP NULL,
+			deleted_by INT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL,
+			INDEX idx_published (published_at, id),
+			INDEX idx_user_uploaded (user_id, uploaded_at, id),
+			INDEX idx_status_uploaded (status, uploaded_at, id),
+			INDEX idx_status_publish_at (status, publish_at),
+			INDEX idx_status_unpublish_at (status, unpublish_at),
+			INDEX idx_deleted (deleted_at),
+			INDEX idx_color (color_name),
+			FULLTEXT INDEX ft_search (original_name, description)
 		);
 	`)
 	if err != nil {
 		return fmt.Errorf("wallpapers table: %w", err)
 	}
 
+	// table wallpaper_transitions, the moderation history
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS wallpaper_transitions (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			wallpaper_id INT NOT NULL,
+			actor_id INT NULL,
+			from_status VARCHAR(16) NOT NULL,
+			to_status VARCHAR(16) NOT NULL,
+			reason VARCHAR(500) NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE,
+			FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+			INDEX idx_wallpaper_created (wallpaper_id, created_at)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("wallpaper_transitions table: %w", err)
+	}
+
 	// table comments
 	_, err = db.Exec(`
 		CREATE TABLE IF NOT EXISTS comments (
 			id INT AUTO_INCREMENT PRIMARY KEY,
 			wallpaper_id INT NOT NULL,
 			user_id INT NOT NULL,
+			parent_id INT NULL,
 			text TEXT NOT NULL,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE,
 			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE CASCADE,
 			INDEX idx_wallpaper (wallpaper_id),
 			INDEX idx_created (created_at)
 		)
@@ -180,6 +319,329 @@ func initDatabase() error {
 		return fmt.Errorf("comments table: %w", err)
 	}
 
+	// table favorites
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS favorites (
+			user_id INT NOT NULL,
+			wallpaper_id INT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, wallpaper_id),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("favorites table: %w", err)
+	}
+
+	// table notifications
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS notifications (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			actor_id INT NULL,
+			wallpaper_id INT NULL,
+			type VARCHAR(32) NOT NULL,
+			message VARCHAR(255) NOT NULL,
+			is_read bool NOT NULL DEFAULT false,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE,
+			INDEX idx_user_read (user_id, is_read),
+			INDEX idx_user_created (user_id, created_at)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("notifications table: %w", err)
+	}
+
+	// table notification_preferences (no row = enabled)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS notification_preferences (
+			user_id INT NOT NULL,
+			type VARCHAR(32) NOT NULL,
+			enabled bool NOT NULL DEFAULT true,
+			PRIMARY KEY (user_id, type),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("notification_preferences table: %w", err)
+	}
+
+	// table collections
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS collections (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			description TEXT,
+			cover_wallpaper_id INT NULL,
+			visibility ENUM('private', 'unlisted', 'public') NOT NULL DEFAULT 'private',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (cover_wallpaper_id) REFERENCES wallpapers(id) ON DELETE SET NULL,
+			INDEX idx_visibility (visibility, updated_at)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("collections table: %w", err)
+	}
+
+	// table collection_items, a wallpaper can be in many collections
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS collection_items (
+			collection_id INT NOT NULL,
+			wallpaper_id INT NOT NULL,
+			position INT NOT NULL DEFAULT 0,
+			added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (collection_id, wallpaper_id),
+			FOREIGN KEY (collection_id) REFERENCES collections(id) ON DELETE CASCADE,
+			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE,
+			INDEX idx_position (collection_id, position)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("collection_items table: %w", err)
+	}
+
+	// table audit_log, append-only record of the privileged actions, kept across restarts
+	// actor_name is a copy so the entries stay readable once the actor is deleted
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			actor_id INT NULL,
+			actor_name VARCHAR(50) NOT NULL,
+			action VARCHAR(32) NOT NULL,
+			target_type VARCHAR(16) NOT NULL,
+			target_id VARCHAR(64) NOT NULL,
+			before_state JSON NULL,
+			after_state JSON NULL,
+			ip VARCHAR(45) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+			INDEX idx_created (created_at, id),
+			INDEX idx_actor_created (actor_name, created_at),
+			INDEX idx_action_created (action, created_at),
+			INDEX idx_target (target_type, target_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("audit_log table: %w", err)
+	}
+
+	// table tags, names are normalized (see handlers.normalizeTag)
+	// binary collation so "anime" and "animé" stay two tags, linked with alias_of
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tags (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(50) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL UNIQUE,
+			alias_of INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (alias_of) REFERENCES tags(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("tags table: %w", err)
+	}
+
+	// table wallpaper_tags, always points to the canonical tag, never to an alias
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS wallpaper_tags (
+			wallpaper_id INT NOT NULL,
+			tag_id INT NOT NULL,
+			PRIMARY KEY (wallpaper_id, tag_id),
+			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE,
+			INDEX idx_tag (tag_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("wallpaper_tags table: %w", err)
+	}
+
+	// table friendships, one row per request (requester -> addressee)
+	// a block replaces any row between the two users with requester = blocker
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS friendships (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			requester_id INT NOT NULL,
+			addressee_id INT NOT NULL,
+			status ENUM('pending', 'accepted', 'declined', 'blocked') NOT NULL DEFAULT 'pending',
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+			UNIQUE KEY uniq_pair (requester_id, addressee_id),
+			FOREIGN KEY (requester_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (addressee_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_addressee (addressee_id, status)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("friendships table: %w", err)
+	}
+
+	// table wallpaper_shares, friends a "selected" wallpaper is shared with
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS wallpaper_shares (
+			wallpaper_id INT NOT NULL,
+			user_id INT NOT NULL,
+			PRIMARY KEY (wallpaper_id, user_id),
+			FOREIGN KEY (wallpaper_id) REFERENCES wallpapers(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("wallpaper_shares table: %w", err)
+	}
+
+	// table follows
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS follows (
+			follower_id INT NOT NULL,
+			followee_id INT NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (follower_id, followee_id),
+			FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_followee (followee_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("follows table: %w", err)
+	}
+
+	// table badges, the catalogue (synced from the code on startup)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS badges (
+			code VARCHAR(32) PRIMARY KEY,
+			name VARCHAR(100) NOT NULL,
+			description VARCHAR(255) NOT NULL,
+			icon VARCHAR(16) NOT NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("badges table: %w", err)
+	}
+
+	// table user_badges, granted_by is NULL when awarded by the rules
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS user_badges (
+			user_id INT NOT NULL,
+			badge_code VARCHAR(32) NOT NULL,
+			awarded_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			granted_by INT NULL,
+			PRIMARY KEY (user_id, badge_code),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (badge_code) REFERENCES badges(code) ON DELETE CASCADE,
+			FOREIGN KEY (granted_by) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("user_badges table: %w", err)
+	}
+
+	// table webhooks, kept across restarts like the users they belong to
+	// events is a comma separated list (see handlers.WebhookEvents)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			url VARCHAR(500) NOT NULL,
+			secret VARCHAR(100) NOT NULL,
+			events VARCHAR(255) NOT NULL,
+			scope ENUM('user', 'admin') NOT NULL DEFAULT 'user',
+			active bool NOT NULL DEFAULT true,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_scope_user (scope, user_id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("webhooks table: %w", err)
+	}
+
+	// table webhook_deliveries, the queue and the log of the webhooks
+	// the payload is kept as sent, the signature is computed over these bytes
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			webhook_id INT NOT NULL,
+			event_id CHAR(36) NOT NULL,
+			event VARCHAR(32) NOT NULL,
+			payload MEDIUMTEXT NOT NULL,
+			state ENUM('pending', 'delivered', 'failed') NOT NULL DEFAULT 'pending',
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP NOT NULL,
+			last_status INT NULL,
+			last_error VARCHAR(255) NULL,
+			duration_ms INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			delivered_at TIMESTAMP NULL,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE,
+			INDEX idx_due (state, next_attempt_at),
+			INDEX idx_webhook_created (webhook_id, created_at, id)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("webhook_deliveries table: %w", err)
+	}
+
+	// table api_tokens, personal tokens for the scripts and wpctl, only their hash is kept
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS api_tokens (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			user_id INT NOT NULL,
+			name VARCHAR(100) NOT NULL,
+			token_hash CHAR(64) NOT NULL UNIQUE,
+			hint VARCHAR(16) NOT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			last_used_at TIMESTAMP NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("api_tokens table: %w", err)
+	}
+
+	// table tus_uploads, the resumable uploads in progress (the bytes are in web/tus)
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS tus_uploads (
+			id CHAR(32) PRIMARY KEY,
+			user_id INT NOT NULL,
+			length BIGINT NOT NULL,
+			upload_offset BIGINT NOT NULL DEFAULT 0,
+			filename VARCHAR(255) NOT NULL,
+			description TEXT NOT NULL,
+			tags VARCHAR(2000) NOT NULL DEFAULT '',
+			wallpaper_id INT NULL,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			expires_at TIMESTAMP NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			INDEX idx_expires (expires_at)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("tus_uploads table: %w", err)
+	}
+
+	// table storage_limits, the quotas raised (or lowered) by an admin, NULL keeps the role's
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS storage_limits (
+			user_id INT PRIMARY KEY,
+			max_wallpapers INT NULL,
+			max_bytes BIGINT NULL,
+			updated_by INT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+			FOREIGN KEY (updated_by) REFERENCES users(id) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("storage_limits table: %w", err)
+	}
+
 	log.Println("Database tables initialized~")
 	return nil
 }
@@ -199,18 +661,81 @@ func registerRoutes() {
 	http.HandleFunc("/admin/promote", handlers.PromoteUserHandler)
 	http.HandleFunc("/admin/demote", handlers.DemoteUserHandler)
 	http.HandleFunc("/admin/deleteacc", handlers.DeleteAccHandler)
+	http.HandleFunc("/admin/badges/grant", handlers.GrantBadgeHandler)
+	http.HandleFunc("/admin/badges/revoke", handlers.RevokeBadgeHandler)
+	http.HandleFunc("/admin/tags/merge", handlers.MergeTagsHandler)
+	http.HandleFunc("/admin/tags/delete", handlers.DeleteTagHandler)
+	http.HandleFunc("/admin/audit", handlers.AuditHandler)
+	http.HandleFunc("/admin/audit.csv", handlers.AuditExportHandler)
 	http.HandleFunc("/forgot-password", handlers.ForgotpasswordHandler)
 	http.HandleFunc("/publish", handlers.PublishHandler)
 	http.HandleFunc("/toreview", handlers.ReviewHandler)
 	http.HandleFunc("/denypublish", handlers.DenyHandler)
 	http.HandleFunc("/unpublish", handlers.UnpublishHandler)
+	http.HandleFunc("/history", handlers.HistoryHandler)
+	http.HandleFunc("/schedule", handlers.ScheduleHandler)
 	http.HandleFunc("/deletewp", handlers.DeletewpHandler)
+	http.HandleFunc("/archive", handlers.ArchiveHandler)
+	http.HandleFunc("/trash", handlers.TrashHandler)
+	http.HandleFunc("/trash/restore", handlers.RestoreHandler)
+	http.HandleFunc("/trash/purge", handlers.PurgeHandler)
+	http.HandleFunc("/admin/trash", handlers.AdminTrashHandler)
+	http.HandleFunc("/admin/storage", handlers.AdminStorageHandler)
+	http.HandleFunc("/admin/storage/limit", handlers.StorageLimitHandler)
 	http.HandleFunc("/addfavorite", handlers.AddfavoriteHandler)
 	http.HandleFunc("/rate", handlers.RateHandler)
+	http.HandleFunc("/notifications", handlers.NotificationsHandler)
+	http.HandleFunc("/friends", handlers.FriendsHandler)
+	http.HandleFunc("/friends/request", handlers.FriendRequestHandler)
+	http.HandleFunc("/friends/accept", handlers.AcceptFriendHandler)
+	http.HandleFunc("/friends/decline", handlers.DeclineFriendHandler)
+	http.HandleFunc("/friends/remove", handlers.RemoveFriendHandler)
+	http.HandleFunc("/friends/block", handlers.BlockUserHandler)
+	http.HandleFunc("/friends/unblock", handlers.UnblockUserHandler)
+	http.HandleFunc("/share", handlers.ShareHandler)
+	http.HandleFunc("/follow", handlers.FollowHandler)
+	http.HandleFunc("/unfollow", handlers.UnfollowHandler)
+	http.HandleFunc("/u/", handlers.UserProfileHandler)
+	http.HandleFunc("/feed", handlers.FeedHandler)
+	http.HandleFunc("/collections", handlers.CollectionsHandler)
+	http.HandleFunc("/collections/add", handlers.AddToCollectionHandler)
+	http.HandleFunc("/collections/", handlers.CollectionPageHandler)
+	http.HandleFunc("/edittags", handlers.EditTagsHandler)
+	http.HandleFunc("/describe", handlers.DescribeHandler)
+	http.HandleFunc("/search", handlers.SearchHandler)
+	http.HandleFunc("/tags", handlers.TagsHandler)
+	http.HandleFunc("/tags/", handlers.TagPageHandler)
+	http.HandleFunc("/feeds/", handlers.FeedsHandler)
+	http.HandleFunc("/webhooks", handlers.WebhooksHandler)
+	http.HandleFunc("/webhooks/delete", handlers.DeleteWebhookHandler)
+	http.HandleFunc("/webhooks/toggle", handlers.ToggleWebhookHandler)
+	http.HandleFunc("/webhooks/ping", handlers.PingWebhookHandler)
+	http.HandleFunc("/webhooks/deliveries", handlers.WebhookDeliveriesHandler)
+	http.HandleFunc("/webhooks/redeliver", handlers.RedeliverWebhookHandler)
+	http.HandleFunc("/tokens", handlers.TokensHandler)
+	http.HandleFunc("/tokens/revoke", handlers.RevokeTokenHandler)
 
 	// API routes
 	http.HandleFunc("/api/comments/", handlers.GetCommentsHandler)
 	http.HandleFunc("/api/comments", handlers.PostCommentHandler)
-
-	http.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir("web/uploads"))))
+	http.HandleFunc("/api/notifications", handlers.GetNotificationsHandler)
+	http.HandleFunc("/api/notifications/read", handlers.MarkNotificationsReadHandler)
+	http.HandleFunc("/api/notifications/preferences", handlers.NotificationPreferencesHandler)
+	http.HandleFunc("/api/events", handlers.EventsHandler)
+	http.HandleFunc("/api/collections", handlers.CollectionsAPIHandler)
+	http.HandleFunc("/api/collections/", handlers.CollectionsAPIHandler)
+	http.HandleFunc("/api/tags", handlers.TagsAPIHandler)
+	http.HandleFunc("/api/search", handlers.SearchAPIHandler)
+	http.HandleFunc("/api/gallery", handlers.GalleryAPIHandler)
+	http.HandleFunc("/api/admin/bulk", handlers.BulkModerationHandler)
+	http.HandleFunc("/api/v1/wallpapers", handlers.WallpapersAPIHandler)
+	http.HandleFunc("/api/v1/wallpapers/", handlers.WallpapersAPIHandler)
+	http.HandleFunc("/api/v1/random", handlers.RandomAPIHandler)
+	http.HandleFunc("/api/v1/uploads", handlers.TusUploadsHandler)
+	http.HandleFunc("/api/v1/uploads/", handlers.TusUploadsHandler)
+	http.HandleFunc("/api/openapi.json", handlers.OpenAPIHandler)
+	http.HandleFunc("/api/docs", handlers.APIDocsHandler)
+
+	// uploads go through the sharing ACL, not a plain file server
+	http.HandleFunc("/uploads/", handlers.UploadsHandler)
 }
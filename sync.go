@@ -0,0 +1,354 @@
+package main
+
+// `wp-manager sync` mirrors the user's library or the public gallery into a local directory,
+// through the HTTP API like wpctl:
+//
+//	wp-manager sync [--server URL] [--token TOKEN] [--scope mine|public] [--watch 5m] [--verify] [--keep-deleted] DIR
+//
+// What was synced is remembered in DIR/.wp-sync.json, so only the new wallpapers are downloaded
+// and only the files the sync wrote are ever removed. The downloads go to DIR/.wp-sync-partial
+// first and are resumed from there after an interruption, then checked against the sha256 the
+// API returns before they are moved into DIR.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"wp-manager/client"
+	"wp-manager/handlers"
+)
+
+const (
+	syncStateFile  = ".wp-sync.json"
+	syncPartialDir = ".wp-sync-partial"
+)
+
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// syncState is DIR/.wp-sync.json
+type syncState struct {
+	Server string                `json:"server"`
+	Scope  string                `json:"scope"`
+	Files  map[string]syncedFile `json:"files"` // by filename
+}
+
+type syncedFile struct {
+	ID     int    `json:"id"`
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
+}
+
+type syncer struct {
+	client      *client.Client
+	dir         string
+	scope       string
+	verify      bool // re-hash the local files and download again the ones that changed
+	keepDeleted bool
+	state       syncState
+}
+
+// runSync is the sync subcommand, it returns the exit code
+func runSync(args []string) int {
+	flags := flag.NewFlagSet("wp-manager sync", flag.ExitOnError)
+	server := flags.String("server", envOr("WPCTL_SERVER", "http://localhost:8080"), "base URL of WPManager")
+	token := flags.String("token", os.Getenv("WPCTL_TOKEN"), "personal API token, needed for --scope mine")
+	scope := flags.String("scope", handlers.ScopeMine, "mine (your library) or public (the community gallery)")
+	watch := flags.Duration("watch", 0, "keep running and poll for changes at this interval, e.g. 5m")
+	verify := flags.Bool("verify", false, "check the checksums of the files already synced")
+	keepDeleted := flags.Bool("keep-deleted", false, "don't remove the files of the wallpapers gone from the server")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: wp-manager sync [flags] DIR")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	if *scope != handlers.ScopeMine && *scope != handlers.ScopePublic {
+		fmt.Fprintln(os.Stderr, "wp-manager sync: --scope must be mine or public")
+		return 2
+	}
+	if *scope == handlers.ScopeMine && *token == "" {
+		fmt.Fprintln(os.Stderr, "wp-manager sync: your library needs a token (--token or WPCTL_TOKEN), create one on /tokens")
+		return 2
+	}
+	if *watch > 0 && *watch < 10*time.Second {
+		fmt.Fprintln(os.Stderr, "wp-manager sync: --watch can't be less than 10s")
+		return 2
+	}
+
+	s := &syncer{
+		client:      client.New(*server, *token),
+		dir:         flags.Arg(0),
+		scope:       *scope,
+		verify:      *verify,
+		keepDeleted: *keepDeleted,
+	}
+	if err := s.loadState(); err != nil {
+		log.Println("❌ Sync:", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	for {
+		err := s.run(ctx)
+		if ctx.Err() != nil {
+			log.Println("Sync interrupted, it will resume from there")
+			return 1
+		}
+		if *watch == 0 {
+			if err != nil {
+				log.Println("❌ Sync:", err)
+				return 1
+			}
+			return 0
+		}
+		// in watch mode a failed pass is retried at the next poll
+		if err != nil {
+			log.Println("❌ Sync:", err)
+		}
+		select {
+		case <-ctx.Done():
+			return 0
+		case <-time.After(*watch):
+		}
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// loadState reads DIR/.wp-sync.json, a directory synced from another server or scope is refused:
+// the removals would hit the wrong files
+func (s *syncer) loadState() error {
+	if err := os.MkdirAll(filepath.Join(s.dir, syncPartialDir), 0o755); err != nil {
+		return err
+	}
+	s.state = syncState{Server: s.client.BaseURL, Scope: s.scope, Files: map[string]syncedFile{}}
+
+	data, err := os.ReadFile(filepath.Join(s.dir, syncStateFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var saved syncState
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return fmt.Errorf("%s is corrupted: %w", syncStateFile, err)
+	}
+	if saved.Server != s.state.Server || saved.Scope != s.state.Scope {
+		return fmt.Errorf("%s is synced from %s (scope %s), use another directory", s.dir, saved.Server, saved.Scope)
+	}
+	if saved.Files != nil {
+		s.state.Files = saved.Files
+	}
+	return nil
+}
+
+// saveState writes the state through a temporary file, an interruption never leaves half of it
+func (s *syncer) saveState() error {
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, syncStateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, syncStateFile))
+}
+
+// run is one pass: download what is new or changed, then remove what is gone
+func (s *syncer) run(ctx context.Context) error {
+	remote, err := s.client.AllWallpapers(ctx, client.ListOptions{Scope: s.scope})
+	if err != nil {
+		// nothing is removed on a partial listing
+		return fmt.Errorf("listing the wallpapers: %w", err)
+	}
+
+	wanted := make(map[string]handlers.Wallpaper, len(remote))
+	for _, wp := range remote {
+		if !safeSyncName(wp.Filename) {
+			log.Printf("⚠️ Skipping wallpaper %d, unexpected filename %q", wp.ID, wp.Filename)
+			continue
+		}
+		wanted[wp.Filename] = wp
+	}
+
+	downloaded, failed := 0, 0
+	for name, wp := range wanted {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if s.upToDate(name, wp) {
+			continue
+		}
+		size, err := s.download(ctx, wp)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			log.Printf("❌ %s: %v", name, err)
+			failed++
+			continue
+		}
+		s.state.Files[name] = syncedFile{ID: wp.ID, SHA256: wp.SHA256, Size: size}
+		if err := s.saveState(); err != nil {
+			return err
+		}
+		downloaded++
+	}
+
+	removed := 0
+	if !s.keepDeleted {
+		for name := range s.state.Files {
+			if _, ok := wanted[name]; ok {
+				continue
+			}
+			if err := os.Remove(filepath.Join(s.dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("❌ %s: %v", name, err)
+				continue
+			}
+			delete(s.state.Files, name)
+			removed++
+		}
+		if removed > 0 {
+			if err := s.saveState(); err != nil {
+				return err
+			}
+		}
+	}
+
+	log.Printf("🔄 Synced %s: %d wallpapers, %d downloaded, %d removed, %d failed",
+		s.dir, len(wanted), downloaded, removed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d downloads failed", failed)
+	}
+	return nil
+}
+
+// upToDate tells if the local copy of wp needs no download
+func (s *syncer) upToDate(name string, wp handlers.Wallpaper) bool {
+	known, ok := s.state.Files[name]
+	if !ok || known.SHA256 != wp.SHA256 {
+		return false
+	}
+	path := filepath.Join(s.dir, name)
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != known.Size {
+		return false
+	}
+	if s.verify && wp.SHA256 != "" {
+		sum, err := fileSHA256(path)
+		if err != nil || sum != wp.SHA256 {
+			log.Printf("⚠️ %s changed locally, downloading it again", name)
+			return false
+		}
+	}
+	return true
+}
+
+// download fetches wp into the partial directory, resuming what a previous run left there,
+// checks it and moves it into place. It returns the size of the file.
+func (s *syncer) download(ctx context.Context, wp handlers.Wallpaper) (int64, error) {
+	partial := filepath.Join(s.dir, syncPartialDir, wp.Filename)
+	var offset int64
+	if info, err := os.Stat(partial); err == nil {
+		offset = info.Size()
+	}
+
+	body, resumed, err := s.client.DownloadFrom(ctx, wp.Filename, offset)
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusRequestedRangeNotSatisfiable {
+		// the partial file is complete or longer than the file, start over
+		os.Remove(partial)
+		offset = 0
+		body, resumed, err = s.client.DownloadFrom(ctx, wp.Filename, 0)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resumed {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(partial, flags, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.Copy(f, body)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// kept for the next run
+		return 0, err
+	}
+
+	if wp.SHA256 != "" {
+		sum, err := fileSHA256(partial)
+		if err != nil {
+			return 0, err
+		}
+		if sum != wp.SHA256 {
+			os.Remove(partial)
+			return 0, errChecksumMismatch
+		}
+	}
+	info, err := os.Stat(partial)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(partial, filepath.Join(s.dir, wp.Filename)); err != nil {
+		return 0, err
+	}
+	if resumed {
+		log.Printf("⬇️ %s (resumed at %d bytes)", wp.Filename, offset)
+	} else {
+		log.Printf("⬇️ %s", wp.Filename)
+	}
+	return info.Size(), nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// the server names the files itself, anything that could leave DIR or hit the state is refused
+func safeSyncName(name string) bool {
+	return name != "" && filepath.Base(name) == name && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
@@ -0,0 +1,146 @@
+// Renders /api/openapi.json on the API page: the operations grouped by tag, then the schemas.
+document.addEventListener('DOMContentLoaded', async function() {
+    const operations = document.querySelector('.api-operations');
+    const schemas = document.querySelector('.api-schemas');
+
+    let spec;
+    try {
+        const response = await fetch('/api/openapi.json');
+        spec = await response.json();
+    } catch (err) {
+        console.error('Failed to load the OpenAPI document:', err);
+        document.querySelector('.api-title').textContent = 'Failed to load the API description';
+        return;
+    }
+
+    document.querySelector('.api-title').textContent = spec.info.title + ' ' + spec.info.version;
+    document.querySelector('.api-description').textContent = spec.info.description;
+
+    function el(tag, className, text) {
+        const node = document.createElement(tag);
+        if (className) {
+            node.className = className;
+        }
+        if (text !== undefined) {
+            node.textContent = text;
+        }
+        return node;
+    }
+
+    // "#/components/schemas/Wallpaper" -> a link to the schema below
+    function schemaNode(schema) {
+        if (!schema) {
+            return el('code', '', 'none');
+        }
+        if (schema.$ref) {
+            const name = schema.$ref.split('/').pop();
+            const link = el('a', 'api-ref', name);
+            link.href = '#schema-' + name;
+            return link;
+        }
+        if (schema.type === 'array') {
+            const wrap = el('span');
+            wrap.append('[', schemaNode(schema.items), ']');
+            return wrap;
+        }
+        if (schema.type === 'object' && schema.additionalProperties) {
+            const wrap = el('span');
+            wrap.append('{string: ', schemaNode(schema.additionalProperties), '}');
+            return wrap;
+        }
+        if (schema.type === 'object' && schema.properties) {
+            return propertiesTable(schema);
+        }
+        return el('code', '', schema.format ? schema.type + ' (' + schema.format + ')' : schema.type);
+    }
+
+    function propertiesTable(schema) {
+        const table = el('table', 'users-table api-table');
+        const required = schema.required || [];
+        Object.keys(schema.properties).sort().forEach(name => {
+            const row = el('tr');
+            row.append(el('td', '', name + (required.includes(name) ? ' *' : '')));
+            const type = el('td');
+            type.append(schemaNode(schema.properties[name]));
+            row.append(type);
+            table.append(row);
+        });
+        return table;
+    }
+
+    function contentNodes(content) {
+        const nodes = [];
+        Object.keys(content || {}).forEach(media => {
+            const line = el('div', 'api-content');
+            line.append(el('code', 'api-media', media), ' ', schemaNode(content[media].schema));
+            nodes.push(line);
+        });
+        return nodes;
+    }
+
+    // group by tag, in the order of the document
+    const groups = {};
+    Object.keys(spec.paths).sort().forEach(path => {
+        Object.keys(spec.paths[path]).forEach(method => {
+            const op = spec.paths[path][method];
+            const tag = (op.tags || ['other'])[0];
+            (groups[tag] = groups[tag] || []).push({ path, method, op });
+        });
+    });
+
+    Object.keys(groups).sort().forEach(tag => {
+        const section = el('section', 'spell-card');
+        const header = el('div', 'card-header');
+        header.append(el('h3', '', tag));
+        const body = el('div', 'card-body');
+        section.append(header, body);
+
+        groups[tag].forEach(({ path, method, op }) => {
+            const details = el('details', 'api-operation');
+            details.id = op.operationId;
+            const summary = el('summary');
+            summary.append(
+                el('span', 'api-method api-method-' + method, method.toUpperCase()), ' ',
+                el('code', 'api-path', path), ' ', op.summary || '',
+                op.security ? el('span', 'api-auth', ' 🔒') : ''
+            );
+            details.append(summary);
+
+            if (op.parameters) {
+                details.append(el('h4', '', 'Parameters'));
+                const table = el('table', 'users-table api-table');
+                op.parameters.forEach(p => {
+                    const row = el('tr');
+                    row.append(
+                        el('td', '', p.name + (p.required ? ' *' : '')),
+                        el('td', '', p.in),
+                        el('td', '', p.schema.type),
+                        el('td', '', p.description || '')
+                    );
+                    table.append(row);
+                });
+                details.append(table);
+            }
+            if (op.requestBody) {
+                details.append(el('h4', '', 'Request body'), ...contentNodes(op.requestBody.content));
+            }
+
+            details.append(el('h4', '', 'Responses'));
+            Object.keys(op.responses).sort().forEach(status => {
+                const response = op.responses[status];
+                const line = el('div', 'api-response');
+                line.append(el('span', 'api-status api-status-' + status[0], status), ' ', response.description);
+                details.append(line, ...contentNodes(response.content));
+            });
+            body.append(details);
+        });
+        operations.append(section);
+    });
+
+    Object.keys(spec.components.schemas).sort().forEach(name => {
+        const block = el('div', 'api-schema');
+        block.id = 'schema-' + name;
+        block.append(el('h4', '', name), schemaNode(Object.assign({}, spec.components.schemas[name], { $ref: undefined })));
+        schemas.append(block);
+    });
+});
@@ -0,0 +1,195 @@
+// Bulk moderation + keyboard review mode for the review queue of the admin panel.
+// Both go through /api/admin/bulk, which answers with a result per wallpaper.
+document.addEventListener('DOMContentLoaded', function() {
+    const toolbar = document.querySelector('.bulk-toolbar');
+    if (!toolbar) {
+        return;
+    }
+
+    const grid = document.querySelector('.spell-grid[data-gallery="review"]');
+    const results = document.querySelector('.bulk-results');
+    const help = document.querySelector('.bulk-help');
+    const count = toolbar.querySelector('.bulk-count');
+    const selectAll = toolbar.querySelector('.bulk-select-all');
+    let current = -1; // card index in review mode, -1 when off
+
+    function cards() {
+        return Array.from(grid.querySelectorAll('.wallpaper-card'));
+    }
+
+    function selectedIds() {
+        return Array.from(grid.querySelectorAll('.bulk-select:checked')).map(box => parseInt(box.value, 10));
+    }
+
+    function updateCount() {
+        const n = selectedIds().length;
+        count.textContent = n + ' selected';
+        selectAll.checked = n > 0 && n === cards().length;
+    }
+
+    grid.addEventListener('change', function(e) {
+        if (e.target.classList.contains('bulk-select')) {
+            updateCount();
+        }
+    });
+
+    selectAll.addEventListener('change', function() {
+        grid.querySelectorAll('.bulk-select').forEach(box => box.checked = selectAll.checked);
+        updateCount();
+    });
+
+    // new cards from the infinite scroll are not selected
+    document.addEventListener('gallery:page', updateCount);
+
+    async function runBulk(action, ids, extra) {
+        if (ids.length === 0) {
+            showResults(['Select some wallpapers first']);
+            return null;
+        }
+
+        try {
+            const response = await fetch('/api/admin/bulk', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(Object.assign({ action: action, ids: ids }, extra))
+            });
+            const body = await response.json();
+            if (!response.ok) {
+                showResults([body.error || 'HTTP ' + response.status]);
+                return null;
+            }
+
+            const lines = [action + ': ' + body.succeeded + ' done, ' + body.failed + ' failed'];
+            body.results.forEach(result => {
+                if (!result.ok) {
+                    lines.push('#' + result.id + ': ' + result.error);
+                } else if (action !== 'tag') {
+                    // approved, rejected or deleted: it left the queue
+                    const card = grid.querySelector('.wallpaper-card[data-wallpaper-id="' + result.id + '"]');
+                    if (card) {
+                        card.remove();
+                    }
+                }
+            });
+            showResults(lines);
+            updateCount();
+            return body;
+        } catch (err) {
+            console.error('Bulk action failed:', err);
+            showResults(['Bulk action failed, see the console']);
+            return null;
+        }
+    }
+
+    function showResults(lines) {
+        results.innerHTML = '';
+        lines.forEach(line => {
+            const item = document.createElement('li');
+            item.textContent = line;
+            results.appendChild(item);
+        });
+    }
+
+    toolbar.addEventListener('click', function(e) {
+        const button = e.target.closest('[data-bulk-action]');
+        if (!button) {
+            return;
+        }
+
+        const action = button.dataset.bulkAction;
+        const ids = selectedIds();
+        const extra = {};
+        if (action === 'reject') {
+            extra.reason = toolbar.querySelector('.bulk-reason').value.trim();
+            if (!extra.reason) {
+                showResults(['A reason is required to reject']);
+                return;
+            }
+        } else if (action === 'tag') {
+            extra.tags = toolbar.querySelector('.bulk-tags').value;
+        } else if (action === 'delete' && !confirm('Move ' + ids.length + ' wallpaper(s) to the trash?')) {
+            return;
+        }
+        runBulk(action, ids, extra);
+    });
+
+    // ───── keyboard review mode ─────
+
+    function focusCard(index) {
+        const all = cards();
+        grid.querySelectorAll('.review-current').forEach(card => card.classList.remove('review-current'));
+        if (all.length === 0) {
+            showResults(['The queue is empty ✨']);
+            return;
+        }
+        current = Math.max(0, Math.min(index, all.length - 1));
+        all[current].classList.add('review-current');
+        all[current].scrollIntoView({ block: 'center', behavior: 'smooth' });
+    }
+
+    function toggleReviewMode(on) {
+        document.body.classList.toggle('review-mode', on);
+        help.hidden = !on;
+        if (on) {
+            focusCard(current < 0 ? 0 : current);
+        } else {
+            grid.querySelectorAll('.review-current').forEach(card => card.classList.remove('review-current'));
+            current = -1;
+        }
+    }
+
+    toolbar.querySelector('.review-mode-button').addEventListener('click', function() {
+        toggleReviewMode(current < 0);
+    });
+
+    async function decideCurrent(action, extra) {
+        const card = cards()[current];
+        if (!card) {
+            return;
+        }
+        await runBulk(action, [parseInt(card.dataset.wallpaperId, 10)], extra);
+        // the card is gone, the next one takes its index
+        focusCard(current);
+    }
+
+    document.addEventListener('keydown', function(e) {
+        if (current < 0 || e.ctrlKey || e.metaKey || e.altKey || e.target.closest('input, textarea, select')) {
+            return;
+        }
+
+        switch (e.key) {
+        case 'j':
+        case 'ArrowRight':
+            focusCard(current + 1);
+            break;
+        case 'k':
+        case 'ArrowLeft':
+            focusCard(current - 1);
+            break;
+        case 'a':
+            decideCurrent('approve', {});
+            break;
+        case 'r': {
+            const reason = prompt('Why can\'t it be published? The uploader will see this.');
+            if (reason && reason.trim()) {
+                decideCurrent('reject', { reason: reason.trim() });
+            }
+            break;
+        }
+        case 'x': {
+            const box = cards()[current] && cards()[current].querySelector('.bulk-select');
+            if (box) {
+                box.checked = !box.checked;
+                updateCount();
+            }
+            break;
+        }
+        case 'Escape':
+            toggleReviewMode(false);
+            break;
+        default:
+            return;
+        }
+        e.preventDefault();
+    });
+});
@@ -0,0 +1,116 @@
+// Owner controls of a collection page: drag reorder, cover, remove, settings
+const collectionId = document.getElementById('collection').dataset.collectionId;
+
+document.addEventListener('DOMContentLoaded', function() {
+    const grid = document.getElementById('collectionItems');
+    if (!grid) {
+        return;
+    }
+
+    let dragged = null;
+
+    grid.addEventListener('dragstart', function(e) {
+        dragged = e.target.closest('.wallpaper-card');
+        if (!dragged) {
+            return;
+        }
+        dragged.classList.add('dragging');
+        e.dataTransfer.effectAllowed = 'move';
+    });
+
+    grid.addEventListener('dragover', function(e) {
+        e.preventDefault();
+        const target = e.target.closest('.wallpaper-card');
+        if (!dragged || !target || target === dragged) {
+            return;
+        }
+
+        // drop before or after the hovered card depending on the pointer position
+        const rect = target.getBoundingClientRect();
+        const after = e.clientX > rect.left + rect.width / 2;
+        grid.insertBefore(dragged, after ? target.nextSibling : target);
+    });
+
+    grid.addEventListener('dragend', function() {
+        if (!dragged) {
+            return;
+        }
+        dragged.classList.remove('dragging');
+        dragged = null;
+        saveOrder();
+    });
+});
+
+async function collectionRequest(method, path, body) {
+    const response = await fetch('/api/collections/' + collectionId + path, {
+        method: method,
+        headers: { 'Content-Type': 'application/json' },
+        body: body ? JSON.stringify(body) : undefined
+    });
+    if (!response.ok) {
+        const data = await response.json().catch(() => ({}));
+        throw new Error(data.error || 'Request failed');
+    }
+    return response;
+}
+
+async function saveOrder() {
+    const ids = Array.from(document.querySelectorAll('#collectionItems .wallpaper-card'))
+        .map(card => parseInt(card.dataset.wallpaperId, 10));
+    try {
+        await collectionRequest('PUT', '/order', { wallpaper_ids: ids });
+    } catch (err) {
+        alert('Failed to save the order: ' + err.message);
+    }
+}
+
+async function setCover(wallpaperId) {
+    try {
+        await collectionRequest('PATCH', '', { cover_wallpaper_id: wallpaperId });
+        window.location.reload();
+    } catch (err) {
+        alert(err.message);
+    }
+}
+
+async function removeItem(wallpaperId) {
+    if (!confirm('Remove this wallpaper from the collection?')) {
+        return;
+    }
+    try {
+        await collectionRequest('DELETE', '/items/' + wallpaperId);
+        document.querySelector('#collectionItems .wallpaper-card[data-wallpaper-id="' + wallpaperId + '"]').remove();
+    } catch (err) {
+        alert(err.message);
+    }
+}
+
+async function saveCollection(e) {
+    e.preventDefault();
+    const form = e.target;
+    const error = document.getElementById('collectionError');
+    error.textContent = '';
+
+    try {
+        await collectionRequest('PATCH', '', {
+            name: form.name.value,
+            description: form.description.value,
+            visibility: form.visibility.value
+        });
+        window.location.reload();
+    } catch (err) {
+        error.textContent = err.message;
+    }
+}
+
+async function deleteCollection() {
+    if (!confirm('Delete this collection? The wallpapers themselves are kept.')) {
+        return;
+    }
+    try {
+        await collectionRequest('DELETE', '');
+        window.location.href = '/collections';
+    } catch (err) {
+        alert(err.message);
+    }
+}
@@ -0,0 +1,102 @@
+// Infinite scroll for the galleries (.spell-grid[data-gallery]).
+// The "Older wallpapers" link stays as the no-JS fallback. The number of pages
+// loaded is remembered on submit so scrollsave.js can restore the position
+// after the reload (window.galleryRestored).
+const galleryPagesKey = 'galleryPages:' + location.pathname;
+
+document.addEventListener('DOMContentLoaded', function() {
+    const grid = document.querySelector('.spell-grid[data-gallery]');
+    if (!grid) {
+        return;
+    }
+
+    const more = grid.parentElement.querySelector('.gallery-more');
+    let nextCursor = grid.dataset.nextCursor;
+    let pagesLoaded = 0;
+    let loading = null;
+
+    function loadNextPage() {
+        if (!nextCursor) {
+            return Promise.resolve();
+        }
+        if (loading) {
+            return loading;
+        }
+
+        const url = '/api/gallery?view=' + encodeURIComponent(grid.dataset.gallery) +
+            '&cursor=' + encodeURIComponent(nextCursor);
+        loading = fetch(url)
+            .then(response => {
+                if (!response.ok) {
+                    throw new Error('HTTP ' + response.status);
+                }
+                return response.json();
+            })
+            .then(page => {
+                const template = document.createElement('template');
+                template.innerHTML = page.html;
+                const cards = Array.from(template.content.querySelectorAll('.wallpaper-card'));
+                grid.appendChild(template.content);
+                document.dispatchEvent(new CustomEvent('gallery:page', { detail: { cards: cards } }));
+
+                nextCursor = page.next_cursor || '';
+                pagesLoaded++;
+                if (more && nextCursor) {
+                    const link = more.querySelector('a');
+                    const href = new URL(link.href);
+                    href.searchParams.set('cursor', nextCursor);
+                    link.href = href;
+                } else if (more) {
+                    more.remove();
+                }
+            })
+            .catch(err => {
+                console.error('Failed to load the next page:', err);
+                nextCursor = ''; // keep the fallback link
+            })
+            .finally(() => loading = null);
+        return loading;
+    }
+
+    document.addEventListener('submit', function() {
+        sessionStorage.setItem(galleryPagesKey, pagesLoaded);
+    });
+
+    // reload as many pages as before the submit, then let scrollsave.js restore the position
+    const saved = parseInt(sessionStorage.getItem(galleryPagesKey), 10) || 0;
+    sessionStorage.removeItem(galleryPagesKey);
+    window.galleryRestored = (async () => {
+        for (let i = 0; i < saved && nextCursor; i++) {
+            await loadNextPage();
+        }
+    })();
+
+    if (!more || !window.IntersectionObserver) {
+        return;
+    }
+    more.hidden = true;
+    const sentinel = document.createElement('div');
+    sentinel.className = 'gallery-sentinel';
+    grid.insertAdjacentElement('afterend', sentinel);
+
+    const observer = new IntersectionObserver(entries => {
+        if (!entries[0].isIntersecting) {
+            return;
+        }
+        window.galleryRestored.then(loadNextPage).then(() => {
+            if (nextCursor) {
+                // observe again, in case the sentinel is still on screen
+                observer.unobserve(sentinel);
+                observer.observe(sentinel);
+            } else {
+                observer.disconnect();
+                sentinel.remove();
+                if (more && more.isConnected) {
+                    // a failed fetch leaves the link as the way to the next page
+                    more.hidden = false;
+                }
+            }
+        });
+    }, { rootMargin: '600px' });
+    observer.observe(sentinel);
+});
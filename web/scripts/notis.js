@@ -1,6 +1,9 @@
 document.addEventListener('DOMContentLoaded', function() {
     const notificationBell = document.getElementById('notificationBell');
     const notificationDropdown = document.getElementById('notificationDropdown');
+    if (!notificationBell || !notificationDropdown) {
+        return;
+    }
 
     // dropdown
     notificationBell.addEventListener('click', function(e) {
@@ -18,12 +21,156 @@ document.addEventListener('DOMContentLoaded', function() {
     // Mark all as read
     const markAllReadBtn = document.querySelector('.mark-all-read');
     if (markAllReadBtn) {
-        markAllReadBtn.addEventListener('click', function(e) {
+        markAllReadBtn.addEventListener('click', async function(e) {
             e.stopPropagation();
-            document.querySelectorAll('.notification-item.unread').forEach(item => {
+            await markNotificationsRead({ all: true });
+        });
+    }
+
+    // Mark one as read when clicked
+    document.querySelector('.notification-list').addEventListener('click', function(e) {
+        const item = e.target.closest('.notification-item.unread');
+        if (item) {
+            markNotificationsRead({ ids: [parseInt(item.dataset.notificationId, 10)] });
+        }
+    });
+
+    loadNotifications();
+    openNotificationStream();
+});
+
+// Live notifications over Server-Sent Events
+function openNotificationStream() {
+    if (!window.EventSource) {
+        return;
+    }
+
+    const stream = new EventSource('/api/events');
+    stream.addEventListener('notification', function(e) {
+        const notification = JSON.parse(e.data);
+        const list = document.querySelector('.notification-list');
+
+        // drop the "Nothing new" placeholder
+        list.querySelectorAll('.notification-item:not([data-notification-id])').forEach(item => item.remove());
+        list.insertAdjacentHTML('afterbegin', createNotificationHTML(notification));
+
+        const badge = document.getElementById('notificationCount');
+        setUnreadCount((parseInt(badge.textContent, 10) || 0) + 1);
+    });
+    stream.onerror = function() {
+        // 400 when logged out: stop retrying
+        if (stream.readyState === EventSource.CLOSED) {
+            stream.close();
+        }
+    };
+}
+
+// Load the latest notifications from server
+async function loadNotifications() {
+    const list = document.querySelector('.notification-list');
+
+    try {
+        const response = await fetch('/api/notifications?limit=10');
+        if (response.status === 401) {
+            // not logged in, hide the bell
+            document.querySelector('.notification-container').style.display = 'none';
+            return;
+        }
+        if (!response.ok) {
+            throw new Error('Failed to load notifications');
+        }
+
+        const data = await response.json();
+        setUnreadCount(data.unread_count);
+
+        if (data.notifications.length > 0) {
+            list.innerHTML = data.notifications.map(n => createNotificationHTML(n)).join('');
+        } else {
+            list.innerHTML = `
+                <div class="notification-item">
+                    <div class="notification-content">
+                        <p class="notification-text">Nothing new ✨</p>
+                    </div>
+                </div>
+            `;
+        }
+    } catch (error) {
+        console.error('Error loading notifications:', error);
+    }
+}
+
+// Mark notifications as read on the server, then update the UI
+async function markNotificationsRead(body) {
+    try {
+        const response = await fetch('/api/notifications/read', {
+            method: 'POST',
+            headers: {
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify(body)
+        });
+        if (!response.ok) {
+            throw new Error('Failed to mark notifications as read');
+        }
+
+        const data = await response.json();
+        document.querySelectorAll('.notification-item.unread').forEach(item => {
+            if (body.all || body.ids.includes(parseInt(item.dataset.notificationId, 10))) {
                 item.classList.remove('unread');
-            });
-            document.getElementById('notificationCount').textContent = '0';
+            }
         });
+        setUnreadCount(data.unread_count);
+    } catch (error) {
+        console.error('Error marking notifications:', error);
+    }
+}
+
+function setUnreadCount(count) {
+    const badge = document.getElementById('notificationCount');
+    badge.textContent = count;
+    badge.style.display = count > 0 ? '' : 'none';
+}
+
+// Create HTML for a single notification
+function createNotificationHTML(notification) {
+    const time = getNotificationTimeAgo(new Date(notification.created_at));
+
+    return `
+        <div class="notification-item ${notification.is_read ? '' : 'unread'}" data-notification-id="${notification.id}">
+            <div class="notification-content">
+                <p class="notification-text">${escapeNotificationHtml(notification.message)}</p>
+                <span class="notification-time">${time}</span>
+            </div>
+        </div>
+    `;
+}
+
+// Helper: Get time ago string
+function getNotificationTimeAgo(date) {
+    const seconds = Math.floor((new Date() - date) / 1000);
+
+    const intervals = {
+        year: 31536000,
+        month: 2592000,
+        week: 604800,
+        day: 86400,
+        hour: 3600,
+        minute: 60
+    };
+
+    for (const [unit, secondsInUnit] of Object.entries(intervals)) {
+        const interval = Math.floor(seconds / secondsInUnit);
+        if (interval >= 1) {
+            return interval === 1 ? `1 ${unit} ago` : `${interval} ${unit}s ago`;
+        }
     }
-});
\ No newline at end of file
+
+    return 'just now';
+}
+
+// Helper: Escape HTML to prevent XSS
+function escapeNotificationHtml(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
@@ -1,41 +1,39 @@
-// Rename wallpaper functionality
-document.addEventListener('DOMContentLoaded', function() {
-    const renameButtons = document.querySelectorAll('.rename-button');
+// Rename wallpaper functionality, delegated so cards added by the infinite scroll work too
+document.addEventListener('click', function(e) {
+    const button = e.target.closest('.rename-button');
+    if (!button) {
+        return;
+    }
+    e.preventDefault();
 
-    renameButtons.forEach(button => {
-        button.addEventListener('click', function(e) {
-            e.preventDefault();
+    const wallpaperId = button.dataset.wallpaperId;
+    const card = button.closest('.wallpaper-card');
+    const currentName = card.querySelector('h3').textContent;
 
-            const wallpaperId = this.dataset.wallpaperId;
-            const card = this.closest('.wallpaper-card');
-            const currentName = card.querySelector('h3').textContent;
+    // Show a prompt for new name
+    const newName = prompt('Enter new name for wallpaper:', currentName);
 
-            // Show a prompt for new name
-            const newName = prompt('Enter new name for wallpaper:', currentName);
+    if (newName && newName.trim() !== '') {
+        // Create and submit a form
+        const form = document.createElement('form');
+        form.method = 'POST';
+        form.action = '/rename';
 
-            if (newName && newName.trim() !== '') {
-                // Create and submit a form
-                const form = document.createElement('form');
-                form.method = 'POST';
-                form.action = '/rename';
+        // Add wallpaper ID
+        const idInput = document.createElement('input');
+        idInput.type = 'hidden';
+        idInput.name = 'wallpaper_id';
+        idInput.value = wallpaperId;
 
-                // Add wallpaper ID
-                const idInput = document.createElement('input');
-                idInput.type = 'hidden';
-                idInput.name = 'wallpaper_id';
-                idInput.value = wallpaperId;
+        // Add new name
+        const nameInput = document.createElement('input');
+        nameInput.type = 'hidden';
+        nameInput.name = 'new_name';
+        nameInput.value = newName.trim();
 
-                // Add new name
-                const nameInput = document.createElement('input');
-                nameInput.type = 'hidden';
-                nameInput.name = 'new_name';
-                nameInput.value = newName.trim();
-
-                form.appendChild(idInput);
-                form.appendChild(nameInput);
-                document.body.appendChild(form);
-                form.submit();
-            }
-        });
-    });
-});
\ No newline at end of file
+        form.appendChild(idInput);
+        form.appendChild(nameInput);
+        document.body.appendChild(form);
+        form.submit();
+    }
+});
@@ -0,0 +1,168 @@
+// Resumable uploads (tus 1.0, see /api/v1/uploads) for the large files of the upload form:
+// they are sent in chunks, a broken connection resumes where it stopped, and choosing the
+// same file again after a reload resumes the upload too. The small files, the ZIP archives and
+// the batches going into a new collection use the plain form.
+(function() {
+    const THRESHOLD = 8 * 1024 * 1024;
+    const CHUNK_SIZE = 5 * 1024 * 1024;
+    const RETRY_DELAYS = [1000, 3000, 10000, 30000];
+    const TUS_HEADERS = { 'Tus-Resumable': '1.0.0' };
+
+    const form = document.querySelector('.upload-form');
+    if (!form || !window.fetch) {
+        return;
+    }
+
+    const status = document.createElement('p');
+    status.className = 'upload-progress';
+    status.hidden = true;
+    form.appendChild(status);
+
+    form.addEventListener('submit', async function(e) {
+        const files = Array.from(form.querySelector('input[type="file"]').files);
+        const collection = form.querySelector('[name="collection"]');
+        if (!files.some(f => f.size > THRESHOLD) || files.some(f => /\.zip$/i.test(f.name)) ||
+            (collection && collection.value.trim() !== '')) {
+            return;
+        }
+        e.preventDefault();
+
+        const button = form.querySelector('button[type="submit"]');
+        button.disabled = true;
+        status.hidden = false;
+
+        const meta = {
+            tags: form.querySelector('[name="tags"]').value,
+            description: form.querySelector('[name="description"]').value
+        };
+        try {
+            for (let i = 0; i < files.length; i++) {
+                await uploadFile(files[i], meta, (sent) => {
+                    const percent = Math.floor(sent * 100 / Math.max(files[i].size, 1));
+                    status.textContent = `Uploading ${files[i].name} (${i + 1}/${files.length}): ${percent}%`;
+                });
+            }
+            window.location.href = '/wallpapers';
+        } catch (err) {
+            status.textContent = `❌ ${err.message} Submit the same files again to resume.`;
+            button.disabled = false;
+        }
+    });
+
+    // the upload URL of a file is remembered, to resume it after a reload
+    function storageKey(file) {
+        return `tus:${file.name}:${file.size}:${file.lastModified}`;
+    }
+
+    function encodeMetadata(values) {
+        return Object.entries(values)
+            .map(([key, value]) => {
+                const bytes = new TextEncoder().encode(value);
+                let binary = '';
+                bytes.forEach(b => binary += String.fromCharCode(b));
+                return `${key} ${btoa(binary)}`;
+            })
+            .join(',');
+    }
+
+    async function errorOf(response) {
+        try {
+            const body = await response.json();
+            return new Error(body.error || response.statusText);
+        } catch (_) {
+            return new Error(response.statusText);
+        }
+    }
+
+    async function createUpload(file, meta) {
+        const response = await fetch('/api/v1/uploads', {
+            method: 'POST',
+            headers: Object.assign({
+                'Upload-Length': String(file.size),
+                'Upload-Metadata': encodeMetadata({ filename: file.name, tags: meta.tags, description: meta.description })
+            }, TUS_HEADERS)
+        });
+        if (response.status !== 201) {
+            throw await errorOf(response);
+        }
+        return response.headers.get('Location');
+    }
+
+    // the offset to resume from, or null when the upload is gone
+    async function currentOffset(url) {
+        const response = await fetch(url, { method: 'HEAD', headers: TUS_HEADERS, cache: 'no-store' });
+        if (response.status === 404 || response.status === 410) {
+            return null;
+        }
+        if (!response.ok) {
+            throw new Error(`The server answered ${response.status}.`);
+        }
+        return parseInt(response.headers.get('Upload-Offset'), 10);
+    }
+
+    function sleep(ms) {
+        return new Promise(resolve => setTimeout(resolve, ms));
+    }
+
+    async function uploadFile(file, meta, onProgress) {
+        const key = storageKey(file);
+        let url = localStorage.getItem(key);
+        let offset = url ? await currentOffset(url) : null;
+        if (offset === null) {
+            url = await createUpload(file, meta);
+            localStorage.setItem(key, url);
+            offset = 0;
+        }
+
+        let failures = 0;
+        while (true) {
+            onProgress(offset);
+            let response;
+            try {
+                response = await fetch(url, {
+                    method: 'PATCH',
+                    headers: Object.assign({
+                        'Content-Type': 'application/offset+octet-stream',
+                        'Upload-Offset': String(offset)
+                    }, TUS_HEADERS),
+                    body: file.slice(offset, offset + CHUNK_SIZE)
+                });
+            } catch (_) {
+                response = null; // network error
+            }
+
+            if (response && response.status === 204) {
+                failures = 0;
+                offset = parseInt(response.headers.get('Upload-Offset'), 10);
+                if (response.headers.get('X-Wallpaper-Id')) {
+                    localStorage.removeItem(key);
+                    onProgress(file.size);
+                    return;
+                }
+                continue;
+            }
+            if (response && response.status >= 400 && response.status < 500 && response.status !== 409 && response.status !== 423) {
+                localStorage.removeItem(key);
+                throw await errorOf(response);
+            }
+
+            // network error, conflict or server error: wait, then ask the server where to resume
+            if (failures >= RETRY_DELAYS.length) {
+                throw new Error(`The upload of ${file.name} keeps failing.`);
+            }
+            await sleep(RETRY_DELAYS[failures++]);
+            try {
+                const resumed = await currentOffset(url);
+                if (resumed === null) {
+                    localStorage.removeItem(key);
+                    throw new Error(`The upload of ${file.name} has expired.`);
+                }
+                offset = resumed;
+            } catch (err) {
+                if (err.message.includes('expired')) {
+                    throw err;
+                }
+            }
+        }
+    }
+})();
@@ -1,13 +1,16 @@
- // Save scroll position when submit
-    document.addEventListener("submit", () => {
+// Save scroll position when submit
+document.addEventListener("submit", () => {
     sessionStorage.setItem("scrollY", window.scrollY);
 });
 
-    // Restore scroll position
-    window.addEventListener("load", () => {
+// Restore scroll position, once the infinite scroll reloaded its pages (see infinite-scroll.js)
+window.addEventListener("load", async () => {
     const y = sessionStorage.getItem("scrollY");
     if (y !== null) {
-    window.scrollTo(0, parseInt(y, 10));
-    sessionStorage.removeItem("scrollY");
-}
+        sessionStorage.removeItem("scrollY");
+        if (window.galleryRestored) {
+            await window.galleryRestored;
+        }
+        window.scrollTo(0, parseInt(y, 10));
+    }
 });
@@ -0,0 +1,71 @@
+// Autocomplete for the comma separated tag inputs (.tag-input)
+document.addEventListener('DOMContentLoaded', function() {
+    document.querySelectorAll('.tag-input').forEach(setupTagInput);
+});
+
+// cards added by the infinite scroll
+document.addEventListener('gallery:page', function(e) {
+    e.detail.cards.forEach(card => card.querySelectorAll('.tag-input').forEach(setupTagInput));
+});
+
+function setupTagInput(input) {
+    const list = document.createElement('ul');
+    list.className = 'tag-suggestions';
+    input.insertAdjacentElement('afterend', list);
+
+    let timer = null;
+    input.addEventListener('input', function() {
+        clearTimeout(timer);
+        timer = setTimeout(() => suggestTags(input, list), 150);
+    });
+
+    input.addEventListener('blur', function() {
+        // let a click on a suggestion land first
+        setTimeout(() => list.innerHTML = '', 200);
+    });
+
+    list.addEventListener('mousedown', function(e) {
+        const item = e.target.closest('li');
+        if (!item) {
+            return;
+        }
+        e.preventDefault();
+
+        // replace the tag being typed with the suggestion
+        const parts = input.value.split(',');
+        parts[parts.length - 1] = ' ' + item.dataset.tag;
+        input.value = parts.join(',').replace(/^\s+/, '') + ', ';
+        list.innerHTML = '';
+        input.focus();
+    });
+}
+
+async function suggestTags(input, list) {
+    const current = input.value.split(',').pop().trim();
+    if (current === '') {
+        list.innerHTML = '';
+        return;
+    }
+
+    try {
+        const response = await fetch('/api/tags?q=' + encodeURIComponent(current) + '&limit=8');
+        if (!response.ok) {
+            return;
+        }
+        const tags = await response.json();
+        list.innerHTML = tags.map(tag => {
+            // an alias suggests its canonical tag
+            const name = tag.alias_of || tag.name;
+            const label = tag.alias_of ? tag.name + ' → ' + tag.alias_of : tag.name;
+            return '<li data-tag="' + escapeTag(name) + '">#' + escapeTag(label) + ' <span class="tag-count">' + tag.count + '</span></li>';
+        }).join('');
+    } catch (err) {
+        console.error('Failed to load tags:', err);
+    }
+}
+
+function escapeTag(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
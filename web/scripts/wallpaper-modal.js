@@ -1,31 +1,30 @@
 // Wallpaper Modal with Comments
 let currentWallpaperId = null;
+let replyToCommentId = null;
+let commentStream = null;
+
+// Open the modal when clicking a card image, delegated so cards added by
+// the infinite scroll work too
+document.addEventListener('click', function(e) {
+    const imageContainer = e.target.closest('.wallpaper-image-container');
+    if (!imageContainer) {
+        return;
+    }
 
-// Add click listeners to wallpaper cards
-document.addEventListener('DOMContentLoaded', function() {
-    const wallpaperCards = document.querySelectorAll('.wallpaper-card');
-
-    wallpaperCards.forEach(card => {
-        const imageContainer = card.querySelector('.wallpaper-image-container');
-
-        if (imageContainer) {
-            imageContainer.addEventListener('click', function(e) {
-                // Don't open modal if clicking on buttons/forms/links
-                if (e.target.closest('button') || e.target.closest('a') || e.target.closest('form')) {
-                    return;
-                }
-
-                // Get wallpaper data
-                const wallpaperId = card.dataset.wallpaperId;
-                const image = card.querySelector('.wallpaper-image');
-                const title = card.querySelector('h3').textContent;
-                const date = card.querySelector('.upload-date').textContent;
-
-                // Open the modal
-                openWallpaperModal(wallpaperId, image.src, title, date);
-            });
-        }
-    });
+    // Don't open modal if clicking on buttons/forms/links
+    if (e.target.closest('button') || e.target.closest('a') || e.target.closest('form') || e.target.closest('details')) {
+        return;
+    }
+
+    // Get wallpaper data
+    const card = imageContainer.closest('.wallpaper-card');
+    const wallpaperId = card.dataset.wallpaperId;
+    const image = card.querySelector('.wallpaper-image');
+    const title = card.querySelector('h3').textContent;
+    const date = card.querySelector('.upload-date').textContent;
+
+    // Open the modal
+    openWallpaperModal(wallpaperId, image.src, title, date);
 });
 
 function openWallpaperModal(wallpaperId, imageUrl, title, date) {
@@ -47,8 +46,43 @@ function openWallpaperModal(wallpaperId, imageUrl, title, date) {
     modal.classList.add('active');
     document.body.style.overflow = 'hidden'; // Prevent background scrolling
 
-    // Load comments for this wallpaper
+    // Load comments for this wallpaper, then listen for new ones
     loadComments(currentWallpaperId);
+    openCommentStream(currentWallpaperId);
+}
+
+// Live comments over Server-Sent Events
+function openCommentStream(wallpaperId) {
+    closeCommentStream();
+    if (!window.EventSource) {
+        return;
+    }
+
+    commentStream = new EventSource(`/api/events?wallpaper_id=${wallpaperId}`);
+    commentStream.addEventListener('comment', function(e) {
+        const comment = JSON.parse(e.data);
+        if (comment.wallpaper_id !== currentWallpaperId) {
+            return;
+        }
+        // already shown (e.g. our own comment after reload)
+        if (document.querySelector(`.comment-item[data-comment-id="${comment.id}"]`)) {
+            return;
+        }
+
+        const commentsList = document.getElementById('commentsList');
+        const empty = commentsList.querySelector('.no-comments');
+        if (empty) {
+            empty.remove();
+        }
+        commentsList.insertAdjacentHTML('afterbegin', createCommentHTML(comment));
+    });
+}
+
+function closeCommentStream() {
+    if (commentStream) {
+        commentStream.close();
+        commentStream = null;
+    }
 }
 
 function closeWallpaperModal() {
@@ -56,15 +90,21 @@ function closeWallpaperModal() {
     modal.classList.remove('active');
     document.body.style.overflow = ''; // Restore scrolling
     currentWallpaperId = null;
+    closeCommentStream();
 
     // Clear comment form
     document.getElementById('commentText').value = '';
+    cancelReply();
     updateCharCount();
 }
 
 // Close modal with Escape key
 document.addEventListener('keydown', function(e) {
     if (e.key === 'Escape') {
+        if (replyToCommentId) {
+            cancelReply();
+            return;
+        }
         closeWallpaperModal();
     }
 });
@@ -130,18 +170,44 @@ function createCommentHTML(comment) {
     const timeAgo = getTimeAgo(date);
 
     return `
-        <div class="comment-item" data-comment-id="${comment.id}">
+        <div class="comment-item ${comment.parent_id ? 'comment-reply' : ''}" data-comment-id="${comment.id}">
             <div class="comment-header">
-                <span class="comment-author">${escapeHtml(comment.username)}</span>
+                <span class="comment-author">${comment.parent_id ? '↳ ' : ''}${escapeHtml(comment.username)}</span>
+                ${createBadgesHTML(comment.badges)}
                 <span class="comment-time">${timeAgo}</span>
             </div>
             <div class="comment-body">
                 ${escapeHtml(comment.text)}
             </div>
+            <button type="button" class="comment-reply-button" onclick="replyToComment(${comment.id}, this)">Reply</button>
         </div>
     `;
 }
 
+// Badges next to the username
+function createBadgesHTML(badges) {
+    if (!badges || badges.length === 0) {
+        return '';
+    }
+    return `<span class="comment-badges">${badges.map(b =>
+        `<span class="badge" title="${escapeHtml(b.name)}: ${escapeHtml(b.description)}">${escapeHtml(b.icon)}</span>`
+    ).join('')}</span>`;
+}
+
+// Reply to a comment: the next posted comment gets it as parent
+function replyToComment(commentId, button) {
+    replyToCommentId = commentId;
+    const author = button.closest('.comment-item').querySelector('.comment-author').textContent;
+    const commentText = document.getElementById('commentText');
+    commentText.placeholder = `Replying to ${author.replace('↳ ', '')}... (Esc to cancel)`;
+    commentText.focus();
+}
+
+function cancelReply() {
+    replyToCommentId = null;
+    document.getElementById('commentText').placeholder = 'Share your thoughts...';
+}
+
 // Submit new comment
 async function submitComment(event) {
     event.preventDefault();
@@ -161,6 +227,7 @@ async function submitComment(event) {
             },
             body: JSON.stringify({
                 wallpaper_id: currentWallpaperId,
+                parent_id: replyToCommentId || undefined,
                 text: text
             })
         });
@@ -171,6 +238,7 @@ async function submitComment(event) {
 
         // Clear form
         commentText.value = '';
+        cancelReply();
         updateCharCount();
 
         // Reload comments